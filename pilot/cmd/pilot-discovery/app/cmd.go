@@ -137,6 +137,13 @@ func addFlags(c *cobra.Command) {
 		"comma separated list of networking plugins to enable")
 	c.PersistentFlags().DurationVar(&serverArgs.ShutdownDuration, "shutdownDuration", 10*time.Second,
 		"Duration the discovery server needs to terminate gracefully")
+	c.PersistentFlags().BoolVar(&serverArgs.LeaderElection, "leaderElection", false,
+		"If enabled, singleton loops such as the self-signed root cert rotation, the webhook cert controller and the "+
+			"validating webhook patching only run on the istiod instance holding their leader election lease")
+	c.PersistentFlags().DurationVar(&serverArgs.RegistryShutdownTimeout, "registryShutdownTimeout", 0,
+		"Maximum duration to wait for the service registries to stop during shutdown. If unset, shutdownDuration is used")
+	c.PersistentFlags().StringVar(&serverArgs.PushEventsKafkaURL, "pushEventsKafkaURL", "",
+		"URL of a topic on a Kafka REST proxy to publish push statistics to, such as http://kafka-rest:8082/topics/istio-pushes")
 
 	// RegistryOptions Controller options
 	c.PersistentFlags().StringVar(&serverArgs.RegistryOptions.FileDir, "configDir", "",
@@ -147,6 +154,9 @@ func addFlags(c *cobra.Command) {
 		"DNS domain suffix")
 	c.PersistentFlags().StringVar(&serverArgs.RegistryOptions.KubeOptions.ClusterID, "clusterID", features.ClusterName,
 		"The ID of the cluster that this Istiod instance resides")
+	c.PersistentFlags().StringSliceVar(&serverArgs.RegistryOptions.KubeOptions.ExcludedNamespaces, "excludedNamespaces", nil,
+		"Comma separated list of namespaces whose objects are ignored by the Kubernetes registry, "+
+			"even if they are selected by the mesh discovery selectors")
 
 	// using address, so it can be configured as localhost:.. (possibly UDS in future)
 	c.PersistentFlags().StringVar(&serverArgs.ServerOptions.HTTPAddr, "httpAddr", ":8080",
@@ -161,6 +171,12 @@ func addFlags(c *cobra.Command) {
 		"HTTP address to use for pilot's self-monitoring information")
 	c.PersistentFlags().BoolVar(&serverArgs.ServerOptions.EnableProfiling, "profile", true,
 		"Enable profiling via web interface host:port/debug/pprof")
+	c.PersistentFlags().IntVar(&serverArgs.ServerOptions.StreamWriteBufferSize, "grpcWriteBufferSize", 32*1024,
+		"Size in bytes of the write buffer of each gRPC connection")
+	c.PersistentFlags().IntVar(&serverArgs.ServerOptions.StreamReadBufferSize, "grpcReadBufferSize", 32*1024,
+		"Size in bytes of the read buffer of each gRPC connection")
+	c.PersistentFlags().StringSliceVar(&serverArgs.ServerOptions.AdditionalADSServiceNames, "additionalADSServiceNames", nil,
+		"Comma separated list of additional gRPC service names to serve ADS under")
 
 	// Use TLS certificates if provided.
 	c.PersistentFlags().StringVar(&serverArgs.ServerOptions.TLSOptions.CaCertFile, "caCertFile", "",
@@ -169,6 +185,26 @@ func addFlags(c *cobra.Command) {
 		"File containing the x509 Server Certificate")
 	c.PersistentFlags().StringVar(&serverArgs.ServerOptions.TLSOptions.KeyFile, "tlsKeyFile", "",
 		"File containing the x509 private key matching --tlsCertFile")
+	c.PersistentFlags().DurationVar(&serverArgs.ServerOptions.TLSOptions.MaxClientCertAge, "tlsMaxClientCertAge", 0,
+		"If set, client certificates issued longer ago than this are rejected, even if they are still valid")
+	c.PersistentFlags().DurationVar(&serverArgs.ServerOptions.TLSOptions.HandshakeTimeout, "tlsHandshakeTimeout", 10*time.Second,
+		"The time allowed for clients to complete the TLS handshake on the secure listeners. If 0, handshakes are not bounded")
+	c.PersistentFlags().StringVar(&serverArgs.ServerOptions.TLSOptions.CRLFile, "tlsCRLFile", "",
+		"File containing the CRLs used to reject revoked client certificates. The file is reloaded when it changes")
+	c.PersistentFlags().BoolVar(&serverArgs.ServerOptions.TLSOptions.EnableOCSPStapling, "tlsEnableOCSPStapling", false,
+		"If enabled, OCSP responses for the istiod certificate are fetched from its OCSP responder and stapled to TLS handshakes")
+	c.PersistentFlags().StringSliceVar(&serverArgs.ServerOptions.TLSOptions.SCTList, "tlsSCTFiles", nil,
+		"Comma-separated list of files of signed certificate timestamps, in the binary format of RFC 6962, served with "+
+			"the istiod certificate")
+	c.PersistentFlags().StringVar(&serverArgs.ServerOptions.TLSOptions.ValidationCertProvider, "validationCertProvider", "",
+		"The provider of the certificate of the HTTPS webhook server, one of kubernetes or file. If unset, the webhooks "+
+			"share the istiod certificate")
+	c.PersistentFlags().StringVar(&serverArgs.ServerOptions.TLSOptions.ValidationCertFile, "validationCertFile", "",
+		"File containing the x509 certificate of the HTTPS webhook server, with --validationCertProvider=file")
+	c.PersistentFlags().StringVar(&serverArgs.ServerOptions.TLSOptions.ValidationKeyFile, "validationKeyFile", "",
+		"File containing the x509 private key matching --validationCertFile")
+	c.PersistentFlags().StringVar(&serverArgs.ServerOptions.TLSOptions.ValidationCaCertFile, "validationCaCertFile", "",
+		"File containing the CA bundle of --validationCertFile, patched into the webhook configurations")
 	c.PersistentFlags().StringSliceVar(&serverArgs.ServerOptions.TLSOptions.TLSCipherSuites, "tls-cipher-suites", nil,
 		"Comma-separated list of cipher suites for istiod TLS server. "+
 			"If omitted, the default Go cipher suites will be used. \n"+
@@ -0,0 +1,144 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bootstrap
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"istio.io/istio/pilot/pkg/features"
+	kubecontroller "istio.io/istio/pilot/pkg/serviceregistry/kube/controller"
+	"istio.io/pkg/log"
+)
+
+const redactedValue = "[redacted]"
+
+// argsDump is the response of the /debug/args endpoint.
+type argsDump struct {
+	// Args are the effective arguments istiod is running with, with sensitive values redacted.
+	Args *PilotArgs `json:"args"`
+	// Identity identifies this istiod instance.
+	Identity InstanceIdentity `json:"identity"`
+	// Listeners are the resolved addresses of the istiod listeners, keyed by name. Only listeners that
+	// have been started are included.
+	Listeners map[string]string `json:"listeners"`
+}
+
+// redactArgs returns a copy of args safe to expose on a debug endpoint. Sensitive values are replaced, and
+// runtime dependencies that are not configuration are dropped.
+func redactArgs(args *PilotArgs) *PilotArgs {
+	out := *args
+	if out.JwtRule != "" {
+		out.JwtRule = redactedValue
+	}
+	out.PushEventsKafkaURL = redactURL(out.PushEventsKafkaURL)
+	// Only keep plain configuration of the Kubernetes controller options.
+	ko := args.RegistryOptions.KubeOptions
+	out.RegistryOptions.KubeOptions = kubecontroller.Options{
+		SystemNamespace:    ko.SystemNamespace,
+		ResyncPeriod:       ko.ResyncPeriod,
+		DomainSuffix:       ko.DomainSuffix,
+		ClusterID:          ko.ClusterID,
+		EndpointMode:       ko.EndpointMode,
+		KubernetesAPIQPS:   ko.KubernetesAPIQPS,
+		KubernetesAPIBurst: ko.KubernetesAPIBurst,
+		SyncInterval:       ko.SyncInterval,
+		ExcludedNamespaces: ko.ExcludedNamespaces,
+	}
+	return &out
+}
+
+// redactURL returns u without its userinfo, which may carry credentials. Unparsable URLs are redacted entirely.
+func redactURL(u string) string {
+	if u == "" {
+		return ""
+	}
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return redactedValue
+	}
+	parsed.User = nil
+	return parsed.String()
+}
+
+// recordListener records the resolved address of a started listener, for debugging.
+func (s *Server) recordListener(name string, addr net.Addr) {
+	s.listenersMu.Lock()
+	defer s.listenersMu.Unlock()
+	if s.listeners == nil {
+		s.listeners = map[string]string{}
+	}
+	s.listeners[name] = addr.String()
+}
+
+// argsHandler serves the effective istiod arguments as JSON.
+func (s *Server) argsHandler(args *PilotArgs) http.HandlerFunc {
+	redacted := redactArgs(args)
+	return func(w http.ResponseWriter, _ *http.Request) {
+		s.listenersMu.RLock()
+		listeners := make(map[string]string, len(s.listeners))
+		for name, addr := range s.listeners {
+			listeners[name] = addr
+		}
+		s.listenersMu.RUnlock()
+
+		b, err := json.MarshalIndent(argsDump{Args: redacted, Identity: args.InstanceIdentity(), Listeners: listeners}, "", "  ")
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write([]byte(err.Error()))
+			return
+		}
+		w.Header().Add("Content-Type", "application/json")
+		if _, err := w.Write(b); err != nil {
+			log.Warnf("failed to write args: %v", err)
+		}
+	}
+}
+
+// sensitiveFeatureSuffixes are suffixes of the names of features whose values are redacted on /debug/features.
+var sensitiveFeatureSuffixes = []string{"TOKEN", "SECRET", "PASSWORD", "PRIVATE_KEY"}
+
+// redactFeatures replaces the values of sensitive features in values.
+func redactFeatures(values map[string]string) map[string]string {
+	for name, value := range values {
+		if value == "" {
+			continue
+		}
+		for _, s := range sensitiveFeatureSuffixes {
+			if strings.HasSuffix(name, s) {
+				values[name] = redactedValue
+				break
+			}
+		}
+	}
+	return values
+}
+
+// featuresHandler serves the effective values of the istiod features as JSON.
+func featuresHandler(w http.ResponseWriter, _ *http.Request) {
+	b, err := json.MarshalIndent(redactFeatures(features.EffectiveValues()), "", "  ")
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte(err.Error()))
+		return
+	}
+	w.Header().Add("Content-Type", "application/json")
+	if _, err := w.Write(b); err != nil {
+		log.Warnf("failed to write features: %v", err)
+	}
+}
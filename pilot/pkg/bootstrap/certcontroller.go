@@ -16,17 +16,23 @@ package bootstrap
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/pem"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"os"
 	"path"
 	"strings"
 	"time"
 
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
 	"istio.io/istio/pilot/pkg/features"
 	"istio.io/istio/pilot/pkg/keycertbundle"
+	"istio.io/istio/pilot/pkg/leaderelection"
 	"istio.io/istio/pilot/pkg/serviceregistry/kube/controller"
 	"istio.io/istio/pkg/config/constants"
 	"istio.io/istio/pkg/security"
@@ -48,6 +54,35 @@ const (
 	defaultCACertPath = "./var/run/secrets/kubernetes.io/serviceaccount/ca.crt"
 )
 
+// genKeyCertK8sCA generates a key and cert signed by the Kubernetes CA. Replaced in tests.
+var genKeyCertK8sCA = chiron.GenKeyCertK8sCA
+
+// genKeyCertIstiodCA generates a key and cert signed by the istiod CA. Replaced in tests.
+var genKeyCertIstiodCA = (*ca.IstioCA).GenKeyCert
+
+// newCSRSlots returns the semaphore bounding Kubernetes CSRs in flight to max, at least 1.
+func newCSRSlots(max int) chan struct{} {
+	if max < 1 {
+		max = 1
+	}
+	return make(chan struct{}, max)
+}
+
+// csrSlotTimeout bounds the wait for a CSR slot, so a stuck signer fails new issuances instead of blocking them.
+var csrSlotTimeout = 30 * time.Second
+
+// acquireCSRSlot waits for a CSR slot, returning the function releasing it, or an error if none is free in time.
+func (s *Server) acquireCSRSlot() (func(), error) {
+	timer := time.NewTimer(csrSlotTimeout)
+	defer timer.Stop()
+	select {
+	case s.csrSlots <- struct{}{}:
+		return func() { <-s.csrSlots }, nil
+	case <-timer.C:
+		return nil, fmt.Errorf("timed out after %v waiting for one of %d outstanding CSRs", csrSlotTimeout, cap(s.csrSlots))
+	}
+}
+
 // CertController can create certificates signed by K8S server.
 func (s *Server) initCertController(args *PilotArgs) error {
 	var err error
@@ -82,14 +117,8 @@ func (s *Server) initCertController(args *PilotArgs) error {
 	if err != nil {
 		return fmt.Errorf("failed to create certificate controller: %v", err)
 	}
-	s.addStartFunc(func(stop <-chan struct{}) error {
-		go func() {
-			// Run Chiron to manage the lifecycles of certificates
-			s.certController.Run(stop)
-		}()
-
-		return nil
-	})
+	// Run Chiron to manage the lifecycles of certificates. The secrets are shared, so one instance manages them.
+	s.addSingletonStartFunc(leaderelection.WebhookCertController, s.certController.Run)
 
 	return nil
 }
@@ -104,46 +133,68 @@ func (s *Server) initCertController(args *PilotArgs) error {
 //
 // TODO: If the discovery address in mesh.yaml is set to port 15012 (XDS-with-DNS-certs) and the name
 // matches the k8s namespace, failure to start DNS server is a fatal error.
-func (s *Server) initDNSCerts(hostname, customHost, namespace string) error {
+func (s *Server) initDNSCerts(hostname, customHost, namespace, podIP, provider string) error {
 	// Name in the Istiod cert - support the old service names as well.
 	// validate hostname contains namespace
 	parts := strings.Split(hostname, ".")
 	hostnamePrefix := parts[0]
 
-	// append custom hostname if there is any
-	names := []string{hostname}
-	if customHost != "" && customHost != hostname {
-		log.Infof("Adding custom hostname %s", customHost)
-		names = append(names, customHost)
+	names := getDNSNames(hostname, customHost, namespace, podIP)
+	if s.discoveredAddress != "" && !containsString(names, s.discoveredAddress) {
+		log.Infof("Adding discovered address %s", s.discoveredAddress)
+		names = append(names, s.discoveredAddress)
 	}
 
-	// The first is the recommended one, also used by Apiserver for webhooks.
-	// add a few known hostnames
-	for _, altName := range []string{"istiod", "istiod-remote", "istio-pilot"} {
-		name := fmt.Sprintf("%v.%v.svc", altName, namespace)
-		if name == hostname || name == customHost {
-			continue
+	selfSigned, err := s.issueDNSCert(names, hostnamePrefix, namespace, provider)
+	if err != nil {
+		return err
+	}
+	if selfSigned {
+		s.addStartFunc(func(stop <-chan struct{}) error {
+			go func() {
+				// regenerate istiod key cert when root cert changes.
+				s.watchRootCertAndGenKeyCert(names, stop)
+			}()
+			return nil
+		})
+	}
+	if provider == constants.CertProviderKubernetes || provider == constants.CertProviderIstiod {
+		s.rotateDNSCert = func() error {
+			_, err := s.issueDNSCert(names, hostnamePrefix, namespace, provider)
+			return err
 		}
-		names = append(names, name)
 	}
+	return nil
+}
 
+// issueDNSCert issues the Istiod DNS cert for names from the provider, and notifies the istiodCertBundleWatcher.
+// It returns true if the cert is signed by the self-signed istiod CA.
+func (s *Server) issueDNSCert(names []string, hostnamePrefix, namespace, provider string) (bool, error) {
 	var certChain, keyPEM, caBundle []byte
 	var err error
-	if features.PilotCertProvider.Get() == constants.CertProviderKubernetes {
+	selfSigned := false
+	if provider == constants.CertProviderKubernetes {
 		log.Infof("Generating K8S-signed cert for %v", names)
-		certChain, keyPEM, _, err = chiron.GenKeyCertK8sCA(s.kubeClient.CertificatesV1beta1().CertificateSigningRequests(),
+		// Wait for an outstanding CSR to be issued or time out before creating a new one, so a slow
+		// signer does not pile up CSRs.
+		release, err := s.acquireCSRSlot()
+		if err != nil {
+			return false, err
+		}
+		certChain, keyPEM, _, err = genKeyCertK8sCA(s.kubeClient.CertificatesV1beta1().CertificateSigningRequests(),
 			strings.Join(names, ","), hostnamePrefix+".csr.secret", namespace, defaultCACertPath)
+		release()
 		if err != nil {
-			return fmt.Errorf("failed genrating ker cert by k8s: %v", err)
+			return false, fmt.Errorf("failed genrating ker cert by k8s: %v", err)
 		}
 		caBundle, err = ioutil.ReadFile(defaultCACertPath)
 		if err != nil {
-			return fmt.Errorf("failed reading %s: %v", defaultCACertPath, err)
+			return false, fmt.Errorf("failed reading %s: %v", defaultCACertPath, err)
 		}
-	} else if features.PilotCertProvider.Get() == constants.CertProviderIstiod {
-		certChain, keyPEM, err = s.CA.GenKeyCert(names, SelfSignedCACertTTL.Get(), false)
+	} else if provider == constants.CertProviderIstiod {
+		certChain, keyPEM, err = s.genIstiodKeyCert(names)
 		if err != nil {
-			return fmt.Errorf("failed generating istiod key cert %v", err)
+			return false, fmt.Errorf("failed generating istiod key cert %v", err)
 		}
 		log.Infof("Generating istiod-signed cert for %v:\n %s", names, certChain)
 
@@ -152,31 +203,105 @@ func (s *Server) initDNSCerts(hostname, customHost, namespace string) error {
 		if _, err := os.Stat(signingKeyFile); err != nil {
 			log.Infof("No plugged-in cert at %v; self-signed cert is used", signingKeyFile)
 			caBundle = s.CA.GetCAKeyCertBundle().GetRootCertPem()
-			s.addStartFunc(func(stop <-chan struct{}) error {
-				go func() {
-					// regenerate istiod key cert when root cert changes.
-					s.watchRootCertAndGenKeyCert(names, stop)
-				}()
-				return nil
-			})
+			selfSigned = true
 		} else {
 			log.Infof("Use plugged-in cert at %v", signingKeyFile)
 			caBundle, err = ioutil.ReadFile(path.Join(LocalCertDir.Get(), ca.RootCertFile))
 			if err != nil {
-				return fmt.Errorf("failed reading %s: %v", path.Join(LocalCertDir.Get(), ca.RootCertFile), err)
+				return false, fmt.Errorf("failed reading %s: %v", path.Join(LocalCertDir.Get(), ca.RootCertFile), err)
 			}
 		}
 	} else {
 		customCACertPath := security.DefaultRootCertFilePath
 		log.Infof("User specified cert provider: %v, mounted in a well known location %v",
-			features.PilotCertProvider.Get(), customCACertPath)
+			provider, customCACertPath)
 		caBundle, err = ioutil.ReadFile(customCACertPath)
 		if err != nil {
-			return fmt.Errorf("failed reading %s: %v", customCACertPath, err)
+			return false, fmt.Errorf("failed reading %s: %v", customCACertPath, err)
 		}
 	}
 	s.istiodCertBundleWatcher.SetAndNotify(keyPEM, certChain, caBundle)
-	return nil
+	return selfSigned, nil
+}
+
+// genIstiodKeyCert generates the istiod key cert for names with the istiod CA. As generation may fail transiently,
+// failures are retried up to features.SelfSignedCertRetries times, with exponential backoff.
+func (s *Server) genIstiodKeyCert(names []string) ([]byte, []byte, error) {
+	backoff := features.SelfSignedCertRetryBackoff
+	for attempt := 0; ; attempt++ {
+		certChain, keyPEM, err := genKeyCertIstiodCA(s.CA, names, SelfSignedCACertTTL.Get(), false)
+		if err == nil || attempt >= features.SelfSignedCertRetries {
+			return certChain, keyPEM, err
+		}
+		log.Warnf("failed generating istiod key cert, retrying in %v: %v", backoff, err)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// discoverSelfAddress returns the LoadBalancer ingress address of the istiod Service, named after the first label
+// of hostname. The Service is looked up in the namespace of hostname if it is a service host, or namespace otherwise.
+func (s *Server) discoverSelfAddress(hostname, namespace string) (string, error) {
+	parts := strings.Split(hostname, ".")
+	name := parts[0]
+	if len(parts) > 1 && parts[1] != "svc" {
+		namespace = parts[1]
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	svc, err := s.kubeClient.CoreV1().Services(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+	for _, ingress := range svc.Status.LoadBalancer.Ingress {
+		if ingress.Hostname != "" {
+			return ingress.Hostname, nil
+		}
+		if ingress.IP != "" {
+			return ingress.IP, nil
+		}
+	}
+	return "", fmt.Errorf("service %s/%s has no LoadBalancer ingress", namespace, name)
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// getDNSNames returns the SANs of the Istiod DNS cert. If IncludePodIPSAN is set, podIP is included as
+// an IP SAN, allowing clients to connect to istiod directly by pod IP.
+func getDNSNames(hostname, customHost, namespace, podIP string) []string {
+	// append custom hostname if there is any
+	names := []string{hostname}
+	if customHost != "" && customHost != hostname {
+		log.Infof("Adding custom hostname %s", customHost)
+		names = append(names, customHost)
+	}
+
+	// The first is the recommended one, also used by Apiserver for webhooks.
+	// add a few known hostnames
+	for _, altName := range []string{"istiod", "istiod-remote", "istio-pilot"} {
+		name := fmt.Sprintf("%v.%v.svc", altName, namespace)
+		if name == hostname || name == customHost {
+			continue
+		}
+		names = append(names, name)
+	}
+
+	if features.IncludePodIPSAN {
+		if net.ParseIP(podIP) != nil {
+			log.Infof("Adding pod IP %s", podIP)
+			names = append(names, podIP)
+		} else {
+			log.Warnf("pod IP SAN enabled, but pod IP %q is not a valid IP", podIP)
+		}
+	}
+	return names
 }
 
 // TODO(hzxuzonghu): support async notification instead of polling the CA root cert.
@@ -204,7 +329,7 @@ func (s *Server) watchRootCertAndGenKeyCert(names []string, stop <-chan struct{}
 
 // initCertificateWatches sets up watches for the plugin dns certs.
 func (s *Server) initCertificateWatches(tlsOptions TLSOptions) error {
-	if err := s.istiodCertBundleWatcher.SetFromFilesAndNotify(tlsOptions.KeyFile, tlsOptions.CertFile, tlsOptions.CaCertFile); err != nil {
+	if err := s.setIstiodCertBundleFromFiles(tlsOptions); err != nil {
 		return fmt.Errorf("set keyCertBundle failed: %v", err)
 	}
 	// TODO: Setup watcher for root and restart server if it changes.
@@ -221,17 +346,14 @@ func (s *Server) initCertificateWatches(tlsOptions TLSOptions) error {
 				select {
 				case <-keyCertTimerC:
 					keyCertTimerC = nil
-					if err := s.istiodCertBundleWatcher.SetFromFilesAndNotify(tlsOptions.KeyFile, tlsOptions.CertFile, tlsOptions.CaCertFile); err != nil {
+					if err := s.setIstiodCertBundleFromFiles(tlsOptions); err != nil {
 						log.Errorf("Setting keyCertBundle failed: %v", err)
 					}
+				// Each event restarts the debounce, so files updated together are reloaded once they settle.
 				case <-s.fileWatcher.Events(tlsOptions.CertFile):
-					if keyCertTimerC == nil {
-						keyCertTimerC = time.After(watchDebounceDelay)
-					}
+					keyCertTimerC = time.After(features.CertReloadDebounce)
 				case <-s.fileWatcher.Events(tlsOptions.KeyFile):
-					if keyCertTimerC == nil {
-						keyCertTimerC = time.After(watchDebounceDelay)
-					}
+					keyCertTimerC = time.After(features.CertReloadDebounce)
 				case err := <-s.fileWatcher.Errors(tlsOptions.CertFile):
 					log.Errorf("error watching %v: %v", tlsOptions.CertFile, err)
 				case err := <-s.fileWatcher.Errors(tlsOptions.KeyFile):
@@ -246,6 +368,121 @@ func (s *Server) initCertificateWatches(tlsOptions TLSOptions) error {
 	return nil
 }
 
+// setIstiodCertBundleFromFiles loads the plugin dns certs and CA bundle from files, and notifies the watchers.
+// Malformed PEM blocks in the CA bundle are handled per StrictCABundleParsing. If TrimExpiredRoots is enabled,
+// expired roots are dropped from the CA bundle.
+func (s *Server) setIstiodCertBundleFromFiles(tlsOptions TLSOptions) error {
+	cert, err := ioutil.ReadFile(tlsOptions.CertFile)
+	if err != nil {
+		return err
+	}
+	key, err := ioutil.ReadFile(tlsOptions.KeyFile)
+	if err != nil {
+		return err
+	}
+	caBundle, err := ioutil.ReadFile(tlsOptions.CaCertFile)
+	if err != nil {
+		return err
+	}
+	caBundle, err = parseCABundle(caBundle, features.StrictCABundleParsing)
+	if err != nil {
+		return fmt.Errorf("invalid CA bundle %v: %v", tlsOptions.CaCertFile, err)
+	}
+	if features.TrimExpiredRoots {
+		caBundle = trimExpiredRoots(caBundle, time.Now())
+	}
+	s.istiodCertBundleWatcher.SetAndNotify(key, cert, caBundle)
+	return nil
+}
+
+var pemBegin = []byte("-----BEGIN ")
+
+// parseCABundle checks the PEM blocks of the bundle. A block is malformed if it cannot be decoded, or is a
+// certificate that cannot be parsed. If strict, a malformed block is an error. Otherwise, malformed blocks are
+// dropped with a warning, and an error is only returned if no valid certificate remains. If there are no
+// malformed blocks, the bundle is returned unchanged.
+func parseCABundle(bundle []byte, strict bool) ([]byte, error) {
+	var parsed []byte
+	malformed, roots := 0, 0
+	rest := bundle
+	for index := 0; ; index++ {
+		start := bytes.Index(rest, pemBegin)
+		if start < 0 {
+			break
+		}
+		rest = rest[start:]
+		// pem.Decode silently skips a block it cannot decode, so decode each block up to the next one on its own.
+		end := len(rest)
+		if next := bytes.Index(rest[len(pemBegin):], pemBegin); next >= 0 {
+			end = next + len(pemBegin)
+		}
+		block, _ := pem.Decode(rest[:end])
+		rest = rest[end:]
+
+		var reason string
+		if block == nil {
+			reason = "cannot decode PEM"
+		} else if block.Type == "CERTIFICATE" {
+			if _, err := x509.ParseCertificate(block.Bytes); err != nil {
+				reason = err.Error()
+			} else {
+				roots++
+			}
+		}
+		if reason == "" {
+			parsed = append(parsed, pem.EncodeToMemory(block)...)
+			continue
+		}
+		if strict {
+			return nil, fmt.Errorf("malformed PEM block %d: %v", index, reason)
+		}
+		log.Warnf("skipping malformed PEM block %d in the CA bundle: %v", index, reason)
+		malformed++
+	}
+	if malformed == 0 {
+		return bundle, nil
+	}
+	if roots == 0 {
+		return nil, fmt.Errorf("no valid certificate, %d malformed PEM blocks", malformed)
+	}
+	return parsed, nil
+}
+
+// trimExpiredRoots drops the certificates in the PEM encoded bundle that have expired at now. Other PEM
+// blocks are kept as is. If no valid certificate would remain, the bundle is returned unchanged.
+func trimExpiredRoots(bundle []byte, now time.Time) []byte {
+	var trimmed []byte
+	var dropped []string
+	valid := 0
+	rest := bundle
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type == "CERTIFICATE" {
+			if cert, err := x509.ParseCertificate(block.Bytes); err == nil {
+				if now.After(cert.NotAfter) {
+					dropped = append(dropped, fmt.Sprintf("%q (expired %v)", cert.Subject, cert.NotAfter.Format(time.RFC3339)))
+					continue
+				}
+				valid++
+			}
+		}
+		trimmed = append(trimmed, pem.EncodeToMemory(block)...)
+	}
+	if len(dropped) == 0 {
+		return bundle
+	}
+	if valid == 0 {
+		log.Warnf("all roots in the CA bundle have expired, keeping the bundle unchanged")
+		return bundle
+	}
+	log.Infof("dropped %d expired roots from the CA bundle: %v", len(dropped), strings.Join(dropped, ", "))
+	return trimmed
+}
+
 func (s *Server) reloadIstiodCert(watchCh <-chan keycertbundle.KeyCertBundle, stopCh <-chan struct{}) {
 	for {
 		select {
@@ -271,6 +508,13 @@ func (s *Server) loadIstiodCert(watchCh <-chan keycertbundle.KeyCertBundle, stop
 	if err != nil {
 		return fmt.Errorf("istiod loading x509 key pairs failed: %v", err)
 	}
+	leaf, err := x509.ParseCertificate(keyPair.Certificate[0])
+	if err != nil {
+		return fmt.Errorf("istiod cert - ParseCertificate() error: %v", err)
+	}
+	if err := checkCertValidity(leaf, time.Now(), features.CertClockSkewAllowance); err != nil {
+		return fmt.Errorf("istiod cert is not valid: %v", err)
+	}
 	for _, c := range keyPair.Certificate {
 		x509Cert, err := x509.ParseCertificates(c)
 		if err != nil {
@@ -288,5 +532,8 @@ func (s *Server) loadIstiodCert(watchCh <-chan keycertbundle.KeyCertBundle, stop
 	s.certMu.Lock()
 	s.istiodCert = &keyPair
 	s.certMu.Unlock()
+	if s.ocspStapler != nil {
+		s.ocspStapler.certChanged()
+	}
 	return nil
 }
@@ -0,0 +1,87 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bootstrap
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"time"
+
+	"istio.io/pkg/log"
+)
+
+// certRotateResponse is the response of the /debug/cert/rotate endpoint.
+type certRotateResponse struct {
+	// SerialNumber is the hex encoded serial number of the new Istiod DNS cert.
+	SerialNumber string `json:"serialNumber"`
+	// NotAfter is the expiration time of the new Istiod DNS cert.
+	NotAfter time.Time `json:"notAfter"`
+}
+
+// certRotateHandler re-issues the Istiod DNS cert on demand, using the provider that issued it at startup.
+// Requests are serialized, so concurrent calls each leave a valid cert in place.
+func (s *Server) certRotateHandler(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if s.rotateDNSCert == nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte("the istiod DNS cert is not issued by istiod, and cannot be rotated"))
+		return
+	}
+
+	s.rotateDNSCertMu.Lock()
+	defer s.rotateDNSCertMu.Unlock()
+	if err := s.rotateDNSCert(); err != nil {
+		log.Errorf("failed to rotate istiod DNS cert: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte(err.Error()))
+		return
+	}
+	cert, err := parseLeafCert(s.istiodCertBundleWatcher.GetKeyCertBundle().CertPem)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte(err.Error()))
+		return
+	}
+	log.Infof("rotated istiod DNS cert, new serial number %x", cert.SerialNumber)
+
+	b, err := json.MarshalIndent(certRotateResponse{
+		SerialNumber: fmt.Sprintf("%x", cert.SerialNumber),
+		NotAfter:     cert.NotAfter,
+	}, "", "  ")
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte(err.Error()))
+		return
+	}
+	w.Header().Add("Content-Type", "application/json")
+	if _, err := w.Write(b); err != nil {
+		log.Warnf("failed to write cert rotation response: %v", err)
+	}
+}
+
+// parseLeafCert parses the first certificate of a PEM encoded chain.
+func parseLeafCert(chain []byte) (*x509.Certificate, error) {
+	block, _ := pem.Decode(chain)
+	if block == nil {
+		return nil, fmt.Errorf("invalid istiod DNS cert")
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
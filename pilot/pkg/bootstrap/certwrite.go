@@ -0,0 +1,56 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bootstrap
+
+import (
+	"io/ioutil"
+	"os"
+	"time"
+
+	"istio.io/istio/pilot/pkg/features"
+	"istio.io/pkg/log"
+	"istio.io/pkg/monitoring"
+)
+
+// writeCertFile writes cert files, and may be overridden in tests.
+var writeCertFile = ioutil.WriteFile
+
+var certWriteFailures = monitoring.NewSum(
+	"pilot_cert_write_failures",
+	"Total number of failed attempts to write a certificate or key to the file system, including retried attempts.",
+)
+
+func init() {
+	monitoring.MustRegister(certWriteFailures)
+}
+
+// persistCertFile writes a certificate or key to filename. As disk errors may be transient, failures are retried
+// up to features.CertWriteRetries times, with exponential backoff, so a write is not lost to a transient error.
+func persistCertFile(filename string, data []byte, perm os.FileMode) error {
+	backoff := features.CertWriteRetryBackoff
+	for attempt := 0; ; attempt++ {
+		err := writeCertFile(filename, data, perm)
+		if err == nil {
+			return nil
+		}
+		certWriteFailures.Increment()
+		if attempt >= features.CertWriteRetries {
+			return err
+		}
+		log.Warnf("failed writing %s, retrying in %v: %v", filename, backoff, err)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
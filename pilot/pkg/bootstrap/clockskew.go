@@ -0,0 +1,46 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bootstrap
+
+import (
+	"crypto/x509"
+	"fmt"
+	"time"
+
+	"istio.io/pkg/log"
+)
+
+// checkCertValidity returns an error if cert is not valid at now, tolerating a clock skew of up to allowance. If
+// allowance is 0, the validity window is not enforced, and a certificate outside of it only logs a warning.
+func checkCertValidity(cert *x509.Certificate, now time.Time, allowance time.Duration) error {
+	if allowance <= 0 {
+		if now.Before(cert.NotBefore) || now.After(cert.NotAfter) {
+			log.Warnf("certificate %q is only valid from %v to %v", cert.Subject, cert.NotBefore.Format(time.RFC3339),
+				cert.NotAfter.Format(time.RFC3339))
+		}
+		return nil
+	}
+	if now.Add(allowance).Before(cert.NotBefore) {
+		return fmt.Errorf("certificate %q is not valid before %v", cert.Subject, cert.NotBefore.Format(time.RFC3339))
+	}
+	if now.Add(-allowance).After(cert.NotAfter) {
+		return fmt.Errorf("certificate %q expired at %v", cert.Subject, cert.NotAfter.Format(time.RFC3339))
+	}
+	if now.Before(cert.NotBefore) || now.After(cert.NotAfter) {
+		log.Warnf("certificate %q is only valid from %v to %v, accepted within the allowed clock skew of %v",
+			cert.Subject, cert.NotBefore.Format(time.RFC3339), cert.NotAfter.Format(time.RFC3339), allowance)
+	}
+	return nil
+}
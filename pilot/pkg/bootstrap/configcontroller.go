@@ -36,6 +36,7 @@ import (
 	"istio.io/istio/pilot/pkg/model"
 	"istio.io/istio/pilot/pkg/status"
 	"istio.io/istio/pkg/adsc"
+	"istio.io/istio/pkg/config"
 	"istio.io/istio/pkg/config/schema/collections"
 	"istio.io/pkg/log"
 )
@@ -70,7 +71,8 @@ func (s *Server) initConfigController(args *PilotArgs) error {
 		store := memory.Make(collections.Pilot)
 		configController := memory.NewController(store)
 
-		err := s.makeFileMonitor(args.RegistryOptions.FileDir, args.RegistryOptions.KubeOptions.DomainSuffix, configController)
+		err := s.makeFileMonitor(args.RegistryOptions.FileDir, args.RegistryOptions.KubeOptions.DomainSuffix,
+			args.RegistryOptions.SeedConfigs, configController)
 		if err != nil {
 			return err
 		}
@@ -192,7 +194,7 @@ func (s *Server) initConfigSources(args *PilotArgs) (err error) {
 			store := memory.Make(collections.Pilot)
 			configController := memory.NewController(store)
 
-			err := s.makeFileMonitor(srcAddress.Path, args.RegistryOptions.KubeOptions.DomainSuffix, configController)
+			err := s.makeFileMonitor(srcAddress.Path, args.RegistryOptions.KubeOptions.DomainSuffix, nil, configController)
 			if err != nil {
 				return err
 			}
@@ -322,9 +324,11 @@ func (s *Server) makeKubeConfigController(args *PilotArgs) (model.ConfigStoreCac
 	return c, nil
 }
 
-func (s *Server) makeFileMonitor(fileDir string, domainSuffix string, configController model.ConfigStore) error {
+func (s *Server) makeFileMonitor(fileDir string, domainSuffix string, seed []config.Config, configController model.ConfigStore) error {
 	fileSnapshot := configmonitor.NewFileSnapshot(fileDir, collections.Pilot, domainSuffix)
-	fileMonitor := configmonitor.NewMonitor("file-monitor", configController, fileSnapshot.ReadConfigFiles, fileDir)
+	fileMonitor := configmonitor.NewMonitor("file-monitor", configController,
+		configmonitor.SeededSnapshot(configmonitor.LimitedSnapshot(fileSnapshot.ReadConfigFiles, features.MaxFileRegistryResources), seed),
+		fileDir)
 
 	// Defer starting the file monitor until after the service is created.
 	s.addStartFunc(func(stop <-chan struct{}) error {
@@ -0,0 +1,137 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bootstrap
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"istio.io/istio/pilot/pkg/features"
+	"istio.io/pkg/log"
+)
+
+// crlChecker rejects client certificates revoked by the CRLs in a file. The file is reloaded when it changes.
+// The CRLs are trusted as configured; their signatures are not verified.
+type crlChecker struct {
+	file string
+
+	mu sync.RWMutex
+	// revoked holds the serial numbers of revoked certificates, keyed by the DER encoded issuer name.
+	revoked map[string]map[string]struct{}
+}
+
+// initCRLChecker loads the CRLs in file, and reloads them when the file changes.
+func (s *Server) initCRLChecker(file string) (*crlChecker, error) {
+	c := &crlChecker{file: file}
+	if err := c.load(); err != nil {
+		return nil, err
+	}
+	log.Infof("adding watcher for CRL %s", file)
+	if err := s.fileWatcher.Add(file); err != nil {
+		return nil, fmt.Errorf("could not watch %v: %v", file, err)
+	}
+	s.addStartFunc(func(stop <-chan struct{}) error {
+		go func() {
+			var reloadC <-chan time.Time
+			for {
+				select {
+				case <-reloadC:
+					reloadC = nil
+					if err := c.load(); err != nil {
+						log.Errorf("reloading CRL %v failed, keeping the previous CRL: %v", file, err)
+					}
+				case <-s.fileWatcher.Events(file):
+					reloadC = time.After(features.CertReloadDebounce)
+				case err := <-s.fileWatcher.Errors(file):
+					log.Errorf("error watching %v: %v", file, err)
+				case <-stop:
+					return
+				}
+			}
+		}()
+		return nil
+	})
+	return c, nil
+}
+
+// load parses the file, which holds either PEM encoded CRLs or a single DER encoded CRL.
+func (c *crlChecker) load() error {
+	data, err := ioutil.ReadFile(c.file)
+	if err != nil {
+		return err
+	}
+	var ders [][]byte
+	for rest := data; ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type == "X509 CRL" {
+			ders = append(ders, block.Bytes)
+		}
+	}
+	if len(ders) == 0 {
+		ders = [][]byte{data}
+	}
+	revoked := map[string]map[string]struct{}{}
+	for _, der := range ders {
+		crl, err := x509.ParseDERCRL(der)
+		if err != nil {
+			return fmt.Errorf("failed to parse CRL: %v", err)
+		}
+		if crl.HasExpired(time.Now()) {
+			log.Warnf("CRL of %v in %v has expired, it should be renewed", crl.TBSCertList.Issuer, c.file)
+		}
+		issuer, err := asn1.Marshal(crl.TBSCertList.Issuer)
+		if err != nil {
+			return fmt.Errorf("failed to encode CRL issuer: %v", err)
+		}
+		serials := revoked[string(issuer)]
+		if serials == nil {
+			serials = map[string]struct{}{}
+			revoked[string(issuer)] = serials
+		}
+		for _, rc := range crl.TBSCertList.RevokedCertificates {
+			serials[rc.SerialNumber.String()] = struct{}{}
+		}
+	}
+	c.mu.Lock()
+	c.revoked = revoked
+	c.mu.Unlock()
+	return nil
+}
+
+// verify returns an error if the client certificate has been revoked.
+func (c *crlChecker) verify(rawCerts [][]byte) error {
+	if len(rawCerts) == 0 {
+		return nil
+	}
+	cert, err := x509.ParseCertificate(rawCerts[0])
+	if err != nil {
+		return fmt.Errorf("failed to parse client certificate: %v", err)
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if _, f := c.revoked[string(cert.RawIssuer)][cert.SerialNumber.String()]; f {
+		return fmt.Errorf("client certificate with serial number %v has been revoked", cert.SerialNumber)
+	}
+	return nil
+}
@@ -0,0 +1,209 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bootstrap
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"istio.io/pkg/filewatcher"
+	"istio.io/pkg/log"
+)
+
+// pollingFileWatcher wraps a FileWatcher, additionally polling each watched file at a fixed interval.
+// A synthetic write event is emitted whenever the modification time, size or content of a file changes.
+// This guarantees changes are detected on filesystems that do not reliably deliver file events.
+type pollingFileWatcher struct {
+	inner    filewatcher.FileWatcher
+	interval time.Duration
+
+	mu      sync.Mutex
+	watches map[string]*polledFile
+}
+
+type polledFile struct {
+	events chan fsnotify.Event
+	errors chan error
+	stop   chan struct{}
+}
+
+// fileState is the observed state of a polled file.
+type fileState struct {
+	modTime time.Time
+	size    int64
+	hash    [sha256.Size]byte
+}
+
+var _ filewatcher.FileWatcher = &pollingFileWatcher{}
+
+// newFileWatcher returns the file watcher used by the server. If interval is set, file events are
+// complemented by polling.
+func newFileWatcher(interval time.Duration) filewatcher.FileWatcher {
+	if interval <= 0 {
+		return filewatcher.NewWatcher()
+	}
+	return newPollingFileWatcher(filewatcher.NewWatcher(), interval)
+}
+
+func newPollingFileWatcher(inner filewatcher.FileWatcher, interval time.Duration) *pollingFileWatcher {
+	return &pollingFileWatcher{
+		inner:    inner,
+		interval: interval,
+		watches:  map[string]*polledFile{},
+	}
+}
+
+func (w *pollingFileWatcher) Add(path string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, f := w.watches[path]; f {
+		return fmt.Errorf("path %v is already watched", path)
+	}
+	if err := w.inner.Add(path); err != nil {
+		return err
+	}
+	pf := &polledFile{
+		events: make(chan fsnotify.Event, 1),
+		errors: make(chan error, 1),
+		stop:   make(chan struct{}),
+	}
+	w.watches[path] = pf
+	// Read the initial state synchronously, so changes made right after Add are detected.
+	initial, _ := readFileState(path)
+	go w.forward(pf, w.inner.Events(path), w.inner.Errors(path))
+	go w.poll(path, pf, initial)
+	return nil
+}
+
+func (w *pollingFileWatcher) Remove(path string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	pf, f := w.watches[path]
+	if !f {
+		return fmt.Errorf("path %v is not watched", path)
+	}
+	close(pf.stop)
+	delete(w.watches, path)
+	return w.inner.Remove(path)
+}
+
+func (w *pollingFileWatcher) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for path, pf := range w.watches {
+		close(pf.stop)
+		delete(w.watches, path)
+	}
+	return w.inner.Close()
+}
+
+func (w *pollingFileWatcher) Events(path string) chan fsnotify.Event {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if pf, f := w.watches[path]; f {
+		return pf.events
+	}
+	return nil
+}
+
+func (w *pollingFileWatcher) Errors(path string) chan error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if pf, f := w.watches[path]; f {
+		return pf.errors
+	}
+	return nil
+}
+
+// forward relays events and errors from the inner watcher.
+func (w *pollingFileWatcher) forward(pf *polledFile, events chan fsnotify.Event, errors chan error) {
+	for {
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				events = nil
+				continue
+			}
+			pf.notify(ev)
+		case err, ok := <-errors:
+			if !ok {
+				errors = nil
+				continue
+			}
+			select {
+			case pf.errors <- err:
+			case <-pf.stop:
+				return
+			}
+		case <-pf.stop:
+			return
+		}
+	}
+}
+
+// poll periodically checks the file, emitting a write event when it changes.
+func (w *pollingFileWatcher) poll(path string, pf *polledFile, last *fileState) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			cur, err := readFileState(path)
+			if err != nil {
+				// The file may be mid-rotation; it will be picked up on a later poll.
+				log.Debugf("failed to poll %v: %v", path, err)
+				continue
+			}
+			if last == nil || *cur != *last {
+				log.Infof("detected change of %v by polling", path)
+				pf.notify(fsnotify.Event{Name: path, Op: fsnotify.Write})
+			}
+			last = cur
+		case <-pf.stop:
+			return
+		}
+	}
+}
+
+// notify emits an event without blocking. Consumers only care that a change happened, so if an event
+// is already pending there is no need to queue another.
+func (pf *polledFile) notify(ev fsnotify.Event) {
+	select {
+	case pf.events <- ev:
+	default:
+	}
+}
+
+func readFileState(path string) (*fileState, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return &fileState{
+		modTime: info.ModTime(),
+		size:    info.Size(),
+		hash:    sha256.Sum256(b),
+	}, nil
+}
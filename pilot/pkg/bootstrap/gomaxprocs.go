@@ -0,0 +1,100 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bootstrap
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"istio.io/pkg/log"
+)
+
+// cgroupRoot is where the cgroup filesystem of istiod is mounted. In a container, it is the cgroup of the container.
+const cgroupRoot = "/sys/fs/cgroup"
+
+// cgroupCPUQuota returns the CPU quota of the cgroup mounted at root, in CPUs. Both cgroup v2 and the v1 cpu
+// controller are supported. It returns false if the cgroup has no quota.
+func cgroupCPUQuota(root string) (float64, bool, error) {
+	if b, err := ioutil.ReadFile(filepath.Join(root, "cpu.max")); err == nil {
+		// cgroup v2: "<quota> <period>", where quota is "max" if unlimited.
+		fields := strings.Fields(string(b))
+		if len(fields) != 2 {
+			return 0, false, fmt.Errorf("invalid cpu.max %q", b)
+		}
+		if fields[0] == "max" {
+			return 0, false, nil
+		}
+		return cpuQuota(fields[0], fields[1])
+	}
+	quota, err := ioutil.ReadFile(filepath.Join(root, "cpu", "cpu.cfs_quota_us"))
+	if os.IsNotExist(err) {
+		return 0, false, nil
+	} else if err != nil {
+		return 0, false, err
+	}
+	period, err := ioutil.ReadFile(filepath.Join(root, "cpu", "cpu.cfs_period_us"))
+	if err != nil {
+		return 0, false, err
+	}
+	// cgroup v1: a quota of -1 is unlimited.
+	if strings.TrimSpace(string(quota)) == "-1" {
+		return 0, false, nil
+	}
+	return cpuQuota(strings.TrimSpace(string(quota)), strings.TrimSpace(string(period)))
+}
+
+func cpuQuota(quota, period string) (float64, bool, error) {
+	q, err := strconv.ParseFloat(quota, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("invalid CPU quota %q: %v", quota, err)
+	}
+	p, err := strconv.ParseFloat(period, 64)
+	if err != nil || p <= 0 {
+		return 0, false, fmt.Errorf("invalid CPU period %q", period)
+	}
+	return q / p, true, nil
+}
+
+// tuneGOMAXPROCS lowers GOMAXPROCS to the CPU quota returned by quota, rounded down, and at least 1. It is left
+// unchanged if the GOMAXPROCS environment variable is set, or there is no quota, or the quota is not below the
+// current GOMAXPROCS. It returns the resulting GOMAXPROCS.
+func tuneGOMAXPROCS(quota func() (float64, bool, error)) int {
+	if v, f := os.LookupEnv("GOMAXPROCS"); f {
+		log.Infof("GOMAXPROCS is set to %v by the environment, not tuning it", v)
+		return runtime.GOMAXPROCS(0)
+	}
+	cpus, f, err := quota()
+	if err != nil {
+		log.Warnf("failed to read the CPU quota, not tuning GOMAXPROCS: %v", err)
+		return runtime.GOMAXPROCS(0)
+	}
+	if !f {
+		return runtime.GOMAXPROCS(0)
+	}
+	procs := int(math.Max(1, math.Floor(cpus)))
+	previous := runtime.GOMAXPROCS(0)
+	if procs >= previous {
+		return previous
+	}
+	runtime.GOMAXPROCS(procs)
+	log.Infof("set GOMAXPROCS to %d from the CPU quota of %v, was %d", procs, cpus, previous)
+	return procs
+}
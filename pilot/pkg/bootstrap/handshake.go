@@ -0,0 +1,46 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bootstrap
+
+import (
+	"net"
+	"time"
+)
+
+// handshakeTimeoutListener sets a read deadline on accepted connections, so clients stalling the TLS handshake
+// are closed. The HTTP server clears the deadline once it starts reading the first request, after the handshake.
+type handshakeTimeoutListener struct {
+	net.Listener
+	timeout time.Duration
+}
+
+func newHandshakeTimeoutListener(l net.Listener, timeout time.Duration) net.Listener {
+	if timeout <= 0 {
+		return l
+	}
+	return &handshakeTimeoutListener{Listener: l, timeout: timeout}
+}
+
+func (l *handshakeTimeoutListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	if err := c.SetReadDeadline(time.Now().Add(l.timeout)); err != nil {
+		_ = c.Close()
+		return nil, err
+	}
+	return c, nil
+}
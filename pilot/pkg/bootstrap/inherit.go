@@ -0,0 +1,100 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bootstrap
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"istio.io/pkg/log"
+)
+
+// inheritedListenersEnv is the environment variable passing the inherited listeners to a new process.
+const inheritedListenersEnv = "PILOT_INHERITED_LISTENERS"
+
+// listenOrInherit returns the listener for name inherited from the parent process, per the listener name to fd
+// mapping fds, or binds addr if it is not inherited.
+func listenOrInherit(name, addr string, fds map[string]int) (net.Listener, error) {
+	fd, f := fds[name]
+	if !f {
+		return net.Listen("tcp", addr)
+	}
+	file := os.NewFile(uintptr(fd), name)
+	if file == nil {
+		return nil, fmt.Errorf("invalid fd %d inherited for the %s listener", fd, name)
+	}
+	// FileListener duplicates the fd, so the inherited one is not needed anymore.
+	defer file.Close()
+	l, err := net.FileListener(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to inherit fd %d for the %s listener: %v", fd, name, err)
+	}
+	log.Infof("inherited the %s listener at %v from fd %d", name, l.Addr(), fd)
+	return l, nil
+}
+
+// recordBoundListener records a started listener, so it can be handed off.
+func (s *Server) recordBoundListener(name string, l net.Listener) {
+	s.listenersMu.Lock()
+	defer s.listenersMu.Unlock()
+	if s.boundListeners == nil {
+		s.boundListeners = map[string]net.Listener{}
+	}
+	s.boundListeners[name] = l
+}
+
+// HandoffCommand returns a command running the istiod binary at path with args, which inherits the listening
+// sockets of the server instead of binding them. As the sockets are shared, the server can be stopped once the
+// new process serves without dropping connections. The caller closes the ExtraFiles of the command once it is
+// started.
+func (s *Server) HandoffCommand(path string, args ...string) (*exec.Cmd, error) {
+	s.listenersMu.RLock()
+	defer s.listenersMu.RUnlock()
+	if len(s.boundListeners) == 0 {
+		return nil, fmt.Errorf("no listeners are bound")
+	}
+	names := make([]string, 0, len(s.boundListeners))
+	for name := range s.boundListeners {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	cmd := exec.Command(path, args...)
+	var fds []string
+	for _, name := range names {
+		tl, ok := s.boundListeners[name].(*net.TCPListener)
+		if !ok {
+			return nil, fmt.Errorf("the %s listener cannot be handed off", name)
+		}
+		file, err := tl.File()
+		if err != nil {
+			for _, f := range cmd.ExtraFiles {
+				_ = f.Close()
+			}
+			return nil, fmt.Errorf("failed to get the fd of the %s listener: %v", name, err)
+		}
+		// The ExtraFiles are fds 3 and up in the new process.
+		fds = append(fds, fmt.Sprintf("%s=%d", name, 3+len(cmd.ExtraFiles)))
+		cmd.ExtraFiles = append(cmd.ExtraFiles, file)
+	}
+	cmd.Env = append(os.Environ(), inheritedListenersEnv+"="+strings.Join(fds, ","))
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd, nil
+}
@@ -25,6 +25,7 @@ import (
 	"strings"
 	"time"
 
+	"go.uber.org/atomic"
 	"google.golang.org/grpc"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -32,6 +33,7 @@ import (
 
 	"istio.io/api/security/v1beta1"
 	"istio.io/istio/pilot/pkg/features"
+	"istio.io/istio/pilot/pkg/leaderelection"
 	securityModel "istio.io/istio/pilot/pkg/security/model"
 	"istio.io/istio/pkg/config/constants"
 	"istio.io/istio/pkg/jwt"
@@ -256,7 +258,7 @@ func (s *Server) loadRemoteCACerts(caOpts *caOptions, dir string) error {
 	}
 	for key, data := range secret.Data {
 		filename := path.Join(dir, key)
-		if err := ioutil.WriteFile(filename, data, 0600); err != nil {
+		if err := persistCertFile(filename, data, 0600); err != nil {
 			return err
 		}
 	}
@@ -328,6 +330,15 @@ func (s *Server) createIstioCA(client corev1.CoreV1Interface, opts *caOptions) (
 	}
 	// TODO: provide an endpoint returning all the roots. SDS can only pull a single root in current impl.
 	// ca.go saves or uses the secret, but also writes to the configmap "istio-security", under caTLSRootCert
+	// The root cert rotator updates the shared CA secret, so only rotates on one instance. Every instance still
+	// runs it, to reload root certs rotated by the others.
+	rotating := atomic.NewBool(false)
+	istioCA.SetRootCertRotationGate(rotating.Load)
+	s.addSingletonStartFunc(leaderelection.RootCertRotatorController, func(stop <-chan struct{}) {
+		rotating.Store(true)
+		<-stop
+		rotating.Store(false)
+	})
 	// rootCertRotatorChan channel accepts signals to stop root cert rotator for
 	// self-signed CA.
 	rootCertRotatorChan := make(chan struct{})
@@ -16,15 +16,19 @@ package bootstrap
 
 import (
 	"context"
+	"errors"
 	"io/ioutil"
 	"os"
 	"path"
 	"testing"
+	"time"
 
 	. "github.com/onsi/gomega"
+	"go.opencensus.io/stats/view"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
+	"istio.io/istio/pilot/pkg/features"
 	"istio.io/istio/pkg/kube"
 	"istio.io/istio/pkg/test/env"
 	"istio.io/istio/security/pkg/pki/ca"
@@ -70,6 +74,43 @@ func TestRemoteCerts(t *testing.T) {
 	g.Expect(err).NotTo(BeNil())
 }
 
+func TestRemoteCertsWriteRetry(t *testing.T) {
+	g := NewWithT(t)
+	originalWrite, originalBackoff := writeCertFile, features.CertWriteRetryBackoff
+	t.Cleanup(func() {
+		writeCertFile, features.CertWriteRetryBackoff = originalWrite, originalBackoff
+	})
+	features.CertWriteRetryBackoff = time.Millisecond
+	// The first write fails transiently
+	failures := 1
+	writeCertFile = func(filename string, data []byte, perm os.FileMode) error {
+		if failures > 0 {
+			failures--
+			return errors.New("transient disk error")
+		}
+		return ioutil.WriteFile(filename, data, perm)
+	}
+
+	dir := t.TempDir()
+	s := Server{
+		kubeClient: kube.NewFakeClient(),
+	}
+	g.Expect(createCASecret(s.kubeClient)).Should(Succeed())
+	g.Expect(s.loadRemoteCACerts(&caOptions{Namespace: namespace}, dir)).Should(Succeed())
+
+	// All certs are eventually persisted
+	for _, name := range []string{ca.CACertFile, ca.CAPrivateKeyFile, ca.CertChainFile, ca.RootCertFile} {
+		expected, err := readSampleCertFromFile(name)
+		g.Expect(err).Should(BeNil())
+		g.Expect(ioutil.ReadFile(path.Join(dir, name))).Should(Equal(expected))
+	}
+
+	data, err := view.RetrieveData("pilot_cert_write_failures")
+	g.Expect(err).Should(BeNil())
+	g.Expect(data).ShouldNot(BeEmpty())
+	g.Expect(data[0].Data.(*view.SumData).Value).Should(BeNumerically(">=", 1))
+}
+
 func removeSilent(dir string) {
 	_ = os.RemoveAll(dir)
 }
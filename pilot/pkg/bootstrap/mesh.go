@@ -15,9 +15,13 @@
 package bootstrap
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"net/http"
 	"os"
 
+	meshconfig "istio.io/api/mesh/v1alpha1"
 	"istio.io/istio/pilot/pkg/features"
 	"istio.io/istio/pkg/config/mesh"
 	"istio.io/istio/pkg/config/mesh/kubemesh"
@@ -33,6 +37,8 @@ const (
 	defaultMeshConfigMapName = "istio"
 	// configMapKey should match the expected MeshConfig file name
 	configMapKey = "mesh"
+	// meshConfigHashPath serves the hash of the effective mesh config.
+	meshConfigHashPath = "/debug/meshconfig/hash"
 )
 
 // initMeshConfiguration creates the mesh in the pilotConfig from the input arguments.
@@ -128,3 +134,38 @@ func getMeshConfigMapName(revision string) string {
 	}
 	return name + "-" + revision
 }
+
+// meshConfigHash returns a stable hash of the mesh config. It is computed over the JSON encoding, in which
+// fields and map keys are ordered.
+func meshConfigHash(mc *meshconfig.MeshConfig) (string, error) {
+	js, err := gogoprotomarshal.ToJSON(mc)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(js))
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// meshConfigHashHandler serves the hash of the effective mesh config, so replicas can be compared for drift.
+func (s *Server) meshConfigHashHandler(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	hash, err := meshConfigHash(s.environment.Mesh())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte(err.Error()))
+		return
+	}
+	b, err := json.Marshal(map[string]string{"hash": hash})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte(err.Error()))
+		return
+	}
+	w.Header().Add("Content-Type", "application/json")
+	if _, err := w.Write(b); err != nil {
+		log.Warnf("failed to write mesh config hash: %v", err)
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bootstrap
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"istio.io/pkg/log"
+)
+
+const meshStatePath = "/api/v1/meshstate"
+
+// meshState is the response of the mesh state API.
+type meshState struct {
+	Services []meshStateService `json:"services"`
+}
+
+// meshStateService is a service as seen by one registry. A service present in multiple registries is listed once
+// for each of them.
+type meshStateService struct {
+	Hostname  string `json:"hostname"`
+	Namespace string `json:"namespace"`
+	// Registry is the provider of the registry the service comes from, e.g. Kubernetes or External.
+	Registry string `json:"registry"`
+	// Cluster is the cluster of the registry the service comes from.
+	Cluster   string              `json:"cluster"`
+	Ports     []meshStatePort     `json:"ports"`
+	Endpoints []meshStateEndpoint `json:"endpoints"`
+}
+
+type meshStatePort struct {
+	Name     string `json:"name"`
+	Port     int    `json:"port"`
+	Protocol string `json:"protocol"`
+}
+
+type meshStateEndpoint struct {
+	Address        string            `json:"address"`
+	Port           uint32            `json:"port"`
+	PortName       string            `json:"portName"`
+	Labels         map[string]string `json:"labels,omitempty"`
+	ServiceAccount string            `json:"serviceAccount,omitempty"`
+	Network        string            `json:"network,omitempty"`
+	Locality       string            `json:"locality,omitempty"`
+}
+
+// buildMeshState returns the services and endpoints of all registries. If namespace is set, only its services are
+// included.
+func (s *Server) buildMeshState(namespace string) meshState {
+	state := meshState{Services: []meshStateService{}}
+	for _, registry := range s.ServiceController().GetRegistries() {
+		services, err := registry.Services()
+		if err != nil {
+			log.Warnf("failed to list services of registry %v/%v: %v", registry.Provider(), registry.Cluster(), err)
+			continue
+		}
+		for _, svc := range services {
+			if namespace != "" && svc.Attributes.Namespace != namespace {
+				continue
+			}
+			out := meshStateService{
+				Hostname:  string(svc.Hostname),
+				Namespace: svc.Attributes.Namespace,
+				Registry:  string(registry.Provider()),
+				Cluster:   registry.Cluster(),
+				Ports:     []meshStatePort{},
+				Endpoints: []meshStateEndpoint{},
+			}
+			for _, port := range svc.Ports {
+				out.Ports = append(out.Ports, meshStatePort{Name: port.Name, Port: port.Port, Protocol: string(port.Protocol)})
+				for _, instance := range registry.InstancesByPort(svc, port.Port, nil) {
+					ep := instance.Endpoint
+					out.Endpoints = append(out.Endpoints, meshStateEndpoint{
+						Address:        ep.Address,
+						Port:           ep.EndpointPort,
+						PortName:       port.Name,
+						Labels:         ep.Labels,
+						ServiceAccount: ep.ServiceAccount,
+						Network:        ep.Network,
+						Locality:       ep.Locality.Label,
+					})
+				}
+			}
+			state.Services = append(state.Services, out)
+		}
+	}
+	sort.SliceStable(state.Services, func(i, j int) bool {
+		return state.Services[i].Hostname < state.Services[j].Hostname
+	})
+	return state
+}
+
+// meshStateHandler serves the services and endpoints of the registries, and the registry each comes from, as JSON.
+// The services can be restricted to a namespace with the namespace query parameter.
+func (s *Server) meshStateHandler(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	b, err := json.MarshalIndent(s.buildMeshState(req.URL.Query().Get("namespace")), "", "  ")
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte(err.Error()))
+		return
+	}
+	w.Header().Add("Content-Type", "application/json")
+	if _, err := w.Write(b); err != nil {
+		log.Warnf("failed to write mesh state: %v", err)
+	}
+}
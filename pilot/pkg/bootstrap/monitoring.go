@@ -18,11 +18,16 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"sort"
+	"strings"
+	"sync"
 
 	ocprom "contrib.go.opencensus.io/exporter/prometheus"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.opencensus.io/stats/view"
 
+	"istio.io/istio/pilot/pkg/features"
 	"istio.io/pkg/log"
 	"istio.io/pkg/version"
 )
@@ -36,13 +41,51 @@ const (
 	versionPath = "/version"
 )
 
-func addMonitor(mux *http.ServeMux) error {
-	exporter, err := ocprom.NewExporter(ocprom.Options{Registry: prometheus.DefaultRegisterer.(*prometheus.Registry)})
+var (
+	exportersMu sync.Mutex
+	// exporters holds the prometheus exporters created, keyed by their constant labels. Views are process wide, so
+	// monitors with the same labels share an exporter; a second exporter would duplicate every metric.
+	exporters = map[string]*ocprom.Exporter{}
+)
+
+// getExporter returns the prometheus exporter for constLabels, creating and registering it if needed.
+func getExporter(constLabels map[string]string) (*ocprom.Exporter, error) {
+	keys := make([]string, 0, len(constLabels))
+	for k, v := range constLabels {
+		keys = append(keys, k+"="+v)
+	}
+	sort.Strings(keys)
+	key := strings.Join(keys, ",")
+
+	exportersMu.Lock()
+	defer exportersMu.Unlock()
+	if exporter, f := exporters[key]; f {
+		return exporter, nil
+	}
+	exporter, err := ocprom.NewExporter(ocprom.Options{
+		Registry:    prometheus.DefaultRegisterer.(*prometheus.Registry),
+		ConstLabels: constLabels,
+	})
 	if err != nil {
-		return fmt.Errorf("could not set up prometheus exporter: %v", err)
+		return nil, err
 	}
 	view.RegisterExporter(exporter)
-	mux.Handle(metricsPath, exporter)
+	exporters[key] = exporter
+	return exporter, nil
+}
+
+// addMonitor adds the metrics and version handlers to mux. constLabels are added to all exported metrics.
+func addMonitor(mux *http.ServeMux, constLabels map[string]string) error {
+	exporter, err := getExporter(constLabels)
+	if err != nil {
+		return fmt.Errorf("could not set up prometheus exporter: %v", err)
+	}
+	if features.PushLatencyExemplars {
+		// Exemplars are only exposed in the OpenMetrics format, which the exporter does not negotiate.
+		mux.Handle(metricsPath, promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{EnableOpenMetrics: true}))
+	} else {
+		mux.Handle(metricsPath, exporter)
+	}
 
 	mux.HandleFunc(versionPath, func(out http.ResponseWriter, req *http.Request) {
 		if _, err := out.Write([]byte(version.Info.String())); err != nil {
@@ -55,7 +98,7 @@ func addMonitor(mux *http.ServeMux) error {
 
 // Deprecated: we shouldn't have 2 http ports. Will be removed after code using
 // this port is removed.
-func startMonitor(addr string, mux *http.ServeMux) (*monitor, error) {
+func startMonitor(addr string, mux *http.ServeMux, constLabels map[string]string) (*monitor, error) {
 	m := &monitor{}
 
 	// get the network stuff setup
@@ -63,7 +106,12 @@ func startMonitor(addr string, mux *http.ServeMux) (*monitor, error) {
 	if addr != "" {
 		var err error
 		if listener, err = net.Listen("tcp", addr); err != nil {
-			return nil, fmt.Errorf("unable to listen on socket: %v", err)
+			if !features.MonitoringBindOptional {
+				return nil, fmt.Errorf("unable to listen on socket: %v", err)
+			}
+			// Metrics are not critical, continue serving config without them.
+			log.Warnf("unable to listen on monitoring address %s, starting without the monitoring server: %v", addr, err)
+			addr = ""
 		}
 	}
 
@@ -71,7 +119,7 @@ func startMonitor(addr string, mux *http.ServeMux) (*monitor, error) {
 	// for pilot. a full design / implementation of self-monitoring and reporting
 	// is coming. that design will include proper coverage of statusz/healthz type
 	// functionality, in addition to how pilot reports its own metrics.
-	if err := addMonitor(mux); err != nil {
+	if err := addMonitor(mux, constLabels); err != nil {
 		return nil, fmt.Errorf("could not establish self-monitoring: %v", err)
 	}
 	if addr != "" {
@@ -98,10 +146,11 @@ func (m *monitor) Close() error {
 	return nil
 }
 
-// initMonitor initializes the configuration for the pilot monitoring server.
-func (s *Server) initMonitor(addr string) error { // nolint: unparam
+// initMonitor initializes the configuration for the pilot monitoring server. Metrics are labeled with the identity
+// of the instance, so they can be attributed when multiple instances and revisions run.
+func (s *Server) initMonitor(addr string, identity InstanceIdentity) error { // nolint: unparam
 	s.addStartFunc(func(stop <-chan struct{}) error {
-		monitor, err := startMonitor(addr, s.monitoringMux)
+		monitor, err := startMonitor(addr, s.monitoringMux, identity.labels())
 		if err != nil {
 			return err
 		}
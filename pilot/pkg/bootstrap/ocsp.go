@@ -0,0 +1,191 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bootstrap
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+
+	"istio.io/pkg/log"
+)
+
+const (
+	// ocspRetryInterval is the delay before retrying a failed OCSP fetch.
+	ocspRetryInterval = time.Minute
+	// ocspDefaultRefresh is the refresh interval for OCSP responses without a next update time.
+	ocspDefaultRefresh = time.Hour
+	// maxOCSPResponseBytes bounds the size of an OCSP response.
+	maxOCSPResponseBytes = 1024 * 1024
+)
+
+// ocspStapler fetches OCSP responses for the istiod certificate from its OCSP responder, to staple them to the
+// TLS handshakes. Responses are refreshed halfway through their validity, and when the certificate changes.
+type ocspStapler struct {
+	getCert  func() *tls.Certificate
+	caBundle func() []byte
+	client   *http.Client
+	changed  chan struct{}
+
+	mu sync.RWMutex
+	// leaf is the DER encoded certificate the staple is for.
+	leaf   []byte
+	staple []byte
+}
+
+// initOCSPStapling staples OCSP responses to the istiod certificate, if enabled.
+func (s *Server) initOCSPStapling(tlsOptions TLSOptions) {
+	if !tlsOptions.EnableOCSPStapling {
+		return
+	}
+	s.ocspStapler = &ocspStapler{
+		getCert: func() *tls.Certificate {
+			s.certMu.RLock()
+			defer s.certMu.RUnlock()
+			return s.istiodCert
+		},
+		caBundle: s.istiodCertBundleWatcher.GetCABundle,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		changed:  make(chan struct{}, 1),
+	}
+	s.addStartFunc(func(stop <-chan struct{}) error {
+		go s.ocspStapler.run(stop)
+		return nil
+	})
+}
+
+// stapled returns cert with the OCSP staple attached, if one was fetched for it.
+func (o *ocspStapler) stapled(cert *tls.Certificate) *tls.Certificate {
+	if len(cert.Certificate) == 0 {
+		return cert
+	}
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	if o.staple == nil || !bytes.Equal(o.leaf, cert.Certificate[0]) {
+		return cert
+	}
+	c := *cert
+	c.OCSPStaple = o.staple
+	return &c
+}
+
+// certChanged triggers a fetch for the new certificate.
+func (o *ocspStapler) certChanged() {
+	select {
+	case o.changed <- struct{}{}:
+	default:
+	}
+}
+
+func (o *ocspStapler) run(stop <-chan struct{}) {
+	refreshC := time.After(0)
+	for {
+		select {
+		case <-refreshC:
+		case <-o.changed:
+		case <-stop:
+			return
+		}
+		next, err := o.refresh(time.Now())
+		if err != nil {
+			log.Warnf("failed to fetch OCSP response for the istiod certificate: %v", err)
+			next = ocspRetryInterval
+		}
+		refreshC = time.After(next)
+	}
+}
+
+// refresh fetches an OCSP response for the current certificate, returning the delay until the next refresh.
+func (o *ocspStapler) refresh(now time.Time) (time.Duration, error) {
+	cert := o.getCert()
+	if cert == nil || len(cert.Certificate) == 0 {
+		return 0, fmt.Errorf("no certificate loaded")
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return 0, err
+	}
+	if len(leaf.OCSPServer) == 0 {
+		return 0, fmt.Errorf("certificate has no OCSP responder")
+	}
+	issuer, err := o.issuer(cert, leaf)
+	if err != nil {
+		return 0, err
+	}
+	req, err := ocsp.CreateRequest(leaf, issuer, nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := o.client.Post(leaf.OCSPServer[0], "application/ocsp-request", bytes.NewReader(req))
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("OCSP responder %v returned status %d", leaf.OCSPServer[0], resp.StatusCode)
+	}
+	raw, err := ioutil.ReadAll(http.MaxBytesReader(nil, resp.Body, maxOCSPResponseBytes))
+	if err != nil {
+		return 0, err
+	}
+	parsed, err := ocsp.ParseResponseForCert(raw, leaf, issuer)
+	if err != nil {
+		return 0, fmt.Errorf("invalid OCSP response: %v", err)
+	}
+	if parsed.Status != ocsp.Good {
+		log.Warnf("OCSP responder reports the istiod certificate %v as not good: status %d", leaf.SerialNumber, parsed.Status)
+	}
+
+	o.mu.Lock()
+	o.leaf = cert.Certificate[0]
+	o.staple = raw
+	o.mu.Unlock()
+
+	if parsed.NextUpdate.IsZero() {
+		return ocspDefaultRefresh, nil
+	}
+	next := parsed.ThisUpdate.Add(parsed.NextUpdate.Sub(parsed.ThisUpdate) / 2).Sub(now)
+	if next < ocspRetryInterval {
+		next = ocspRetryInterval
+	}
+	return next, nil
+}
+
+// issuer returns the certificate that issued leaf, from the certificate chain or the CA bundle.
+func (o *ocspStapler) issuer(cert *tls.Certificate, leaf *x509.Certificate) (*x509.Certificate, error) {
+	if len(cert.Certificate) > 1 {
+		return x509.ParseCertificate(cert.Certificate[1])
+	}
+	for rest := o.caBundle(); ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		ca, err := x509.ParseCertificate(block.Bytes)
+		if err == nil && bytes.Equal(ca.RawSubject, leaf.RawIssuer) {
+			return ca, nil
+		}
+	}
+	return nil, fmt.Errorf("issuer of the certificate not found")
+}
@@ -17,10 +17,14 @@ package bootstrap
 import (
 	"crypto/tls"
 	"fmt"
+	"net"
+	"strings"
 	"time"
 
 	"istio.io/istio/pilot/pkg/features"
 	kubecontroller "istio.io/istio/pilot/pkg/serviceregistry/kube/controller"
+	"istio.io/istio/pilot/pkg/xds"
+	"istio.io/istio/pkg/config"
 	"istio.io/istio/pkg/config/constants"
 	"istio.io/istio/pkg/keepalive"
 	"istio.io/pkg/ctrlz"
@@ -33,6 +37,8 @@ import (
 type RegistryOptions struct {
 	// If FileDir is set, the below kubernetes options are ignored
 	FileDir string
+	// SeedConfigs, if set, are served in place of the FileDir config until FileDir has content.
+	SeedConfigs []config.Config
 
 	Registries []string
 
@@ -54,6 +60,7 @@ type PilotArgs struct {
 	ServerOptions      DiscoveryServerOptions
 	InjectionOptions   InjectionOptions
 	PodName            string
+	PodIP              string
 	Namespace          string
 	Revision           string
 	MeshConfigFile     string
@@ -63,7 +70,54 @@ type PilotArgs struct {
 	Plugins            []string
 	KeepaliveOptions   *keepalive.Options
 	ShutdownDuration   time.Duration
-	JwtRule            string
+	// LeaderElection, if set, runs singleton loops, such as the self-signed root cert rotation, the webhook cert
+	// controller and the validating webhook patching, only on the instance holding their leader election lease.
+	// All instances still serve XDS.
+	LeaderElection bool
+	// RegistryShutdownTimeout bounds how long shutdown waits for the service registries to stop. If unset,
+	// ShutdownDuration is used.
+	RegistryShutdownTimeout time.Duration
+	// GOAWAYGrace, if set, closes XDS streams this long after GOAWAY is sent on shutdown. It defaults to
+	// PILOT_GOAWAY_GRACE.
+	GOAWAYGrace time.Duration
+	JwtRule     string
+	// DropPrivileges, if set, is called by Start once all listeners are bound and before any connection is
+	// accepted. This allows an embedder starting istiod as root, to bind privileged ports, to switch to an
+	// unprivileged user before serving. If it returns an error, Start fails.
+	DropPrivileges func() error `json:"-"`
+	// PushEventSink, if set, receives the statistics of each push as structured events, for example to
+	// export them to a message bus. It takes precedence over PushEventsKafkaURL.
+	PushEventSink xds.PushEventSink `json:"-"`
+	// PushEventsKafkaURL, if set, is the URL of a topic on a Kafka REST proxy push events are published to.
+	PushEventsKafkaURL string
+}
+
+// InstanceIdentity identifies an istiod instance when multiple instances and revisions run in a cluster.
+type InstanceIdentity struct {
+	// Revision is the control plane revision of the instance, or "default" if unset.
+	Revision string `json:"revision"`
+	// PodName is the name of the istiod pod.
+	PodName string `json:"podName"`
+}
+
+// labels returns the identity as constant labels for metrics.
+func (i InstanceIdentity) labels() map[string]string {
+	return map[string]string{
+		"revision": i.Revision,
+		"pod":      i.PodName,
+	}
+}
+
+// InstanceIdentity returns the identity of this istiod instance.
+func (p *PilotArgs) InstanceIdentity() InstanceIdentity {
+	revision := p.Revision
+	if revision == "" {
+		revision = "default"
+	}
+	return InstanceIdentity{
+		Revision: revision,
+		PodName:  p.PodName,
+	}
 }
 
 // DiscoveryServerOptions contains options for create a new discovery server instance.
@@ -95,6 +149,15 @@ type DiscoveryServerOptions struct {
 	// The listening address for secured gRPC. If the port in the address is empty or "0" (as in "127.0.0.1:" or "[::1]:0")
 	// a port number is automatically chosen.
 	SecureGRPCAddr string
+
+	// StreamWriteBufferSize is the size in bytes of the write buffer of each gRPC connection. If 0, the gRPC default is used.
+	StreamWriteBufferSize int
+	// StreamReadBufferSize is the size in bytes of the read buffer of each gRPC connection. If 0, the gRPC default is used.
+	StreamReadBufferSize int
+
+	// AdditionalADSServiceNames are gRPC service names the ADS service is registered under, in addition to the
+	// standard envoy.service.discovery.v3.AggregatedDiscoveryService.
+	AdditionalADSServiceNames []string
 }
 
 type InjectionOptions struct {
@@ -109,11 +172,35 @@ type TLSOptions struct {
 	KeyFile         string
 	TLSCipherSuites []string
 	CipherSuits     []uint16 // This is the parsed cipher suites
+	// MaxClientCertAge, if set, rejects client certificates issued longer ago than this, even if they are
+	// still valid.
+	MaxClientCertAge time.Duration
+	// HandshakeTimeout is the time allowed for clients to complete the TLS handshake on the secure listeners
+	// before the connection is closed. If 0, handshakes are not bounded.
+	HandshakeTimeout time.Duration
+	// CRLFile, if set, is a file of CRLs used to reject revoked client certificates on the secure gRPC server.
+	// The file is reloaded when it changes.
+	CRLFile string
+	// EnableOCSPStapling, if set, fetches OCSP responses for the istiod certificate from its OCSP responder, and
+	// staples them to the TLS handshakes.
+	EnableOCSPStapling bool
+	// SCTList are files of signed certificate timestamps, each in the binary format of RFC 6962, served with the
+	// istiod certificate as Certificate Transparency proofs.
+	SCTList []string
+	// ValidationCertProvider, if set, is the provider of a certificate for the HTTPS webhook server, instead of the
+	// istiod certificate. It is one of "kubernetes", using the Kubernetes CSR API, or "file", using
+	// ValidationCertFile, ValidationKeyFile and ValidationCaCertFile. Webhook configurations are patched with the
+	// CA bundle of this certificate.
+	ValidationCertProvider string
+	ValidationCertFile     string
+	ValidationKeyFile      string
+	ValidationCaCertFile   string
 }
 
 var (
 	PodNamespaceVar = env.RegisterStringVar("POD_NAMESPACE", constants.IstioSystemNamespace, "")
 	podNameVar      = env.RegisterStringVar("POD_NAME", "", "")
+	podIPVar        = env.RegisterStringVar("POD_IP", "", "The IP of the istiod pod, typically set from status.podIP.")
 	jwtRuleVar      = env.RegisterStringVar("JWT_RULE", "",
 		"The JWT rule used by istiod authentication")
 )
@@ -148,11 +235,13 @@ func NewPilotArgs(initFuncs ...func(*PilotArgs)) *PilotArgs {
 func (p *PilotArgs) applyDefaults() {
 	p.Namespace = PodNamespaceVar.Get()
 	p.PodName = podNameVar.Get()
+	p.PodIP = podIPVar.Get()
 	p.Revision = RevisionVar.Get()
 	p.JwtRule = jwtRuleVar.Get()
 	p.KeepaliveOptions = keepalive.DefaultOption()
 	p.RegistryOptions.DistributionTrackingEnabled = features.EnableDistributionTracking
 	p.RegistryOptions.DistributionCacheRetention = features.DistributionHistoryRetention
+	p.GOAWAYGrace = features.GOAWAYGrace
 }
 
 func (p *PilotArgs) Complete() error {
@@ -191,3 +280,52 @@ func TLSCipherSuites(cipherNames []string) ([]uint16, error) {
 	}
 	return ciphersIntSlice, nil
 }
+
+// checkAddressConflicts returns an error if two listeners are configured with overlapping addresses, as the second
+// bind would fail. Disabled listeners and dynamically chosen ports are ignored.
+func (o DiscoveryServerOptions) checkAddressConflicts() error {
+	type listener struct {
+		name, addr, host, port string
+	}
+	var listeners []listener
+	for _, l := range []listener{
+		{name: "HTTPAddr", addr: o.HTTPAddr},
+		{name: "HTTPSAddr", addr: o.HTTPSAddr},
+		{name: "GRPCAddr", addr: o.GRPCAddr},
+		{name: "SecureGRPCAddr", addr: o.SecureGRPCAddr},
+		{name: "MonitoringAddr", addr: o.MonitoringAddr},
+	} {
+		if l.addr == "" {
+			continue
+		}
+		host, port, err := net.SplitHostPort(l.addr)
+		if err != nil || port == "" || port == "0" {
+			// Invalid addresses are reported when binding.
+			continue
+		}
+		l.host, l.port = host, port
+		for _, other := range listeners {
+			if other.port == l.port && hostsOverlap(other.host, l.host) {
+				return fmt.Errorf("%s %q conflicts with %s %q: both listen on port %s", l.name, l.addr, other.name,
+					other.addr, l.port)
+			}
+		}
+		listeners = append(listeners, l)
+	}
+	return nil
+}
+
+// hostsOverlap returns true if listening on a and b may bind the same address.
+func hostsOverlap(a, b string) bool {
+	isWildcard := func(h string) bool {
+		ip := net.ParseIP(h)
+		return h == "" || ip != nil && ip.IsUnspecified()
+	}
+	if isWildcard(a) || isWildcard(b) {
+		return true
+	}
+	if ipA, ipB := net.ParseIP(a), net.ParseIP(b); ipA != nil && ipB != nil {
+		return ipA.Equal(ipB)
+	}
+	return strings.EqualFold(a, b)
+}
@@ -0,0 +1,111 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bootstrap
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"istio.io/istio/pilot/pkg/features"
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/pkg/log"
+)
+
+// prewarmDNSConcurrency is the maximum number of concurrent lookups when prewarming DNS.
+const prewarmDNSConcurrency = 16
+
+// hostResolver resolves hostnames. It is implemented by net.Resolver.
+type hostResolver interface {
+	LookupHost(ctx context.Context, host string) ([]string, error)
+}
+
+// prewarmDNS resolves the hostnames of all DNS resolved services known to the registry, if PrewarmDNS is enabled.
+func (s *Server) prewarmDNS(stop <-chan struct{}) {
+	if !features.PrewarmDNS {
+		return
+	}
+	services, err := s.environment.Services()
+	if err != nil {
+		log.Warnf("failed to list services to prewarm DNS: %v", err)
+		return
+	}
+	prewarmDNS(net.DefaultResolver, dnsHostnames(services), features.PrewarmDNSTimeout, stop)
+}
+
+// dnsHostnames returns the unique hostnames of the services resolved by DNS.
+func dnsHostnames(services []*model.Service) []string {
+	seen := map[string]struct{}{}
+	hosts := make([]string, 0)
+	for _, svc := range services {
+		if svc.Resolution != model.DNSLB || svc.Hostname.IsWildCarded() {
+			continue
+		}
+		h := string(svc.Hostname)
+		if _, f := seen[h]; f {
+			continue
+		}
+		seen[h] = struct{}{}
+		hosts = append(hosts, h)
+	}
+	return hosts
+}
+
+// prewarmDNS resolves hosts, so they are cached by the resolver before proxies connect. Lookups are abandoned
+// once timeout has passed or stop is closed. Failures are only logged.
+func prewarmDNS(resolver hostResolver, hosts []string, timeout time.Duration, stop <-chan struct{}) {
+	if len(hosts) == 0 {
+		return
+	}
+	t0 := time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	sem := make(chan struct{}, prewarmDNSConcurrency)
+	wg := sync.WaitGroup{}
+	for _, h := range hosts {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func(host string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			if _, err := resolver.LookupHost(ctx, host); err != nil {
+				log.Debugf("failed to prewarm DNS for %s: %v", host, err)
+			}
+		}(h)
+	}
+	wg.Wait()
+	if ctx.Err() != nil {
+		log.Warnf("prewarming DNS for %d hosts did not complete: %v", len(hosts), ctx.Err())
+		return
+	}
+	log.Infof("prewarmed DNS for %d hosts in %v", len(hosts), time.Since(t0))
+}
@@ -0,0 +1,140 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bootstrap
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"istio.io/istio/pilot/pkg/features"
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/pkg/log"
+	"istio.io/pkg/monitoring"
+)
+
+// registryHealthCheckInterval is the interval at which registry connectivity is checked.
+const registryHealthCheckInterval = 5 * time.Second
+
+var registryDegraded = monitoring.NewGauge(
+	"pilot_registry_degraded",
+	"Set to 1 if istiod lost connectivity to its registry for longer than the configured threshold, "+
+		"and is serving potentially stale config.",
+)
+
+func init() {
+	monitoring.MustRegister(registryDegraded)
+}
+
+// registryHealth tracks connectivity to the registry after the initial sync. Once connectivity has been
+// lost for longer than the threshold, istiod is considered degraded: it keeps serving its last known
+// config, but flags this on the readiness endpoint and the pilot_registry_degraded metric.
+type registryHealth struct {
+	check     func() error
+	threshold time.Duration
+	// onRecovered, if set, is called when connectivity is restored after being degraded.
+	onRecovered func()
+
+	mu          sync.Mutex
+	lastHealthy time.Time
+	lastErr     error
+	degraded    bool
+}
+
+func newRegistryHealth(check func() error, threshold time.Duration) *registryHealth {
+	return &registryHealth{
+		check:       check,
+		threshold:   threshold,
+		lastHealthy: time.Now(),
+	}
+}
+
+// probe checks registry connectivity, updating the degraded state.
+func (h *registryHealth) probe(now time.Time) {
+	err := h.check()
+	recovered := false
+	defer func() {
+		if recovered && h.onRecovered != nil {
+			h.onRecovered()
+		}
+	}()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lastErr = err
+	if err == nil {
+		h.lastHealthy = now
+		if h.degraded {
+			log.Infof("registry connectivity restored")
+			recovered = true
+		}
+		h.degraded = false
+	} else if !h.degraded && now.Sub(h.lastHealthy) > h.threshold {
+		log.Warnf("registry unreachable for %v, serving potentially stale config: %v", now.Sub(h.lastHealthy).Round(time.Second), err)
+		h.degraded = true
+	}
+	if h.degraded {
+		registryDegraded.Record(1)
+	} else {
+		registryDegraded.Record(0)
+	}
+}
+
+// degradedReason returns a description of why istiod is degraded, or an empty string if it is not.
+func (h *registryHealth) degradedReason() string {
+	if h == nil {
+		return ""
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.degraded {
+		return ""
+	}
+	return fmt.Sprintf("registry unreachable since %v: %v", h.lastHealthy.Format(time.RFC3339), h.lastErr)
+}
+
+func (h *registryHealth) run(stop <-chan struct{}) {
+	ticker := time.NewTicker(registryHealthCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			h.probe(now)
+		case <-stop:
+			return
+		}
+	}
+}
+
+// initRegistryHealth sets up tracking of Kubernetes registry connectivity, if DegradeOnRegistryLoss is enabled.
+func (s *Server) initRegistryHealth() {
+	if !features.DegradeOnRegistryLoss || s.kubeClient == nil {
+		return
+	}
+	s.registryHealth = newRegistryHealth(func() error {
+		_, err := s.kubeClient.Kube().Discovery().ServerVersion()
+		return err
+	}, features.RegistryLossThreshold)
+	s.XDSServer.Degraded = func() bool {
+		return s.registryHealth.degradedReason() != ""
+	}
+	s.registryHealth.onRecovered = func() {
+		// Pushes may have been frozen while degraded, so bring all proxies up to date.
+		s.XDSServer.ConfigUpdate(&model.PushRequest{Full: true, Reason: []model.TriggerReason{model.GlobalUpdate}})
+	}
+	s.addStartFunc(func(stop <-chan struct{}) error {
+		go s.registryHealth.run(stop)
+		return nil
+	})
+}
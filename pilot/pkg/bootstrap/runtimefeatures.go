@@ -0,0 +1,63 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bootstrap
+
+import (
+	"fmt"
+	"time"
+
+	"istio.io/istio/pilot/pkg/features"
+	"istio.io/pkg/log"
+)
+
+// initRuntimeFeatures loads the runtime feature overrides from file, if set, and reloads them when the file changes.
+func (s *Server) initRuntimeFeatures(file string) error {
+	if file == "" {
+		return nil
+	}
+	if err := features.LoadRuntimeFeatures(file); err != nil {
+		return err
+	}
+	log.Infof("adding watcher for runtime features %s", file)
+	if err := s.fileWatcher.Add(file); err != nil {
+		return fmt.Errorf("could not watch %v: %v", file, err)
+	}
+	s.addStartFunc(func(stop <-chan struct{}) error {
+		go func() {
+			var reloadC <-chan time.Time
+			for {
+				select {
+				case <-reloadC:
+					reloadC = nil
+					if err := features.LoadRuntimeFeatures(file); err != nil {
+						log.Errorf("failed to reload runtime features, keeping previous values: %v", err)
+					} else {
+						log.Infof("reloaded runtime features from %s", file)
+					}
+				case <-s.fileWatcher.Events(file):
+					if reloadC == nil {
+						reloadC = time.After(watchDebounceDelay)
+					}
+				case err := <-s.fileWatcher.Errors(file):
+					log.Errorf("error watching %v: %v", file, err)
+				case <-stop:
+					return
+				}
+			}
+		}()
+		return nil
+	})
+	return nil
+}
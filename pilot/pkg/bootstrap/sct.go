@@ -0,0 +1,51 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bootstrap
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io/ioutil"
+
+	"istio.io/pkg/log"
+)
+
+// initSCTs loads the signed certificate timestamps served with the istiod certificate, if configured.
+func (s *Server) initSCTs(tlsOptions TLSOptions) error {
+	for _, file := range tlsOptions.SCTList {
+		sct, err := ioutil.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("failed to read SCT %s: %v", file, err)
+		}
+		if len(sct) == 0 {
+			return fmt.Errorf("SCT %s is empty", file)
+		}
+		s.scts = append(s.scts, sct)
+	}
+	if len(s.scts) > 0 {
+		log.Infof("serving %d signed certificate timestamps with the istiod certificate", len(s.scts))
+	}
+	return nil
+}
+
+// withSCTs returns cert with the configured signed certificate timestamps.
+func (s *Server) withSCTs(cert *tls.Certificate) *tls.Certificate {
+	if len(s.scts) == 0 {
+		return cert
+	}
+	c := *cert
+	c.SignedCertificateTimestamps = s.scts
+	return &c
+}
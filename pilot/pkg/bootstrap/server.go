@@ -24,13 +24,16 @@ import (
 	"io/ioutil"
 	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"strings"
 	"sync"
 	"time"
 
 	prometheus "github.com/grpc-ecosystem/go-grpc-prometheus"
+	"github.com/hashicorp/go-multierror"
 	prom "github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/atomic"
 	"golang.org/x/net/http2"
 	"golang.org/x/net/http2/h2c"
 	"google.golang.org/grpc"
@@ -126,6 +129,19 @@ type Server struct {
 	httpServer       *http.Server // debug, monitoring and readiness Server.
 	httpsServer      *http.Server // webhooks HTTPS Server.
 	httpsReadyClient *http.Client
+	// rotateDNSCert re-issues the Istiod DNS cert, if it is issued by istiod. rotateDNSCertMu serializes rotations.
+	rotateDNSCert   func() error
+	rotateDNSCertMu sync.Mutex
+	// csrSlots bounds the number of Kubernetes CSRs in flight, see features.MaxInFlightCSRs.
+	csrSlots chan struct{}
+
+	// discoveredAddress is the externally advertised address of istiod, looked up from its Service if
+	// DiscoverSelfAddressFromService is enabled. It is added to the SANs of the DNS cert.
+	discoveredAddress string
+	// istiodCertProvider is the cert provider selected from PILOT_CERT_PROVIDERS, if set.
+	istiodCertProvider string
+	// tlsHandshakeTimeout bounds the TLS handshake of connections to httpsServer.
+	tlsHandshakeTimeout time.Duration
 
 	grpcServer        *grpc.Server
 	grpcAddress       string
@@ -161,15 +177,49 @@ type Server struct {
 	certMu                  sync.RWMutex
 	istiodCert              *tls.Certificate
 	istiodCertBundleWatcher *keycertbundle.Watcher
-	server                  server.Instance
+	// validationCert is the certificate of the HTTPS webhook server, if the webhooks use their own cert provider.
+	validationCert *tls.Certificate
+	// validationCertBundleWatcher holds the certificate of the HTTPS webhook server. It is istiodCertBundleWatcher,
+	// unless the webhooks use their own cert provider.
+	validationCertBundleWatcher *keycertbundle.Watcher
+	server                      server.Instance
 
 	// requiredTerminations keeps track of components that should block server exit
 	// if they are not stopped. This allows important cleanup tasks to be completed.
 	// Note: this is still best effort; a process can die at any time.
 	readinessProbes map[string]readinessProbe
 
+	// registryHealth tracks registry connectivity, if DegradeOnRegistryLoss is enabled.
+	registryHealth *registryHealth
+
+	// draining is set once shutdown starts, failing readiness while liveness stays healthy.
+	draining atomic.Bool
+	// started is set by the first call to Start, so the server cannot be started twice.
+	started atomic.Bool
+
+	// listeners holds the resolved addresses of the started listeners, exposed on /debug/args.
+	listenersMu sync.RWMutex
+	listeners   map[string]string
+	// boundListeners holds the started listeners, so they can be handed off to a new process.
+	boundListeners map[string]net.Listener
+
 	// duration used for graceful shutdown.
 	shutdownDuration time.Duration
+	// registryShutdownTimeout bounds how long shutdown waits for the service registries to stop.
+	registryShutdownTimeout time.Duration
+	// goawayGrace, if set, bounds how long XDS streams are kept after GOAWAY is sent on shutdown.
+	goawayGrace time.Duration
+	// ocspStapler, if set, staples OCSP responses to the istiod certificate.
+	ocspStapler *ocspStapler
+	// scts are the signed certificate timestamps served with the istiod certificate.
+	scts [][]byte
+	// dropPrivileges, if set, is called once all listeners are bound, before serving.
+	dropPrivileges func() error
+
+	// leaderElection gates singleton loops behind a leader election lease held by podName in podNamespace.
+	leaderElection bool
+	podName        string
+	podNamespace   string
 
 	statusReporter *status.Reporter
 	// RWConfigStore is the configstore which allows updates, particularly for status.
@@ -178,6 +228,14 @@ type Server struct {
 
 // NewServer creates a new Server instance based on the provided arguments.
 func NewServer(args *PilotArgs, initFuncs ...func(*Server)) (*Server, error) {
+	if err := args.ServerOptions.checkAddressConflicts(); err != nil {
+		return nil, err
+	}
+	if features.AutoGOMAXPROCS {
+		tuneGOMAXPROCS(func() (float64, bool, error) {
+			return cgroupCPUQuota(cgroupRoot)
+		})
+	}
 	e := &model.Environment{
 		PushContext:  model.NewPushContext(),
 		DomainSuffix: args.RegistryOptions.KubeOptions.DomainSuffix,
@@ -192,22 +250,44 @@ func NewServer(args *PilotArgs, initFuncs ...func(*Server)) (*Server, error) {
 	s := &Server{
 		clusterID:               getClusterID(args),
 		environment:             e,
-		fileWatcher:             filewatcher.NewWatcher(),
+		fileWatcher:             newFileWatcher(features.FileWatchPollInterval),
 		httpMux:                 http.NewServeMux(),
 		monitoringMux:           http.NewServeMux(),
 		readinessProbes:         make(map[string]readinessProbe),
 		workloadTrustBundle:     tb.NewTrustBundle(nil),
 		server:                  server.New(),
 		shutdownDuration:        args.ShutdownDuration,
+		registryShutdownTimeout: args.RegistryShutdownTimeout,
+		goawayGrace:             args.GOAWAYGrace,
+		leaderElection:          args.LeaderElection,
+		podName:                 args.PodName,
+		podNamespace:            args.Namespace,
+		dropPrivileges:          args.DropPrivileges,
 		istiodCertBundleWatcher: keycertbundle.NewWatcher(),
+		csrSlots:                newCSRSlots(features.MaxInFlightCSRs),
+	}
+	if s.registryShutdownTimeout == 0 {
+		s.registryShutdownTimeout = s.shutdownDuration
 	}
 	// Apply custom initialization functions.
 	for _, fn := range initFuncs {
 		fn(s)
 	}
+	// Runtime features must be loaded before they are read by the XDS Server.
+	if err := s.initRuntimeFeatures(features.RuntimeFeaturesFile); err != nil {
+		return nil, fmt.Errorf("error initializing runtime features: %v", err)
+	}
 	// Initialize workload Trust Bundle before XDS Server
 	e.TrustBundle = s.workloadTrustBundle
 	s.XDSServer = xds.NewDiscoveryServer(e, args.Plugins, args.PodName, args.Namespace)
+	if features.PerRevisionCache {
+		s.XDSServer.SetCacheRevision(args.InstanceIdentity().Revision)
+	}
+	if sink := args.PushEventSink; sink != nil {
+		s.XDSServer.SetPushEventSink(sink)
+	} else if args.PushEventsKafkaURL != "" {
+		s.XDSServer.SetPushEventSink(xds.NewKafkaRESTSink(args.PushEventsKafkaURL))
+	}
 
 	// used for both initKubeRegistry and initClusterRegistries
 	if features.EnableEndpointSliceController {
@@ -219,7 +299,7 @@ func NewServer(args *PilotArgs, initFuncs ...func(*Server)) (*Server, error) {
 	prometheus.EnableHandlingTimeHistogram()
 
 	// Apply the arguments to the configuration.
-	if err := s.initKubeClient(args); err != nil {
+	if err := runStartupPhase("kube-client", func() error { return s.initKubeClient(args) }); err != nil {
 		return nil, fmt.Errorf("error initializing kube client: %v", err)
 	}
 
@@ -243,11 +323,11 @@ func NewServer(args *PilotArgs, initFuncs ...func(*Server)) (*Server, error) {
 	}
 
 	// CA signing certificate must be created first if needed.
-	if err := s.maybeCreateCA(caOpts); err != nil {
+	if err := runStartupPhase("ca", func() error { return s.maybeCreateCA(caOpts) }); err != nil {
 		return nil, err
 	}
 
-	if err := s.initControllers(args); err != nil {
+	if err := runStartupPhase("controllers", func() error { return s.initControllers(args) }); err != nil {
 		return nil, err
 	}
 
@@ -261,9 +341,25 @@ func NewServer(args *PilotArgs, initFuncs ...func(*Server)) (*Server, error) {
 	if err != nil {
 		return nil, err
 	}
+	if features.DiscoverSelfAddressFromService && s.kubeClient != nil {
+		s.discoveredAddress, err = s.discoverSelfAddress(string(istiodHost), args.Namespace)
+		if err != nil {
+			log.Warnf("failed to discover istiod address from its service, using the configured address: %v", err)
+		} else {
+			log.Infof("discovered istiod address %v from its service", s.discoveredAddress)
+		}
+	}
 
 	// Create Istiod certs and setup watches.
-	if err := s.initIstiodCerts(args, string(istiodHost)); err != nil {
+	if err := runStartupPhase("istiod-certs", func() error { return s.initIstiodCerts(args, string(istiodHost)) }); err != nil {
+		return nil, err
+	}
+	if err := s.initValidationCerts(args, string(istiodHost)); err != nil {
+		return nil, fmt.Errorf("error initializing validation certificate: %v", err)
+	}
+
+	s.initOCSPStapling(args.ServerOptions.TLSOptions)
+	if err := s.initSCTs(args.ServerOptions.TLSOptions); err != nil {
 		return nil, err
 	}
 
@@ -310,7 +406,12 @@ func NewServer(args *PilotArgs, initFuncs ...func(*Server)) (*Server, error) {
 		&authenticate.ClientCertAuthenticator{},
 	}
 	if args.JwtRule != "" {
-		jwtAuthn, err := initOIDC(args, s.environment.Mesh().TrustDomain)
+		var jwtAuthn security.Authenticator
+		err := runStartupPhase("oidc", func() error {
+			var err error
+			jwtAuthn, err = initOIDC(args, s.environment.Mesh().TrustDomain)
+			return err
+		})
 		if err != nil {
 			return nil, fmt.Errorf("error initializing OIDC: %v", err)
 		}
@@ -347,6 +448,15 @@ func NewServer(args *PilotArgs, initFuncs ...func(*Server)) (*Server, error) {
 	s.addReadinessProbe("discovery", func() (bool, error) {
 		return s.XDSServer.IsServerReady(), nil
 	})
+	if features.ReadinessSettleTime > 0 {
+		s.addReadinessProbe("settle", func() (bool, error) {
+			if s.XDSServer.IsSettling(features.ReadinessSettleTime) {
+				return false, fmt.Errorf("settling after config change")
+			}
+			return true, nil
+		})
+	}
+	s.initRegistryHealth()
 
 	return s, nil
 }
@@ -394,7 +504,11 @@ func isUnexpectedListenerError(err error) bool {
 // Start starts all components of the Pilot discovery service on the port specified in DiscoveryServerOptions.
 // If Port == 0, a port number is automatically chosen. Content serving is started by this method,
 // but is executed asynchronously. Serving can be canceled at any time by closing the provided stop channel.
+// Start may only be called once; later calls return an error.
 func (s *Server) Start(stop <-chan struct{}) error {
+	if !s.started.CAS(false, true) {
+		return fmt.Errorf("istiod server has already been started")
+	}
 	log.Infof("Starting Istiod Server with primary cluster %s", s.clusterID)
 
 	if features.UnsafeFeaturesEnabled() {
@@ -402,41 +516,85 @@ func (s *Server) Start(stop <-chan struct{}) error {
 	}
 
 	// Now start all of the components.
-	if err := s.server.Start(stop); err != nil {
+	if err := runStartupPhase("components", func() error { return s.server.Start(stop) }); err != nil {
 		return err
 	}
+	if stopped(stop) {
+		return errStoppedDuringStart("syncing caches")
+	}
 	if !s.waitForCacheSync(stop) {
+		if stopped(stop) {
+			return errStoppedDuringStart("caches synced")
+		}
 		return fmt.Errorf("failed to sync cache")
 	}
+	s.prewarmDNS(stop)
+	if stopped(stop) {
+		return errStoppedDuringStart("binding listeners")
+	}
 	// Inform Discovery Server so that it can start accepting connections.
 	s.XDSServer.CachesSynced()
 
 	// Race condition - if waitForCache is too fast and we run this as a startup function,
 	// the grpc server would be started before CA is registered. Listening should be last.
+	// All listeners are bound before any of them serves, so privileges can be dropped in between.
+	var listeners []net.Listener
+	var serveFuncs []func()
+	closeListeners := func() {
+		for _, l := range listeners {
+			_ = l.Close()
+		}
+	}
+	listen := func(name, addr string) (net.Listener, error) {
+		if stopped(stop) {
+			closeListeners()
+			return nil, errStoppedDuringStart("binding the " + name + " listener")
+		}
+		var l net.Listener
+		err := runStartupPhase("listener-"+name, func() error {
+			var err error
+			l, err = listenOrInherit(name, addr, features.InheritedListeners)
+			return err
+		})
+		if err != nil {
+			closeListeners()
+			return nil, err
+		}
+		listeners = append(listeners, l)
+		s.recordListener(name, l.Addr())
+		s.recordBoundListener(name, l)
+		return l, nil
+	}
 	if s.secureGrpcAddress != "" {
-		grpcListener, err := net.Listen("tcp", s.secureGrpcAddress)
+		if _, err := s.getIstiodCertificate(nil); err != nil {
+			if features.RequireSecureGRPC {
+				return fmt.Errorf("secure gRPC address %v is configured, but no certificate is available: %v", s.secureGrpcAddress, err)
+			}
+			log.Warnf("starting secure gRPC discovery service without a certificate, TLS handshakes will fail: %v", err)
+		}
+		grpcListener, err := listen("secureGrpc", s.secureGrpcAddress)
 		if err != nil {
 			return err
 		}
-		go func() {
+		serveFuncs = append(serveFuncs, func() {
 			log.Infof("starting secure gRPC discovery service at %s", grpcListener.Addr())
 			if err := s.secureGrpcServer.Serve(grpcListener); err != nil {
 				log.Errorf("error serving secure GRPC server: %v", err)
 			}
-		}()
+		})
 	}
 
 	if s.grpcAddress != "" {
-		grpcListener, err := net.Listen("tcp", s.grpcAddress)
+		grpcListener, err := listen("grpc", s.grpcAddress)
 		if err != nil {
 			return err
 		}
-		go func() {
+		serveFuncs = append(serveFuncs, func() {
 			log.Infof("starting gRPC discovery service at %s", grpcListener.Addr())
 			if err := s.grpcServer.Serve(grpcListener); err != nil {
 				log.Errorf("error serving GRPC server: %v", err)
 			}
-		}()
+		})
 	}
 
 	if s.MultiplexGRPC {
@@ -463,28 +621,43 @@ func (s *Server) Start(stop <-chan struct{}) error {
 	}
 
 	// At this point we are ready - start Http Listener so that it can respond to readiness events.
-	httpListener, err := net.Listen("tcp", s.httpServer.Addr)
+	httpListener, err := listen("http", s.httpServer.Addr)
 	if err != nil {
 		return err
 	}
-	go func() {
+	serveFuncs = append(serveFuncs, func() {
 		log.Infof("starting HTTP service at %s", httpListener.Addr())
 		if err := s.httpServer.Serve(httpListener); isUnexpectedListenerError(err) {
 			log.Errorf("error serving http server: %v", err)
 		}
-	}()
+	})
 
 	if s.httpsServer != nil {
-		httpsListener, err := net.Listen("tcp", s.httpsServer.Addr)
+		httpsListener, err := listen("https", s.httpsServer.Addr)
 		if err != nil {
 			return err
 		}
-		go func() {
+		httpsListener = newHandshakeTimeoutListener(httpsListener, s.tlsHandshakeTimeout)
+		serveFuncs = append(serveFuncs, func() {
 			log.Infof("starting webhook service at %s", httpsListener.Addr())
 			if err := s.httpsServer.ServeTLS(httpsListener, "", ""); isUnexpectedListenerError(err) {
 				log.Errorf("error serving https server: %v", err)
 			}
-		}()
+		})
+	}
+
+	if s.dropPrivileges != nil {
+		if err := s.dropPrivileges(); err != nil {
+			closeListeners()
+			return fmt.Errorf("failed to drop privileges: %v", err)
+		}
+	}
+	if stopped(stop) {
+		closeListeners()
+		return errStoppedDuringStart("serving")
+	}
+	for _, serve := range serveFuncs {
+		go serve()
 	}
 
 	s.waitForShutdown(stop)
@@ -492,6 +665,21 @@ func (s *Server) Start(stop <-chan struct{}) error {
 	return nil
 }
 
+// stopped returns true if stop is closed.
+func stopped(stop <-chan struct{}) bool {
+	select {
+	case <-stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// errStoppedDuringStart is returned by Start if stop is closed before the server is serving.
+func errStoppedDuringStart(phase string) error {
+	return fmt.Errorf("istiod was stopped during startup, before %s", phase)
+}
+
 // WaitUntilCompletion waits for everything marked as a "required termination" to complete.
 // This should be called before exiting.
 func (s *Server) WaitUntilCompletion() {
@@ -578,6 +766,11 @@ func (s *Server) initKubeClient(args *PilotArgs) error {
 // The "http" portion of the readiness check is satisfied by the fact we've started listening on
 // this handler and everything has already initialized.
 func (s *Server) istiodReadyHandler(w http.ResponseWriter, _ *http.Request) {
+	if s.draining.Load() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = w.Write([]byte("draining\n"))
+		return
+	}
 	for name, fn := range s.readinessProbes {
 		if ready, err := fn(); !ready {
 			log.Warnf("%s is not ready: %v", name, err)
@@ -586,6 +779,10 @@ func (s *Server) istiodReadyHandler(w http.ResponseWriter, _ *http.Request) {
 		}
 	}
 	w.WriteHeader(http.StatusOK)
+	// A degraded istiod is still ready, as it keeps serving its last known config.
+	if reason := s.registryHealth.degradedReason(); reason != "" {
+		_, _ = w.Write([]byte("degraded: " + reason + "\n"))
+	}
 }
 
 // initIstiodAdminServer initializes monitoring, debug and readiness end points.
@@ -612,18 +809,64 @@ func (s *Server) initIstiodAdminServer(args *PilotArgs, whc func() map[string]st
 	if !shouldMultiplex {
 		s.XDSServer.AddDebugHandlers(s.httpMux, nil, args.ServerOptions.EnableProfiling, whc)
 	}
+	if features.EnableDebugOnHTTP {
+		if err := s.XDSServer.AddDebugHandler(s.monitoringMux, "/debug/args",
+			"The effective istiod arguments, with sensitive values redacted", s.argsHandler(args)); err != nil {
+			return err
+		}
+		if err := s.XDSServer.AddDebugHandler(s.monitoringMux, "/debug/features",
+			"The effective values of the istiod features, with sensitive values redacted",
+			http.HandlerFunc(featuresHandler)); err != nil {
+			return err
+		}
+		if err := s.XDSServer.AddDebugHandler(s.monitoringMux, "/debug/cert/rotate",
+			"POST to re-issue the istiod DNS cert now", http.HandlerFunc(s.certRotateHandler)); err != nil {
+			return err
+		}
+		if err := s.XDSServer.AddDebugHandler(s.monitoringMux, meshConfigHashPath,
+			"A stable hash of the effective mesh config, to compare across replicas",
+			http.HandlerFunc(s.meshConfigHashHandler)); err != nil {
+			return err
+		}
+	}
+
+	if features.EnableMeshStateAPI {
+		if err := s.XDSServer.AddDebugHandler(s.monitoringMux, meshStatePath,
+			"The services and endpoints of the registries, and the registry each comes from",
+			http.HandlerFunc(s.meshStateHandler)); err != nil {
+			return err
+		}
+	}
 
 	// Monitoring Server.
-	if err := s.initMonitor(args.ServerOptions.MonitoringAddr); err != nil {
+	if err := s.initMonitor(args.ServerOptions.MonitoringAddr, args.InstanceIdentity()); err != nil {
 		return fmt.Errorf("error initializing monitor: %v", err)
 	}
 
 	// Readiness Handler.
 	s.httpMux.HandleFunc("/ready", s.istiodReadyHandler)
+	s.httpMux.HandleFunc("/healthz/ready", s.istiodReadyHandler)
+	// Liveness Handler. Unlike readiness, it stays healthy while draining, until the process exits.
+	s.httpMux.HandleFunc("/healthz/live", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
 
 	return nil
 }
 
+// AddDebugHandler registers an additional debug handler on the monitoring server, alongside istiod's own.
+// It must be called before Start, and returns an error if path collides with an existing handler.
+func (s *Server) AddDebugHandler(path string, h http.Handler) error {
+	// The monitoring handlers are only registered once the server starts.
+	if path == metricsPath || path == versionPath {
+		return fmt.Errorf("handler for %v already registered", path)
+	}
+	if _, pattern := s.monitoringMux.Handler(&http.Request{URL: &url.URL{Path: path}}); pattern == path {
+		return fmt.Errorf("handler for %v already registered", path)
+	}
+	return s.XDSServer.AddDebugHandler(s.monitoringMux, path, "", h)
+}
+
 // initDiscoveryService intializes discovery server on plain text port.
 func (s *Server) initDiscoveryService(args *PilotArgs) {
 	log.Infof("starting discovery service")
@@ -634,7 +877,11 @@ func (s *Server) initDiscoveryService(args *PilotArgs) {
 		return nil
 	})
 
-	s.initGrpcServer(args.KeepaliveOptions)
+	s.initGrpcServer(args.KeepaliveOptions, args.ServerOptions)
+	if features.EnableRESTXDS {
+		log.Info("serving REST XDS on http port ", args.ServerOptions.HTTPAddr)
+		s.XDSServer.AddRESTHandlers(s.httpMux)
+	}
 
 	if args.ServerOptions.GRPCAddr != "" {
 		s.grpcAddress = args.ServerOptions.GRPCAddr
@@ -650,11 +897,26 @@ func (s *Server) initDiscoveryService(args *PilotArgs) {
 func (s *Server) waitForShutdown(stop <-chan struct{}) {
 	go func() {
 		<-stop
+		// Fail readiness first, so traffic is drained before listeners are closed.
+		s.draining.Store(true)
 		s.fileWatcher.Close()
 
 		// Stop gRPC services.  If gRPC services fail to stop in the shutdown duration,
 		// force stop them. This does not happen normally.
 		stopped := make(chan struct{})
+		if s.goawayGrace > 0 {
+			// GracefulStop sends GOAWAY, but waits for the long lived XDS streams to end. Close them once the
+			// grace has passed, so proxies reconnect to another instance after completing in flight exchanges.
+			go func() {
+				t := time.NewTimer(s.goawayGrace)
+				defer t.Stop()
+				select {
+				case <-t.C:
+					s.XDSServer.CloseConnections()
+				case <-stopped:
+				}
+			}()
+		}
 		go func() {
 			// Some grpcServer implementations do not support GracefulStop. Unfortunately, this is not
 			// exposed; they just panic. To avoid this, we will recover and do a standard Stop when its not
@@ -703,17 +965,38 @@ func (s *Server) waitForShutdown(stop <-chan struct{}) {
 	}()
 }
 
-func (s *Server) initGrpcServer(options *istiokeepalive.Options) {
+func (s *Server) initGrpcServer(options *istiokeepalive.Options, serverOptions DiscoveryServerOptions) {
 	interceptors := []grpc.UnaryServerInterceptor{
 		// setup server prometheus monitoring (as final interceptor in chain)
 		prometheus.UnaryServerInterceptor,
 	}
 	grpcOptions := istiogrpc.ServerOptions(options, interceptors...)
+	grpcOptions = append(grpcOptions, streamBufferOptions(serverOptions)...)
 	s.grpcServer = grpc.NewServer(grpcOptions...)
-	s.XDSServer.Register(s.grpcServer)
+	s.registerADS(s.grpcServer, serverOptions)
 	reflection.Register(s.grpcServer)
 }
 
+// registerADS registers the ADS service on the gRPC server, under the standard and any additional service names.
+func (s *Server) registerADS(grpcServer *grpc.Server, options DiscoveryServerOptions) {
+	s.XDSServer.Register(grpcServer)
+	for _, name := range options.AdditionalADSServiceNames {
+		s.XDSServer.RegisterServiceName(grpcServer, name)
+	}
+}
+
+// streamBufferOptions returns the gRPC server options setting the configured connection buffer sizes.
+func streamBufferOptions(options DiscoveryServerOptions) []grpc.ServerOption {
+	var opts []grpc.ServerOption
+	if options.StreamWriteBufferSize > 0 {
+		opts = append(opts, grpc.WriteBufferSize(options.StreamWriteBufferSize))
+	}
+	if options.StreamReadBufferSize > 0 {
+		opts = append(opts, grpc.ReadBufferSize(options.StreamReadBufferSize))
+	}
+	return opts
+}
+
 // initialize secureGRPCServer.
 func (s *Server) initSecureDiscoveryService(args *PilotArgs) error {
 	if args.ServerOptions.SecureGRPCAddr == "" {
@@ -725,26 +1008,26 @@ func (s *Server) initSecureDiscoveryService(args *PilotArgs) error {
 	if err != nil {
 		return err
 	}
+	if err := s.checkIstiodCABundle(); err != nil {
+		return err
+	}
 	if peerCertVerifier == nil {
+		if features.RequireSecureGRPC {
+			return fmt.Errorf("secure gRPC address %v is configured, but no certificates are available",
+				args.ServerOptions.SecureGRPCAddr)
+		}
 		// Running locally without configured certs - no TLS mode
 		log.Warnf("The secure discovery service is disabled")
 		return nil
 	}
-	log.Info("initializing secure discovery service")
-	cfg := &tls.Config{
-		GetCertificate: s.getIstiodCertificate,
-		ClientAuth:     tls.VerifyClientCertIfGiven,
-		ClientCAs:      peerCertVerifier.GetGeneralCertPool(),
-		VerifyPeerCertificate: func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
-			err := peerCertVerifier.VerifyPeerCert(rawCerts, verifiedChains)
-			if err != nil {
-				log.Infof("Could not verify certificate: %v", err)
-			}
-			return err
-		},
-		MinVersion:   tls.VersionTLS12,
-		CipherSuites: args.ServerOptions.TLSOptions.CipherSuits,
+	var crl *crlChecker
+	if file := args.ServerOptions.TLSOptions.CRLFile; file != "" {
+		if crl, err = s.initCRLChecker(file); err != nil {
+			return fmt.Errorf("failed to load CRL: %v", err)
+		}
 	}
+	log.Info("initializing secure discovery service")
+	cfg := s.secureDiscoveryTLSConfig(peerCertVerifier, args.ServerOptions.TLSOptions, crl)
 
 	tlsCreds := credentials.NewTLS(cfg)
 
@@ -754,11 +1037,16 @@ func (s *Server) initSecureDiscoveryService(args *PilotArgs) error {
 		// setup server prometheus monitoring (as final interceptor in chain)
 		prometheus.UnaryServerInterceptor,
 	}
-	opts := istiogrpc.ServerOptions(args.KeepaliveOptions, interceptors...)
+	opts := istiogrpc.ServerOptions(secureKeepaliveOptions(args.KeepaliveOptions), interceptors...)
+	opts = append(opts, streamBufferOptions(args.ServerOptions)...)
 	opts = append(opts, grpc.Creds(tlsCreds))
+	if timeout := args.ServerOptions.TLSOptions.HandshakeTimeout; timeout > 0 {
+		// gRPC bounds the handshake of each connection with its connection timeout.
+		opts = append(opts, grpc.ConnectionTimeout(timeout))
+	}
 
 	s.secureGrpcServer = grpc.NewServer(opts...)
-	s.XDSServer.Register(s.secureGrpcServer)
+	s.registerADS(s.secureGrpcServer, args.ServerOptions)
 	reflection.Register(s.secureGrpcServer)
 
 	s.addStartFunc(func(stop <-chan struct{}) error {
@@ -772,6 +1060,17 @@ func (s *Server) initSecureDiscoveryService(args *PilotArgs) error {
 	return nil
 }
 
+// secureKeepaliveOptions returns the keepalive options of the secure gRPC server. If TLSKeyUpdateInterval is set,
+// connections are not kept open past it, so clients re-handshake and derive fresh session keys.
+func secureKeepaliveOptions(options *istiokeepalive.Options) *istiokeepalive.Options {
+	if features.TLSKeyUpdateInterval <= 0 || features.TLSKeyUpdateInterval >= options.MaxServerConnectionAge {
+		return options
+	}
+	out := *options
+	out.MaxServerConnectionAge = features.TLSKeyUpdateInterval
+	return &out
+}
+
 // addStartFunc appends a function to be run. These are run synchronously in order,
 // so the function should start a go routine if it needs to do anything blocking
 func (s *Server) addStartFunc(fn server.Component) {
@@ -791,6 +1090,32 @@ func (s *Server) addTerminatingStartFunc(fn server.Component) {
 	s.server.RunComponentAsyncAndWait(fn)
 }
 
+// addRegistryTerminatingStartFunc adds a registry function that should terminate before the server shuts down,
+// like addTerminatingStartFunc. Once stop is closed, shutdown waits at most registryShutdownTimeout for it to
+// return, after which the teardown is abandoned so it cannot dominate the shutdown.
+func (s *Server) addRegistryTerminatingStartFunc(fn server.Component) {
+	s.addTerminatingStartFunc(func(stop <-chan struct{}) error {
+		done := make(chan error, 1)
+		go func() {
+			done <- fn(stop)
+		}()
+		select {
+		case err := <-done:
+			return err
+		case <-stop:
+		}
+		t := time.NewTimer(s.registryShutdownTimeout)
+		defer t.Stop()
+		select {
+		case err := <-done:
+			return err
+		case <-t.C:
+			log.Warnf("abandoned registry teardown after %v", s.registryShutdownTimeout)
+			return nil
+		}
+	})
+}
+
 func (s *Server) waitForCacheSync(stop <-chan struct{}) bool {
 	if !cache.WaitForCacheSync(stop, s.cachesSynced) {
 		log.Errorf("Failed waiting for cache sync")
@@ -904,6 +1229,9 @@ func (s *Server) initIstiodCertLoader() error {
 
 // initIstiodCerts creates Istiod certificates and also sets up watches to them.
 func (s *Server) initIstiodCerts(args *PilotArgs, host string) error {
+	if len(features.PilotCertProviders) > 0 {
+		return s.initIstiodCertsFromProviders(args, host, features.PilotCertProviders)
+	}
 	// Skip all certificates
 	var err error
 	if hasCustomTLSCerts(args.ServerOptions.TLSOptions) {
@@ -919,13 +1247,13 @@ func (s *Server) initIstiodCerts(args *PilotArgs, host string) error {
 		return nil
 	} else if s.EnableCA() && features.PilotCertProvider.Get() == constants.CertProviderIstiod {
 		log.Infof("initializing Istiod DNS certificates host: %s, custom host: %s", host, features.IstiodServiceCustomHost.Get())
-		err = s.initDNSCerts(host, features.IstiodServiceCustomHost.Get(), args.Namespace)
+		err = s.initDNSCerts(host, features.IstiodServiceCustomHost.Get(), args.Namespace, args.PodIP, features.PilotCertProvider.Get())
 		if err == nil {
 			err = s.initIstiodCertLoader()
 		}
 	} else if features.PilotCertProvider.Get() == constants.CertProviderKubernetes {
 		log.Infof("initializing Istiod DNS certificates host: %s, custom host: %s", host, features.IstiodServiceCustomHost.Get())
-		err = s.initDNSCerts(host, features.IstiodServiceCustomHost.Get(), args.Namespace)
+		err = s.initDNSCerts(host, features.IstiodServiceCustomHost.Get(), args.Namespace, args.PodIP, features.PilotCertProvider.Get())
 		if err == nil {
 			err = s.initIstiodCertLoader()
 		}
@@ -934,6 +1262,64 @@ func (s *Server) initIstiodCerts(args *PilotArgs, host string) error {
 	return err
 }
 
+// secureDiscoveryTLSConfig returns the TLS config of the secure discovery service. crypto/tls verifies client
+// certificates at the current time, filling the verified chains authenticators rely on, so client certificates
+// are not subject to the clock skew allowance.
+func (s *Server) secureDiscoveryTLSConfig(peerCertVerifier *spiffe.PeerCertVerifier, tlsOpts TLSOptions,
+	crl *crlChecker) *tls.Config {
+	return &tls.Config{
+		GetCertificate: s.getIstiodCertificate,
+		ClientAuth:     tls.VerifyClientCertIfGiven,
+		ClientCAs:      peerCertVerifier.GetGeneralCertPool(),
+		VerifyPeerCertificate: func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+			err := peerCertVerifier.VerifyPeerCert(rawCerts, verifiedChains)
+			if err == nil {
+				err = verifyClientCertAge(rawCerts, tlsOpts.MaxClientCertAge)
+			}
+			if err == nil && crl != nil {
+				err = crl.verify(rawCerts)
+			}
+			if err != nil {
+				log.Infof("Could not verify certificate: %v", err)
+			}
+			return err
+		},
+		MinVersion:   tls.VersionTLS12,
+		CipherSuites: tlsOpts.CipherSuits,
+	}
+}
+
+// verifyClientCertAge rejects a client certificate that was issued more than maxAge ago. A maxAge of 0
+// disables the check.
+func verifyClientCertAge(rawCerts [][]byte, maxAge time.Duration) error {
+	if maxAge <= 0 || len(rawCerts) == 0 {
+		return nil
+	}
+	cert, err := x509.ParseCertificate(rawCerts[0])
+	if err != nil {
+		return fmt.Errorf("failed to parse client certificate: %v", err)
+	}
+	if age := time.Since(cert.NotBefore); age > maxAge {
+		return fmt.Errorf("client certificate was issued %v ago, exceeding the maximum age of %v",
+			age.Round(time.Second), maxAge)
+	}
+	return nil
+}
+
+// checkIstiodCABundle applies the EmptyCABundlePolicy if the istiod certificate is loaded, but its CA bundle
+// has no certificate. In this case, client certificates of the secure gRPC server cannot be verified.
+func (s *Server) checkIstiodCABundle() error {
+	bundle := s.istiodCertBundleWatcher.GetKeyCertBundle()
+	if len(bundle.CertPem) == 0 || x509.NewCertPool().AppendCertsFromPEM(bundle.CABundle) {
+		return nil
+	}
+	if features.EmptyCABundlePolicy == features.EmptyCABundleFail {
+		return fmt.Errorf("the CA bundle of the istiod certificate contains no certificate, so clients cannot be verified")
+	}
+	log.Warnf("the CA bundle of the istiod certificate contains no certificate, so clients cannot be verified")
+	return nil
+}
+
 // createPeerCertVerifier creates a SPIFFE certificate verifier with the current istiod configuration.
 func (s *Server) createPeerCertVerifier(tlsOptions TLSOptions) (*spiffe.PeerCertVerifier, error) {
 	if tlsOptions.CaCertFile == "" && s.CA == nil && features.SpiffeBundleEndpoints == "" {
@@ -975,6 +1361,52 @@ func (s *Server) createPeerCertVerifier(tlsOptions TLSOptions) (*spiffe.PeerCert
 	return peerCertVerifier, nil
 }
 
+// initIstiodCertsFromProviders creates Istiod certificates using the first of providers that succeeds.
+func (s *Server) initIstiodCertsFromProviders(args *PilotArgs, host string, providers []string) error {
+	var errs error
+	for _, provider := range providers {
+		if err := s.initIstiodCertsFromProvider(args, host, provider); err != nil {
+			log.Warnf("cert provider %v failed, trying the next provider: %v", provider, err)
+			errs = multierror.Append(errs, fmt.Errorf("%v: %v", provider, err))
+			continue
+		}
+		log.Infof("initialized Istiod DNS certificates with cert provider %v", provider)
+		s.istiodCertProvider = provider
+		return nil
+	}
+	return fmt.Errorf("no cert provider succeeded: %v", errs)
+}
+
+// initIstiodCertsFromProvider creates Istiod certificates using a single provider.
+func (s *Server) initIstiodCertsFromProvider(args *PilotArgs, host string, provider string) error {
+	switch provider {
+	case constants.CertProviderNone:
+		return nil
+	case constants.CertProviderFile:
+		tlsOptions := args.ServerOptions.TLSOptions
+		if !hasCustomTLSCerts(tlsOptions) {
+			return fmt.Errorf("no certificate files configured")
+		}
+		// Check the files before watching them, so a failed provider leaves no watches behind.
+		if _, err := tls.LoadX509KeyPair(tlsOptions.CertFile, tlsOptions.KeyFile); err != nil {
+			return err
+		}
+		if err := s.initCertificateWatches(tlsOptions); err != nil {
+			return err
+		}
+	case constants.CertProviderIstiod:
+		if !s.EnableCA() {
+			return fmt.Errorf("the istiod CA is disabled")
+		}
+		fallthrough
+	default:
+		if err := s.initDNSCerts(host, features.IstiodServiceCustomHost.Get(), args.Namespace, args.PodIP, provider); err != nil {
+			return err
+		}
+	}
+	return s.initIstiodCertLoader()
+}
+
 // hasCustomTLSCerts returns true if custom TLS certificates are configured via args.
 func hasCustomTLSCerts(tlsOptions TLSOptions) bool {
 	return tlsOptions.CaCertFile != "" && tlsOptions.CertFile != "" && tlsOptions.KeyFile != ""
@@ -985,7 +1417,10 @@ func (s *Server) getIstiodCertificate(info *tls.ClientHelloInfo) (*tls.Certifica
 	s.certMu.RLock()
 	defer s.certMu.RUnlock()
 	if s.istiodCert != nil {
-		return s.istiodCert, nil
+		if s.ocspStapler != nil {
+			return s.withSCTs(s.ocspStapler.stapled(s.istiodCert)), nil
+		}
+		return s.withSCTs(s.istiodCert), nil
 	}
 	return nil, fmt.Errorf("cert not initialized")
 }
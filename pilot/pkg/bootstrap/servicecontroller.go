@@ -110,7 +110,7 @@ func (s *Server) initKubeRegistry(args *PilotArgs) (err error) {
 	})
 
 	// Start the multicluster controller and wait for it to shutdown before exiting the server.
-	s.addTerminatingStartFunc(mc.Run)
+	s.addRegistryTerminatingStartFunc(mc.Run)
 
 	// start remote cluster controllers
 	s.addStartFunc(func(stop <-chan struct{}) error {
@@ -0,0 +1,39 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bootstrap
+
+import (
+	"istio.io/istio/pilot/pkg/leaderelection"
+)
+
+// addSingletonStartFunc adds a loop that only needs to run on one istiod instance. If leader election is enabled,
+// fn runs while this instance holds the electionID lease, and must return once its stop channel is closed.
+// Otherwise, fn runs on every instance until the server stops.
+func (s *Server) addSingletonStartFunc(electionID string, fn func(stop <-chan struct{})) {
+	if !s.leaderElection || s.kubeClient == nil {
+		s.addStartFunc(func(stop <-chan struct{}) error {
+			go fn(stop)
+			return nil
+		})
+		return
+	}
+	s.addStartFunc(func(stop <-chan struct{}) error {
+		go leaderelection.
+			NewLeaderElection(s.podNamespace, s.podName, electionID, s.kubeClient).
+			AddRunFunction(fn).
+			Run(stop)
+		return nil
+	})
+}
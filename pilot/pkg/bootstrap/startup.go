@@ -0,0 +1,60 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bootstrap
+
+import (
+	"fmt"
+	"time"
+
+	"istio.io/istio/pilot/pkg/features"
+	"istio.io/pkg/log"
+)
+
+// startupPhaseTimeout returns the timeout of the named startup phase, or 0 if it is unbounded.
+func startupPhaseTimeout(phase string) time.Duration {
+	if timeout, f := features.StartupPhaseTimeouts[phase]; f {
+		return timeout
+	}
+	return features.StartupPhaseTimeout
+}
+
+// runStartupPhase runs fn, the named phase of the istiod startup, logging when it starts and completes. If fn
+// does not complete within the timeout of the phase, an error naming the phase is returned, so a hang is
+// attributable. As phases cannot be canceled, fn is left running in the background.
+func runStartupPhase(phase string, fn func() error) error {
+	log.Infof("starting startup phase %s", phase)
+	start := time.Now()
+	timeout := startupPhaseTimeout(phase)
+	if timeout <= 0 {
+		err := fn()
+		log.Infof("startup phase %s completed in %v", phase, time.Since(start))
+		return err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- fn()
+	}()
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+	select {
+	case err := <-done:
+		log.Infof("startup phase %s completed in %v", phase, time.Since(start))
+		return err
+	case <-t.C:
+		log.Errorf("startup phase %s did not complete within %v", phase, timeout)
+		return fmt.Errorf("startup phase %s did not complete within %v", phase, timeout)
+	}
+}
@@ -15,6 +15,7 @@
 package bootstrap
 
 import (
+	"istio.io/istio/pilot/pkg/leaderelection"
 	"istio.io/istio/pkg/config/schema/collections"
 	"istio.io/istio/pkg/webhooks/validation/controller"
 	"istio.io/istio/pkg/webhooks/validation/server"
@@ -44,11 +45,10 @@ func (s *Server) initConfigValidation(args *PilotArgs) error {
 	})
 
 	if s.kubeClient != nil {
-		s.addStartFunc(func(stop <-chan struct{}) error {
+		s.addSingletonStartFunc(leaderelection.ValidationController, func(stop <-chan struct{}) {
 			log.Infof("Starting validation controller")
-			go controller.NewValidatingWebhookController(
-				s.kubeClient, args.Revision, args.Namespace, s.istiodCertBundleWatcher).Run(stop)
-			return nil
+			controller.NewValidatingWebhookController(
+				s.kubeClient, args.Revision, args.Namespace, s.validationCertBundleWatcher).Run(stop)
 		})
 	}
 	return nil
@@ -0,0 +1,197 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bootstrap
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"istio.io/istio/pilot/pkg/features"
+	"istio.io/istio/pilot/pkg/keycertbundle"
+	"istio.io/istio/pkg/config/constants"
+	"istio.io/pkg/log"
+)
+
+// validationCertRetryInterval is the time to wait before retrying a failed rotation of the validation cert.
+const validationCertRetryInterval = time.Minute
+
+// initValidationCerts creates the certificate presented by the HTTPS webhook server, if the webhooks use their own
+// cert provider. It is rotated independently of the istiod certificate. Otherwise, the webhooks share the istiod
+// certificate.
+func (s *Server) initValidationCerts(args *PilotArgs, host string) error {
+	tlsOptions := args.ServerOptions.TLSOptions
+	switch tlsOptions.ValidationCertProvider {
+	case "":
+		s.validationCertBundleWatcher = s.istiodCertBundleWatcher
+		return nil
+	case constants.CertProviderFile:
+		if tlsOptions.ValidationCertFile == "" || tlsOptions.ValidationKeyFile == "" || tlsOptions.ValidationCaCertFile == "" {
+			return fmt.Errorf("the %v validation cert provider requires the validation cert, key and CA cert files",
+				constants.CertProviderFile)
+		}
+		s.validationCertBundleWatcher = keycertbundle.NewWatcher()
+		return s.initValidationCertWatches(tlsOptions)
+	case constants.CertProviderKubernetes:
+		if s.kubeClient == nil {
+			return fmt.Errorf("the %v validation cert provider requires a Kubernetes client", constants.CertProviderKubernetes)
+		}
+		s.validationCertBundleWatcher = keycertbundle.NewWatcher()
+		names := getDNSNames(host, features.IstiodServiceCustomHost.Get(), args.Namespace, args.PodIP)
+		hostnamePrefix := strings.Split(host, ".")[0]
+		cert, err := s.issueValidationCertK8s(names, hostnamePrefix, args.Namespace)
+		if err != nil {
+			return err
+		}
+		s.addStartFunc(func(stop <-chan struct{}) error {
+			go s.rotateValidationCertK8s(cert, names, hostnamePrefix, args.Namespace, stop)
+			return nil
+		})
+		return nil
+	default:
+		return fmt.Errorf("unsupported validation cert provider %q", tlsOptions.ValidationCertProvider)
+	}
+}
+
+// initValidationCertWatches loads the validation cert from files, and reloads it when the files change.
+func (s *Server) initValidationCertWatches(tlsOptions TLSOptions) error {
+	if err := s.setValidationCertFromFiles(tlsOptions); err != nil {
+		return fmt.Errorf("failed to load validation cert: %v", err)
+	}
+	for _, file := range []string{tlsOptions.ValidationCertFile, tlsOptions.ValidationKeyFile} {
+		log.Infof("adding watcher for validation certificate %s", file)
+		if err := s.fileWatcher.Add(file); err != nil {
+			return fmt.Errorf("could not watch %v: %v", file, err)
+		}
+	}
+	s.addStartFunc(func(stop <-chan struct{}) error {
+		go func() {
+			var keyCertTimerC <-chan time.Time
+			for {
+				select {
+				case <-keyCertTimerC:
+					keyCertTimerC = nil
+					if err := s.setValidationCertFromFiles(tlsOptions); err != nil {
+						log.Errorf("failed to reload validation cert: %v", err)
+					}
+				case <-s.fileWatcher.Events(tlsOptions.ValidationCertFile):
+					keyCertTimerC = time.After(features.CertReloadDebounce)
+				case <-s.fileWatcher.Events(tlsOptions.ValidationKeyFile):
+					keyCertTimerC = time.After(features.CertReloadDebounce)
+				case err := <-s.fileWatcher.Errors(tlsOptions.ValidationCertFile):
+					log.Errorf("error watching %v: %v", tlsOptions.ValidationCertFile, err)
+				case err := <-s.fileWatcher.Errors(tlsOptions.ValidationKeyFile):
+					log.Errorf("error watching %v: %v", tlsOptions.ValidationKeyFile, err)
+				case <-stop:
+					return
+				}
+			}
+		}()
+		return nil
+	})
+	return nil
+}
+
+func (s *Server) setValidationCertFromFiles(tlsOptions TLSOptions) error {
+	cert, err := ioutil.ReadFile(tlsOptions.ValidationCertFile)
+	if err != nil {
+		return err
+	}
+	key, err := ioutil.ReadFile(tlsOptions.ValidationKeyFile)
+	if err != nil {
+		return err
+	}
+	caBundle, err := ioutil.ReadFile(tlsOptions.ValidationCaCertFile)
+	if err != nil {
+		return err
+	}
+	_, err = s.setValidationCert(key, cert, caBundle)
+	return err
+}
+
+// issueValidationCertK8s issues the validation cert for names with the Kubernetes CSR API.
+func (s *Server) issueValidationCertK8s(names []string, hostnamePrefix, namespace string) (*tls.Certificate, error) {
+	log.Infof("Generating K8S-signed validation cert for %v", names)
+	release, err := s.acquireCSRSlot()
+	if err != nil {
+		return nil, err
+	}
+	certChain, keyPEM, _, err := genKeyCertK8sCA(s.kubeClient.CertificatesV1beta1().CertificateSigningRequests(),
+		strings.Join(names, ","), hostnamePrefix+".validation.csr.secret", namespace, defaultCACertPath)
+	release()
+	if err != nil {
+		return nil, fmt.Errorf("failed generating validation cert by k8s: %v", err)
+	}
+	caBundle, err := ioutil.ReadFile(defaultCACertPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed reading %s: %v", defaultCACertPath, err)
+	}
+	return s.setValidationCert(keyPEM, certChain, caBundle)
+}
+
+// rotateValidationCertK8s re-issues the Kubernetes signed validation cert once half of its lifetime has passed.
+func (s *Server) rotateValidationCertK8s(cert *tls.Certificate, names []string, hostnamePrefix, namespace string,
+	stop <-chan struct{}) {
+	halfLife := func(cert *tls.Certificate) time.Time {
+		return cert.Leaf.NotBefore.Add(cert.Leaf.NotAfter.Sub(cert.Leaf.NotBefore) / 2)
+	}
+	next := halfLife(cert)
+	for {
+		select {
+		case <-stop:
+			return
+		case <-time.After(time.Until(next)):
+		}
+		cert, err := s.issueValidationCertK8s(names, hostnamePrefix, namespace)
+		if err != nil {
+			log.Errorf("failed to rotate validation cert, retrying in %v: %v", validationCertRetryInterval, err)
+			next = time.Now().Add(validationCertRetryInterval)
+			continue
+		}
+		next = halfLife(cert)
+	}
+}
+
+// setValidationCert loads the validation cert, and notifies the watchers of its CA bundle.
+func (s *Server) setValidationCert(key, cert, caBundle []byte) (*tls.Certificate, error) {
+	keyPair, err := tls.X509KeyPair(cert, key)
+	if err != nil {
+		return nil, fmt.Errorf("validation cert loading x509 key pairs failed: %v", err)
+	}
+	if keyPair.Leaf, err = parseLeafCert(cert); err != nil {
+		return nil, fmt.Errorf("validation cert - ParseCertificate() error: %v", err)
+	}
+	log.Infof("validation cert loaded - Issuer: %q, Subject: %q, NotAfter: %q", keyPair.Leaf.Issuer,
+		keyPair.Leaf.Subject, keyPair.Leaf.NotAfter.Format(time.RFC3339))
+	s.certMu.Lock()
+	s.validationCert = &keyPair
+	s.certMu.Unlock()
+	s.validationCertBundleWatcher.SetAndNotify(key, cert, caBundle)
+	return &keyPair, nil
+}
+
+// getValidationCertificate returns the certificate of the HTTPS webhook server. It is the istiod certificate,
+// unless the webhooks use their own cert provider.
+func (s *Server) getValidationCertificate(info *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	s.certMu.RLock()
+	cert := s.validationCert
+	s.certMu.RUnlock()
+	if cert != nil {
+		return cert, nil
+	}
+	return s.getIstiodCertificate(info)
+}
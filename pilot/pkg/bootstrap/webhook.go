@@ -41,11 +41,12 @@ func (s *Server) initSecureWebhookServer(args *PilotArgs) {
 	log.Info("initializing secure webhook server for istiod webhooks")
 	// create the https server for hosting the k8s injectionWebhook handlers.
 	s.httpsMux = http.NewServeMux()
+	s.tlsHandshakeTimeout = args.ServerOptions.TLSOptions.HandshakeTimeout
 	s.httpsServer = &http.Server{
 		Addr:    args.ServerOptions.HTTPSAddr,
 		Handler: s.httpsMux,
 		TLSConfig: &tls.Config{
-			GetCertificate: s.getIstiodCertificate,
+			GetCertificate: s.getValidationCertificate,
 			MinVersion:     tls.VersionTLS12,
 			CipherSuites:   args.ServerOptions.TLSOptions.CipherSuits,
 		},
@@ -35,6 +35,7 @@ import (
 	"gomodules.xyz/jsonpatch/v2"
 	crd "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	apiextensionsclient "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	klabels "k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -121,6 +122,13 @@ func NewForSchemas(ctx context.Context, client kube.Client, revision, domainSuff
 		// From the spec: "Its name MUST be in the format <.spec.name>.<.spec.group>."
 		name := fmt.Sprintf("%s.%s", s.Resource().Plural(), s.Resource().Group())
 		if _, f := known[name]; f {
+			if features.TolerateMissingRBAC {
+				if err := checkPermissions(ctx, client, s); err != nil {
+					scope.Warnf("Skipping CRD %v as istiod lacks permission to watch it: %v", s.Resource().GroupVersionKind(), err)
+					out.schemas = out.schemas.Remove(s)
+					continue
+				}
+			}
 			var i informers.GenericInformer
 			var err error
 			if s.Resource().Group() == "networking.x-k8s.io" {
@@ -141,6 +149,23 @@ func NewForSchemas(ctx context.Context, client kube.Client, revision, domainSuff
 	return out, nil
 }
 
+// checkPermissions returns an error if istiod is forbidden to list or watch the resources of s, as an informer
+// of them would never sync. Other errors are left for the informer to retry.
+func checkPermissions(ctx context.Context, client kube.Client, s collection.Schema) error {
+	resource := client.Metadata().Resource(s.Resource().GroupVersionResource())
+	if _, err := resource.List(ctx, metav1.ListOptions{Limit: 1}); apierrors.IsForbidden(err) {
+		return err
+	}
+	w, err := resource.Watch(ctx, metav1.ListOptions{})
+	if apierrors.IsForbidden(err) {
+		return err
+	}
+	if err == nil {
+		w.Stop()
+	}
+	return nil
+}
+
 // Validate we are ready to handle events. Until the informers are synced, we will block the queue
 func (cl *Client) checkReadyForEvents(curr interface{}) error {
 	if !cl.informerSynced() {
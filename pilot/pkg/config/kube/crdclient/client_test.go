@@ -22,8 +22,12 @@ import (
 	"time"
 
 	v1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	metadatafake "k8s.io/client-go/metadata/fake"
+	k8stesting "k8s.io/client-go/testing"
 	"k8s.io/client-go/tools/cache"
 
 	"istio.io/api/meta/v1alpha1"
@@ -274,3 +278,62 @@ func TestClient(t *testing.T) {
 		})
 	})
 }
+
+func TestTolerateMissingRBAC(t *testing.T) {
+	original := features.TolerateMissingRBAC
+	t.Cleanup(func() {
+		features.TolerateMissingRBAC = original
+	})
+	schemas := collection.NewSchemasBuilder().
+		MustAdd(collections.IstioNetworkingV1Alpha3Sidecars).
+		MustAdd(collections.IstioNetworkingV1Alpha3Virtualservices).
+		Build()
+	denied := collections.IstioNetworkingV1Alpha3Virtualservices.Resource()
+
+	newClient := func(t *testing.T) (model.ConfigStoreCache, kube.ExtendedClient) {
+		fake := kube.NewFakeClient()
+		for _, s := range schemas.All() {
+			if _, err := fake.Ext().ApiextensionsV1().CustomResourceDefinitions().Create(context.TODO(), &v1.CustomResourceDefinition{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: fmt.Sprintf("%s.%s", s.Resource().Plural(), s.Resource().Group()),
+				},
+			}, metav1.CreateOptions{}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		fake.Metadata().(*metadatafake.FakeMetadataClient).PrependReactor("*", denied.Plural(),
+			func(action k8stesting.Action) (bool, runtime.Object, error) {
+				return true, nil, apierrors.NewForbidden(denied.GroupVersionResource().GroupResource(), "", fmt.Errorf("denied"))
+			})
+		store, err := NewForSchemas(context.Background(), fake, "", "", schemas)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return store, fake
+	}
+
+	t.Run("fail", func(t *testing.T) {
+		features.TolerateMissingRBAC = false
+		store, _ := newClient(t)
+		if _, f := store.Schemas().FindByGroupVersionKind(denied.GroupVersionKind()); !f {
+			t.Fatalf("expected %v to be kept", denied.GroupVersionKind())
+		}
+	})
+	t.Run("tolerate", func(t *testing.T) {
+		features.TolerateMissingRBAC = true
+		store, fake := newClient(t)
+		if _, f := store.Schemas().FindByGroupVersionKind(denied.GroupVersionKind()); f {
+			t.Fatalf("expected %v to be skipped", denied.GroupVersionKind())
+		}
+		if _, f := store.Schemas().FindByGroupVersionKind(collections.IstioNetworkingV1Alpha3Sidecars.Resource().GroupVersionKind()); !f {
+			t.Fatalf("expected permitted types to be kept")
+		}
+
+		// Without the informer of the denied type, the store syncs.
+		stop := make(chan struct{})
+		defer close(stop)
+		go store.Run(stop)
+		fake.RunAndWait(stop)
+		retry.UntilOrFail(t, store.HasSynced, retry.Timeout(5*time.Second))
+	})
+}
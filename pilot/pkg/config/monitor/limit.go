@@ -0,0 +1,50 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitor
+
+import (
+	"fmt"
+
+	"istio.io/istio/pkg/config"
+	"istio.io/pkg/monitoring"
+)
+
+var rejectedLoads = monitoring.NewSum(
+	"pilot_file_registry_rejected_loads",
+	"Total number of file registry loads rejected for exceeding the maximum number of resources.",
+)
+
+func init() {
+	monitoring.MustRegister(rejectedLoads)
+}
+
+// LimitedSnapshot wraps a snapshot function, failing the snapshot if it has more than max resources. As failed
+// snapshots are not applied, the last good config is kept. If max is not positive, the snapshot is unbounded.
+func LimitedSnapshot(getSnapshotFunc func() ([]*config.Config, error), max int) func() ([]*config.Config, error) {
+	if max <= 0 {
+		return getSnapshotFunc
+	}
+	return func() ([]*config.Config, error) {
+		configs, err := getSnapshotFunc()
+		if err != nil {
+			return configs, err
+		}
+		if len(configs) > max {
+			rejectedLoads.Increment()
+			return nil, fmt.Errorf("found %d resources, exceeding the maximum of %d; keeping the previous config", len(configs), max)
+		}
+		return configs, nil
+	}
+}
@@ -15,12 +15,19 @@
 package monitor
 
 import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
+	"golang.org/x/time/rate"
 
+	"istio.io/istio/pilot/pkg/features"
 	"istio.io/istio/pilot/pkg/model"
 	"istio.io/istio/pkg/config"
 	"istio.io/pkg/log"
@@ -54,26 +61,94 @@ func NewMonitor(name string, delegateStore model.ConfigStore, getSnapshotFunc fu
 
 const watchDebounceDelay = 50 * time.Millisecond
 
-// Trigger notifications when a file is mutated
+// filePollInterval is the interval files are polled for changes at, if there are more than
+// features.MaxWatchedFiles.
+var filePollInterval = 5 * time.Second
+
+// tooManyFiles returns true if there are more than features.MaxWatchedFiles files under root.
+func tooManyFiles(root string) bool {
+	max := features.MaxWatchedFiles
+	if max <= 0 {
+		return false
+	}
+	files := 0
+	tooMany := errors.New("too many files")
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			files++
+			if files > max {
+				return tooMany
+			}
+		}
+		return nil
+	})
+	return err == tooMany
+}
+
+// filesFingerprint summarizes the names, sizes and modification times of the files under root.
+func filesFingerprint(root string) uint64 {
+	h := fnv.New64a()
+	_ = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err == nil {
+			_, _ = fmt.Fprintf(h, "%s %d %d\n", path, info.Size(), info.ModTime().UnixNano())
+		}
+		return nil
+	})
+	return h.Sum64()
+}
+
+// Trigger notifications when a file is mutated. Events are coalesced until no new event is seen for
+// watchDebounceDelay, but a notification is sent at the latest features.FileRegistryCoalesceWindow after the
+// first event, even if writes are ongoing. If there are more than features.MaxWatchedFiles files under path,
+// they are also polled for changes every filePollInterval.
 func fileTrigger(path string, ch chan struct{}, stop <-chan struct{}) error {
 	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
 		return err
 	}
 	if err = watcher.Add(path); err != nil {
+		watcher.Close()
 		return err
 	}
+	var (
+		poll        *time.Ticker
+		pollC       <-chan time.Time
+		fingerprint uint64
+	)
+	if tooManyFiles(path) {
+		log.Warnf("%s contains more than %d files, polling for changes every %v",
+			path, features.MaxWatchedFiles, filePollInterval)
+		fingerprint = filesFingerprint(path)
+		poll = time.NewTicker(filePollInterval)
+		pollC = poll.C
+	}
+	maxDelay := features.FileRegistryCoalesceWindow
 	go func() {
 		defer watcher.Close()
-		var debounceC <-chan time.Time
+		if poll != nil {
+			defer poll.Stop()
+		}
+		var debounceC, maxDelayC <-chan time.Time
+		changed := func() {
+			debounceC = time.After(watchDebounceDelay)
+			if maxDelayC == nil && maxDelay > 0 {
+				maxDelayC = time.After(maxDelay)
+			}
+		}
 		for {
 			select {
 			case <-debounceC:
-				debounceC = nil
+				debounceC, maxDelayC = nil, nil
+				ch <- struct{}{}
+			case <-maxDelayC:
+				debounceC, maxDelayC = nil, nil
 				ch <- struct{}{}
 			case <-watcher.Events:
-				if debounceC == nil {
-					debounceC = time.After(watchDebounceDelay)
+				changed()
+			case <-pollC:
+				if f := filesFingerprint(path); f != fingerprint {
+					fingerprint = f
+					changed()
 				}
 			case err := <-watcher.Errors:
 				log.Warnf("Error watching file trigger: %v %v", path, err)
@@ -98,11 +173,19 @@ func (m *Monitor) Start(stop <-chan struct{}) {
 	if err := fileTrigger(m.root, m.updateCh, stop); err != nil {
 		log.Errorf("Unable to setup FileTrigger for %s: %v", m.root, err)
 	}
+	var limiter *rate.Limiter
+	if features.FileReloadQPS > 0 {
+		limiter = rate.NewLimiter(rate.Limit(features.FileReloadQPS), 1)
+	}
 	// Run the close loop asynchronously.
 	go func() {
 		for {
 			select {
 			case <-c:
+				// Triggers received while throttled are coalesced, as the channel holds a single pending trigger.
+				if limiter != nil && !waitForReload(limiter, stop) {
+					return
+				}
 				log.Infof("Triggering reload of file configuration")
 				m.checkAndUpdate()
 			case <-stop:
@@ -112,6 +195,21 @@ func (m *Monitor) Start(stop <-chan struct{}) {
 	}()
 }
 
+// waitForReload waits until limiter allows a reload. It returns false if stop is closed first.
+func waitForReload(limiter *rate.Limiter, stop <-chan struct{}) bool {
+	delay := limiter.Reserve().Delay()
+	if delay == 0 {
+		return true
+	}
+	log.Debugf("Throttling reload of file configuration for %v", delay)
+	select {
+	case <-time.After(delay):
+		return true
+	case <-stop:
+		return false
+	}
+}
+
 func (m *Monitor) checkAndUpdate() {
 	newConfigs, err := m.getSnapshotFunc()
 	// If an error exists then log it and return to running the check and update
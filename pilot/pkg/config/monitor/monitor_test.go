@@ -16,6 +16,11 @@ package monitor
 
 import (
 	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
 	"testing"
 	"time"
 
@@ -23,6 +28,7 @@ import (
 
 	networking "istio.io/api/networking/v1alpha3"
 	"istio.io/istio/pilot/pkg/config/memory"
+	"istio.io/istio/pilot/pkg/features"
 	"istio.io/istio/pkg/config"
 	"istio.io/istio/pkg/config/schema/collection"
 	"istio.io/istio/pkg/config/schema/collections"
@@ -194,3 +200,189 @@ func TestMonitorForError(t *testing.T) {
 		return nil
 	}).Should(gomega.Succeed())
 }
+
+func TestMonitorResourceLimit(t *testing.T) {
+	g := gomega.NewWithT(t)
+
+	store := memory.Make(collection.SchemasFor(collections.IstioNetworkingV1Alpha3Gateways))
+	gateways := func(n int) []*config.Config {
+		out := make([]*config.Config, 0, n)
+		for i := 0; i < n; i++ {
+			gw := createConfigSet[0].DeepCopy()
+			gw.Name = fmt.Sprintf("gateway-%d", i)
+			out = append(out, &gw)
+		}
+		return out
+	}
+	var configs []*config.Config
+	mon := NewMonitor("", store, LimitedSnapshot(func() ([]*config.Config, error) {
+		return configs, nil
+	}, 2), "")
+
+	configs = gateways(2)
+	mon.checkAndUpdate()
+	c, err := store.List(gvk.Gateway, "")
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(c).To(gomega.HaveLen(2))
+
+	// Exceeding the limit rejects the load, keeping the previous config
+	configs = gateways(3)
+	mon.checkAndUpdate()
+	c, err = store.List(gvk.Gateway, "")
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(c).To(gomega.HaveLen(2))
+
+	configs = gateways(1)
+	mon.checkAndUpdate()
+	c, err = store.List(gvk.Gateway, "")
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(c).To(gomega.HaveLen(1))
+}
+
+func TestFileTriggerCoalesceWindow(t *testing.T) {
+	original := features.FileRegistryCoalesceWindow
+	t.Cleanup(func() {
+		features.FileRegistryCoalesceWindow = original
+	})
+	features.FileRegistryCoalesceWindow = 300 * time.Millisecond
+
+	dir := t.TempDir()
+	stop := make(chan struct{})
+	defer close(stop)
+	ch := make(chan struct{}, 1)
+	if err := fileTrigger(dir, ch, stop); err != nil {
+		t.Fatal(err)
+	}
+
+	writing := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; ; i++ {
+			select {
+			case <-writing:
+				return
+			case <-time.After(10 * time.Millisecond):
+			}
+			if err := ioutil.WriteFile(filepath.Join(dir, fmt.Sprintf("%d.yaml", i%10)), []byte(fmt.Sprint(i)), 0o644); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+
+	// Writes never pause for the debounce delay, so the reload is only triggered by the coalesce window.
+	start := time.Now()
+	for i := 0; i < 2; i++ {
+		select {
+		case <-ch:
+		case <-time.After(features.FileRegistryCoalesceWindow + time.Second):
+			t.Fatalf("no reload within the coalesce window while writing continuously")
+		}
+	}
+	close(writing)
+	<-done
+	if elapsed := time.Since(start); elapsed < features.FileRegistryCoalesceWindow {
+		t.Fatalf("expected writes to be coalesced for the window, got two reloads in %v", elapsed)
+	}
+}
+
+func TestFileReloadQPS(t *testing.T) {
+	original := features.FileReloadQPS
+	t.Cleanup(func() {
+		features.FileReloadQPS = original
+	})
+	features.FileReloadQPS = 5
+	g := gomega.NewWithT(t)
+
+	store := memory.Make(collection.SchemasFor(collections.IstioNetworkingV1Alpha3Gateways))
+	var (
+		mu      sync.Mutex
+		reloads int
+		latest  = createConfigSet
+	)
+	someConfigFunc := func() ([]*config.Config, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		reloads++
+		return latest, nil
+	}
+	mon := NewMonitor("", store, someConfigFunc, "")
+	stop := make(chan struct{})
+	defer close(stop)
+	mon.Start(stop)
+
+	// Trigger far faster than the limit for half a second, then change the config
+	start := time.Now()
+	for time.Since(start) < 500*time.Millisecond {
+		mon.updateCh <- struct{}{}
+		time.Sleep(time.Millisecond)
+	}
+	mu.Lock()
+	latest = updateConfigSet
+	mu.Unlock()
+	mon.updateCh <- struct{}{}
+
+	// The final config is eventually applied
+	g.Eventually(func() string {
+		c := store.Get(gvk.Gateway, "magic", "")
+		if c == nil {
+			return ""
+		}
+		return c.Spec.(*networking.Gateway).Servers[0].Port.Protocol
+	}, 2*time.Second).Should(gomega.Equal("HTTP2"))
+
+	// One initial load, one immediate reload, and about 5 per second after that
+	mu.Lock()
+	defer mu.Unlock()
+	if reloads > 6 {
+		t.Fatalf("expected reloads to be throttled, got %d", reloads)
+	}
+}
+
+func TestFileTriggerMaxWatchedFiles(t *testing.T) {
+	originalMax, originalInterval := features.MaxWatchedFiles, filePollInterval
+	t.Cleanup(func() {
+		features.MaxWatchedFiles, filePollInterval = originalMax, originalInterval
+	})
+	features.MaxWatchedFiles = 10
+	filePollInterval = 50 * time.Millisecond
+
+	dir := t.TempDir()
+	sub := filepath.Join(dir, "sub")
+	if err := os.Mkdir(sub, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	write := func(i int, content string) {
+		t.Helper()
+		if err := ioutil.WriteFile(filepath.Join(sub, fmt.Sprintf("%d.yaml", i)), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 5; i++ {
+		write(i, "")
+	}
+	if tooManyFiles(dir) {
+		t.Fatalf("expected the files not to be polled below the limit")
+	}
+	for i := 5; i < 50; i++ {
+		write(i, "")
+	}
+	if !tooManyFiles(dir) {
+		t.Fatalf("expected the files to be polled above the limit")
+	}
+
+	stop := make(chan struct{})
+	defer close(stop)
+	ch := make(chan struct{}, 1)
+	if err := fileTrigger(dir, ch, stop); err != nil {
+		t.Fatal(err)
+	}
+	// Changes in the subdirectory are not seen by the watch of the root, but are found by polling.
+	write(3, "changed")
+	select {
+	case <-ch:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("change not detected while polling")
+	}
+}
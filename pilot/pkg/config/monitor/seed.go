@@ -0,0 +1,53 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitor
+
+import (
+	"sort"
+	"sync"
+
+	"istio.io/istio/pkg/config"
+)
+
+// SeededSnapshot wraps a snapshot function, returning seed instead while the snapshot is empty. Once the snapshot
+// has content, the seed is no longer used, even if the snapshot becomes empty again.
+func SeededSnapshot(getSnapshotFunc func() ([]*config.Config, error), seed []config.Config) func() ([]*config.Config, error) {
+	if len(seed) == 0 {
+		return getSnapshotFunc
+	}
+	var mu sync.Mutex
+	seeding := true
+	return func() ([]*config.Config, error) {
+		configs, err := getSnapshotFunc()
+		if err != nil {
+			return configs, err
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if len(configs) > 0 {
+			seeding = false
+		}
+		if !seeding {
+			return configs, nil
+		}
+		result := make([]*config.Config, 0, len(seed))
+		for _, c := range seed {
+			cpy := c.DeepCopy()
+			result = append(result, &cpy)
+		}
+		sort.Sort(byKey(result))
+		return result, nil
+	}
+}
@@ -15,6 +15,10 @@
 package features
 
 import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/golang/protobuf/ptypes/duration"
@@ -58,12 +62,617 @@ var (
 		"Determines whether or not trace spans generated by Envoy will include Istio-specific tags.",
 	).Get()
 
+	SelfSignedCertRetries = env.RegisterIntVar(
+		"PILOT_SELF_SIGNED_CERT_RETRIES",
+		3,
+		"The number of times generating the istiod DNS cert with the istiod CA is retried at startup before "+
+			"istiod fails to start.",
+	).Get()
+
+	SelfSignedCertRetryBackoff = env.RegisterDurationVar(
+		"PILOT_SELF_SIGNED_CERT_RETRY_BACKOFF",
+		100*time.Millisecond,
+		"The time to wait before the first retry of generating the istiod DNS cert. It doubles for each retry.",
+	).Get()
+
+	PerRevisionCache = env.RegisterBoolVar(
+		"PILOT_PER_REVISION_XDS_CACHE",
+		false,
+		"If enabled, the keys of the XDS cache include the control plane revision, so the entries of revisions "+
+			"sharing a process never collide.",
+	).Get()
+
+	XDSRuntimeStatsInterval = env.RegisterDurationVar(
+		"PILOT_XDS_RUNTIME_STATS_INTERVAL",
+		0,
+		"If set, the goroutines serving XDS connections and the bytes held by the XDS cache are recorded at this "+
+			"interval, in the pilot_xds_connection_goroutines, pilot_xds_goroutines_per_connection and "+
+			"pilot_xds_cache_bytes metrics. If 0, they are not recorded.",
+	).Get()
+
+	StartupPhaseTimeout = env.RegisterDurationVar(
+		"PILOT_STARTUP_PHASE_TIMEOUT",
+		30*time.Minute,
+		"The maximum duration of each istiod startup phase, such as kube-client, ca or oidc, unless overridden in "+
+			"PILOT_STARTUP_PHASE_TIMEOUTS. Istiod fails to start, naming the phase, if a phase exceeds it. "+
+			"A value of 0 disables the timeouts.",
+	).Get()
+
+	startupPhaseTimeoutsVar = env.RegisterStringVar(
+		"PILOT_STARTUP_PHASE_TIMEOUTS",
+		"",
+		"Comma separated list of phase=duration pairs, overriding PILOT_STARTUP_PHASE_TIMEOUT for istiod startup "+
+			"phases. The phases are kube-client, ca, controllers, istiod-certs, oidc, components and "+
+			"listener-<name>, for example: kube-client=1m,listener-grpc=10s.",
+	)
+
+	StartupPhaseTimeouts = func() map[string]time.Duration {
+		timeouts, err := ParseDurations(startupPhaseTimeoutsVar.Get())
+		if err != nil {
+			log.Warnf("ignoring invalid PILOT_STARTUP_PHASE_TIMEOUTS: %v", err)
+			return nil
+		}
+		return timeouts
+	}()
+
+	CertWriteRetries = env.RegisterIntVar(
+		"PILOT_CERT_WRITE_RETRIES",
+		3,
+		"The number of times writing a certificate or key to the file system is retried after a failure.",
+	).Get()
+
+	CertWriteRetryBackoff = env.RegisterDurationVar(
+		"PILOT_CERT_WRITE_RETRY_BACKOFF",
+		100*time.Millisecond,
+		"The time to wait before the first retry of writing a certificate or key. It doubles for each retry.",
+	).Get()
+
+	AutoGOMAXPROCS = env.RegisterBoolVar(
+		"PILOT_AUTO_GOMAXPROCS",
+		false,
+		"If enabled, istiod sets GOMAXPROCS from the CPU quota of its cgroup at startup, to avoid CPU throttling "+
+			"when running with a CPU limit. It is not changed if the GOMAXPROCS environment variable is set.",
+	).Get()
+
 	PushThrottle = env.RegisterIntVar(
 		"PILOT_PUSH_THROTTLE",
 		100,
 		"Limits the number of concurrent pushes allowed. On larger machines this can be increased for faster pushes",
 	).Get()
 
+	// ConnectionLimit is the maximum number of XDS connections accepted by a single istiod.
+	ConnectionLimit = env.RegisterIntVar(
+		"PILOT_MAX_XDS_CONNECTIONS",
+		0,
+		"The maximum number of XDS connections accepted by this istiod. Connections beyond the limit are rejected, "+
+			"causing the proxy to retry, likely against another istiod. A value of 0 disables the limit.",
+	).Get()
+
+	regionConnectionLimitsVar = env.RegisterStringVar(
+		"PILOT_REGION_XDS_CONNECTION_LIMITS",
+		"",
+		"Comma separated list of region=limit pairs, bounding the number of XDS connections accepted from proxies "+
+			"in each region, as reported in the node locality. For example: us-east1=500,us-west1=100. "+
+			"Regions without a limit are only bound by PILOT_MAX_XDS_CONNECTIONS.",
+	)
+
+	RegionConnectionLimits = func() map[string]int {
+		limits, err := ParseLimits(regionConnectionLimitsVar.Get())
+		if err != nil {
+			log.Warnf("ignoring invalid PILOT_REGION_XDS_CONNECTION_LIMITS: %v", err)
+			return nil
+		}
+		return limits
+	}()
+
+	proxyTypeConnectionLimitsVar = env.RegisterStringVar(
+		"PILOT_PROXY_TYPE_XDS_CONNECTION_LIMITS",
+		"",
+		"Comma separated list of type=limit pairs, bounding the number of XDS connections accepted from proxies "+
+			"of each type, as in the node ID. For example, sidecar=800 with PILOT_MAX_XDS_CONNECTIONS=1000 keeps "+
+			"200 connections for gateways. Types without a limit are only bound by PILOT_MAX_XDS_CONNECTIONS.",
+	)
+
+	ProxyTypeConnectionLimits = func() map[string]int {
+		limits, err := ParseLimits(proxyTypeConnectionLimitsVar.Get())
+		if err != nil {
+			log.Warnf("ignoring invalid PILOT_PROXY_TYPE_XDS_CONNECTION_LIMITS: %v", err)
+			return nil
+		}
+		return limits
+	}()
+
+	inheritedListenersVar = env.RegisterStringVar(
+		"PILOT_INHERITED_LISTENERS",
+		"",
+		"Comma separated list of listener=fd pairs of listening sockets inherited from the parent process, such as "+
+			"grpc=3,http=4. Listeners that are inherited are not bound again, so a new istiod binary can take over "+
+			"without dropping connections. Listener names are grpc, secureGrpc, http and https. If empty, all "+
+			"listeners are bound.",
+	)
+
+	InheritedListeners = func() map[string]int {
+		fds, err := ParseInheritedListeners(inheritedListenersVar.Get())
+		if err != nil {
+			log.Warnf("ignoring %v", err)
+			return nil
+		}
+		return fds
+	}()
+
+	FileWatchPollInterval = env.RegisterDurationVar(
+		"PILOT_FILE_WATCH_POLL_INTERVAL",
+		0,
+		"If set, watched files such as certificates and mesh config are also polled at this interval, and "+
+			"changes in their modification time, size or content trigger a reload. This is useful on filesystems "+
+			"where file events are not reliably delivered, such as NFS. Disabled by default.",
+	).Get()
+
+	EnablePushedConfigDump = env.RegisterBoolVar(
+		"PILOT_ENABLE_PUSHED_CONFIG_DUMP",
+		false,
+		"If enabled, istiod records the resources last pushed to each proxy, and /debug/config_dump serves "+
+			"them rather than regenerating the configuration. This increases memory usage.",
+	).Get()
+
+	DegradeOnRegistryLoss = env.RegisterBoolVar(
+		"PILOT_DEGRADE_ON_REGISTRY_LOSS",
+		false,
+		"If enabled, istiod reports itself as degraded on its readiness endpoint and the pilot_registry_degraded "+
+			"metric when it loses connectivity to the Kubernetes API for longer than PILOT_REGISTRY_LOSS_THRESHOLD. "+
+			"istiod keeps serving its last known config while degraded.",
+	).Get()
+
+	RegistryLossThreshold = env.RegisterDurationVar(
+		"PILOT_REGISTRY_LOSS_THRESHOLD",
+		time.Minute,
+		"The duration registry connectivity must be lost before istiod is considered degraded. "+
+			"Only applies if PILOT_DEGRADE_ON_REGISTRY_LOSS is enabled.",
+	).Get()
+
+	XDSGenerationTimeout = env.RegisterDurationVar(
+		"PILOT_XDS_GENERATION_TIMEOUT",
+		0,
+		"If set, bounds how long generating a single XDS type for a proxy may take. On timeout, the previously "+
+			"generated version for the type is served instead; without one, generation is awaited. A value of 0 disables "+
+			"the timeout.",
+	).Get()
+
+	ADSRequestWorkers = env.RegisterIntVar(
+		"PILOT_ADS_REQUEST_WORKERS",
+		0,
+		"Limits the number of discovery requests processed concurrently across all XDS connections. This smooths "+
+			"CPU usage when many proxies connect at once. Requests are still processed by their connection, the "+
+			"value only bounds their concurrency rather than sizing a pool of workers. A value of 0 disables the limit.",
+	).Get()
+
+	MaxConcurrentComputations = env.RegisterIntVar(
+		"PILOT_MAX_CONCURRENT_COMPUTATIONS",
+		0,
+		"Limits the number of full config generations run concurrently across all XDS connections. Further generations "+
+			"wait for a running one to complete, bounding CPU and memory usage under config churn. Unlike "+
+			"PILOT_PUSH_THROTTLE, this also applies to generations for discovery requests. A value of 0 disables the limit.",
+	).Get()
+
+	MaxConcurrentPushesPerNode = env.RegisterIntVar(
+		"PILOT_MAX_CONCURRENT_PUSHES_PER_NODE",
+		1,
+		"Limits the number of config generations run concurrently for the same node ID, across all of its XDS "+
+			"connections, so a proxy reconnecting repeatedly cannot cause redundant parallel work. A value of 0 "+
+			"disables the limit.",
+	).Get()
+
+	IncludePodIPSAN = env.RegisterBoolVar(
+		"PILOT_INCLUDE_POD_IP_SAN",
+		false,
+		"If enabled, the pod IP of istiod, taken from the POD_IP environment variable, is added as an IP SAN "+
+			"to the istiod DNS certificate. This allows clients to connect to istiod directly by pod IP.",
+	).Get()
+
+	MaxConnectionLifetime = env.RegisterDurationVar(
+		"PILOT_MAX_XDS_CONNECTION_LIFETIME",
+		0,
+		"If set, XDS connections are closed once they reach this age, with up to 10% jitter, after any in progress "+
+			"push completes. This forces proxies to reconnect and re-authenticate, re-validating their certificates. "+
+			"A value of 0 disables the limit.",
+	).Get()
+
+	RequireSecureGRPC = env.RegisterBoolVar(
+		"PILOT_REQUIRE_SECURE_GRPC",
+		false,
+		"If enabled, istiod fails to start if a secure gRPC address is configured but no certificate is available "+
+			"to serve it, instead of silently disabling the secure gRPC server.",
+	).Get()
+
+	TrimExpiredRoots = env.RegisterBoolVar(
+		"PILOT_TRIM_EXPIRED_ROOTS",
+		false,
+		"If enabled, expired root certificates are dropped from the CA bundle loaded for the istiod certificate. "+
+			"At least one root is always kept.",
+	).Get()
+
+	StrictCABundleParsing = env.RegisterBoolVar(
+		"PILOT_STRICT_CA_BUNDLE_PARSING",
+		false,
+		"If enabled, loading the CA bundle for the istiod certificate fails if it has a malformed PEM block. "+
+			"Otherwise, malformed blocks are skipped with a warning and the valid roots are loaded.",
+	).Get()
+
+	ReadinessSettleTime = env.RegisterDurationVar(
+		"PILOT_READINESS_SETTLE_TIME",
+		0,
+		"If set, istiod reports not ready after a config change requiring a full push, until the change has been "+
+			"pushed to all proxies or this much time has passed. This avoids routing to an istiod that is "+
+			"recomputing config. A value of 0 disables this.",
+	).Get()
+
+	MaxDiscoveryRequestResources = env.RegisterIntVar(
+		"PILOT_MAX_DISCOVERY_REQUEST_RESOURCES",
+		100000,
+		"The maximum number of resource names accepted in a single XDS request. Requests exceeding the limit are "+
+			"rejected and the connection is closed. A value of 0 disables the limit.",
+	).Get()
+
+	PrewarmDNS = env.RegisterBoolVar(
+		"PILOT_PREWARM_DNS",
+		false,
+		"If enabled, istiod resolves the hostnames of DNS resolved services once its caches have synced, before "+
+			"serving proxies, so the DNS resolver cache is warm for the first pushes.",
+	).Get()
+
+	PrewarmDNSTimeout = env.RegisterDurationVar(
+		"PILOT_PREWARM_DNS_TIMEOUT",
+		10*time.Second,
+		"The maximum time spent resolving hostnames when PILOT_PREWARM_DNS is enabled.",
+	).Get()
+
+	CertReloadDebounce = env.RegisterDurationVar(
+		"PILOT_CERT_RELOAD_DEBOUNCE",
+		100*time.Millisecond,
+		"The time to wait for the istiod certificate files to stop changing before reloading them, so files "+
+			"updated together trigger a single reload.",
+	).Get()
+
+	MaxInFlightCSRs = env.RegisterIntVar(
+		"PILOT_MAX_IN_FLIGHT_CSRS",
+		1,
+		"The maximum number of Kubernetes CSRs istiod has outstanding at once when issuing its DNS certificate. "+
+			"New CSRs are not created until an outstanding one is issued or times out; an issuance waiting for more "+
+			"than 30s fails.",
+	).Get()
+
+	TLSKeyUpdateInterval = env.RegisterDurationVar(
+		"PILOT_TLS_KEY_UPDATE_INTERVAL",
+		0,
+		"If set, secure XDS connections are gracefully closed once they reach this age, with some jitter, so clients "+
+			"reconnect with a new TLS handshake and fresh session keys. Go does not support server-initiated TLS 1.3 "+
+			"key updates, so the re-handshake stands in for them. Disabled if 0.",
+	).Get()
+
+	CertClockSkewAllowance = env.RegisterDurationVar(
+		"PILOT_CERT_CLOCK_SKEW_ALLOWANCE",
+		2*time.Minute,
+		"The clock skew tolerated when checking the validity window of the istiod certificate, so freshly issued "+
+			"certificates are accepted on hosts with a slightly late clock. If 0, a certificate outside of its "+
+			"validity window only logs a warning. Client certificates are verified by the TLS stack at the "+
+			"current time, without tolerance.",
+	).Get()
+
+	GenerationCPUWarnThreshold = env.RegisterDurationVar(
+		"PILOT_GENERATION_CPU_WARN_THRESHOLD",
+		0,
+		"If set, the CPU time a single config generation may use before a warning is logged and the "+
+			"pilot_xds_expensive_generations metric is incremented. Measuring locks the generating goroutine to "+
+			"its thread, so is disabled by default. CPU time is only measured on Linux.",
+	).Get()
+
+	EmptyEDSPolicy = EmptyEDSPolicyType(env.RegisterStringVar(
+		"PILOT_EMPTY_EDS_POLICY",
+		string(EmptyEDSSendEmpty),
+		"Controls EDS responses for clusters without endpoints. If send-empty, an assignment with no endpoints "+
+			"is sent. If omit, the cluster is left out of the response, and no response is sent if no cluster remains, so "+
+			"proxies keep waiting for endpoints.",
+	).Get())
+
+	AtomicEDSSwap = env.RegisterBoolVar(
+		"PILOT_ATOMIC_EDS_SWAP",
+		false,
+		"If enabled, endpoint updates of known services are staged, and the previous endpoints keep being served "+
+			"until the debounced push carrying the updates starts. All staged updates are then applied at once, so "+
+			"proxies never observe the intermediate endpoint sets of a change made of several updates.",
+	).Get()
+
+	ExperimentBucketPercent = env.RegisterIntVar(
+		"PILOT_EXPERIMENT_BUCKET_PERCENT",
+		0,
+		"The percentage of XDS connections tagged into the experiment bucket, from 0 to 100. Connections are "+
+			"bucketed deterministically by hashing their node ID; the others are in the control bucket. The bucket "+
+			"is shown on /debug/connections.",
+	).Get()
+
+	PushEventsBufferSize = env.RegisterIntVar(
+		"PILOT_PUSH_EVENTS_BUFFER_SIZE",
+		1000,
+		"The number of push events buffered for publishing to the push event sink. Events are dropped while the "+
+			"buffer is full, so pushes never wait on the sink.",
+	).Get()
+
+	MonitoringBindOptional = env.RegisterBoolVar(
+		"PILOT_MONITORING_BIND_OPTIONAL",
+		false,
+		"If enabled, istiod starts without the monitoring server when the monitoring address cannot be bound, "+
+			"rather than failing to start. Metrics are then not served, but XDS is.",
+	).Get()
+
+	InitialRequestTimeout = env.RegisterDurationVar(
+		"PILOT_INITIAL_REQUEST_TIMEOUT",
+		0,
+		"If set, an XDS connection that does not send its first request within this duration is closed, so "+
+			"idle connections do not hold on to connection slots. If 0, connections may wait indefinitely.",
+	).Get()
+
+	StrictNonceValidation = env.RegisterBoolVar(
+		"PILOT_STRICT_NONCE_VALIDATION",
+		false,
+		"If enabled, an XDS request carrying a nonce that was not sent since the last ACKed nonce of the type, such "+
+			"as a replayed older nonce, is rejected and the connection closed. Otherwise, it is ignored.",
+	).Get()
+
+	ValidateResourceNames = env.RegisterBoolVar(
+		"PILOT_VALIDATE_RESOURCE_NAMES",
+		false,
+		"If enabled, an XDS request naming a clearly invalid resource, such as a name with whitespace or a "+
+			"cluster name with an invalid port, is rejected with a descriptive error and the connection closed.",
+	).Get()
+
+	MeshConfigOverridesFile = env.RegisterStringVar(
+		"PILOT_MESH_CONFIG_OVERRIDES_FILE",
+		"",
+		"If set, the path of a YAML file listing mesh config overrides, each with a name, a selector on the node "+
+			"metadata labels of proxies, and a meshConfig merged over the mesh config. Config for proxies matching "+
+			"the selector of an override, the first one if several match, is generated with the merged mesh config. "+
+			"If empty, config for all proxies is generated with the mesh config.",
+	).Get()
+
+	MaxNodeMetadataBytes = env.RegisterIntVar(
+		"PILOT_MAX_NODE_METADATA_BYTES",
+		1024*1024,
+		"The maximum size in bytes of the node metadata sent by a proxy when it connects. Connections with larger "+
+			"metadata are rejected, bounding the memory held for each connection. A value of 0 disables the limit.",
+	).Get()
+
+	MaxDistinctNodes = env.RegisterIntVar(
+		"PILOT_MAX_DISTINCT_NODES",
+		0,
+		"The maximum number of distinct node IDs that may connect to this istiod within PILOT_DISTINCT_NODES_WINDOW. "+
+			"Connections from new node IDs beyond the limit are rejected, protecting against node ID churn. "+
+			"A value of 0 disables the limit.",
+	).Get()
+
+	DistinctNodesWindow = env.RegisterDurationVar(
+		"PILOT_DISTINCT_NODES_WINDOW",
+		time.Hour,
+		"The rolling window over which distinct node IDs are counted for PILOT_MAX_DISTINCT_NODES and the "+
+			"pilot_xds_distinct_nodes metric.",
+	).Get()
+
+	ReconnectReservedConnections = env.RegisterIntVar(
+		"PILOT_RECONNECT_RESERVED_XDS_CONNECTIONS",
+		0,
+		"The number of PILOT_MAX_XDS_CONNECTIONS slots reserved for proxies reconnecting within "+
+			"PILOT_RECONNECT_WINDOW of disconnecting. New proxies are rejected once only the reserved slots remain, "+
+			"so known proxies are preferentially readmitted after a reconnect storm. A value of 0 disables the reservation.",
+	).Get()
+
+	ReconnectWindow = env.RegisterDurationVar(
+		"PILOT_RECONNECT_WINDOW",
+		5*time.Minute,
+		"How long a disconnected proxy is considered to be reconnecting, for PILOT_RECONNECT_RESERVED_XDS_CONNECTIONS.",
+	).Get()
+
+	// PriorityConnectionNodes are the patterns of the node IDs of proxies which may exceed PILOT_MAX_XDS_CONNECTIONS,
+	// up to PriorityReservedConnections connections.
+	PriorityConnectionNodes = func() []string {
+		v := env.RegisterStringVar("PILOT_PRIORITY_XDS_CONNECTION_NODES", "",
+			"Comma separated list of patterns, as in path.Match, of the node IDs of proxies that may still connect "+
+				"once PILOT_MAX_XDS_CONNECTIONS is reached, up to PILOT_PRIORITY_RESERVED_XDS_CONNECTIONS additional "+
+				"connections. For example: router~*~istio-ingressgateway-*.").Get()
+		if v == "" {
+			return nil
+		}
+		patterns := strings.Split(v, ",")
+		for _, p := range patterns {
+			if _, err := path.Match(p, ""); err != nil {
+				log.Warnf("ignoring invalid PILOT_PRIORITY_XDS_CONNECTION_NODES: %q: %v", p, err)
+				return nil
+			}
+		}
+		return patterns
+	}()
+
+	PriorityReservedConnections = env.RegisterIntVar(
+		"PILOT_PRIORITY_RESERVED_XDS_CONNECTIONS",
+		0,
+		"The number of XDS connections beyond PILOT_MAX_XDS_CONNECTIONS reserved for the proxies matching "+
+			"PILOT_PRIORITY_XDS_CONNECTION_NODES, so critical proxies can connect when other proxies saturate the limit.",
+	).Get()
+
+	ValidationErrorFormat = ValidationErrorFormatType(env.RegisterStringVar(
+		"PILOT_VALIDATION_ERROR_FORMAT",
+		string(ValidationErrorPlain),
+		"The format of validation webhook errors for requests that cannot be processed, such as requests without a "+
+			"body. If plain, the error is a plain text message. If json, the error is a JSON object with code and message fields.",
+	).Get())
+
+	PushFairness = PushFairnessType(env.RegisterStringVar(
+		"PILOT_PUSH_FAIRNESS",
+		string(PushFairnessFIFO),
+		"The scheduling policy of the push queue. If fifo, proxies are pushed in the order they were queued. If fair, "+
+			"proxies that recently consumed more push time are scheduled after those that consumed less, so proxies with "+
+			"expensive pushes cannot delay pushes to many small proxies.",
+	).Get())
+
+	DiscoverSelfAddressFromService = env.RegisterBoolVar(
+		"PILOT_DISCOVER_SELF_ADDRESS_FROM_SERVICE",
+		false,
+		"If enabled, istiod looks up the LoadBalancer ingress of its Kubernetes Service, named after the discovery "+
+			"address host, and adds the advertised address to the SANs of its DNS certificate. If the lookup fails, "+
+			"only the configured discovery address is used.",
+	).Get()
+
+	MemoryPressureRejectThreshold = env.RegisterFloatVar(
+		"PILOT_MEMORY_PRESSURE_REJECT_THRESHOLD",
+		0,
+		"If set, the fraction of the cgroup memory limit above which new XDS connections are rejected, for "+
+			"example 0.9. Existing connections are preserved. A value of 0 disables the rejection.",
+	).Get()
+
+	UnauthorizedResourcePolicy = UnauthorizedResourcePolicyType(env.RegisterStringVar(
+		"PILOT_UNAUTHORIZED_RESOURCE_POLICY",
+		string(UnauthorizedResourceFilterSilent),
+		"Controls responses to proxies requesting resources they are not authorized for, such as secrets of another "+
+			"namespace. If filter-silent, the resources are left out of the response. If log-and-filter, they are also "+
+			"reported in the push log and the pilot_xds_unauthorized_resources metric. If deny, the request is rejected "+
+			"with a permission denied error, closing the stream.",
+	).Get())
+
+	StandbyMode = env.RegisterBoolVar(
+		"PILOT_STANDBY_MODE",
+		false,
+		"If enabled, istiod starts as a warm standby. It accepts connections and answers requests from the config "+
+			"computed when its caches synced, but does not recompute or push config on changes until promoted with a "+
+			"POST to /debug/promote.",
+	).Get()
+
+	ProxyErrorHistory = env.RegisterIntVar(
+		"PILOT_PROXY_ERROR_HISTORY",
+		10,
+		"The number of recent generation and push errors kept per node ID, served on "+
+			"/debug/connections/{id}/errors. Errors are forgotten an hour after the last error of the node. "+
+			"A value of 0 disables the tracking.",
+	).Get()
+
+	UnknownNamespacePolicy = UnknownNamespacePolicyType(env.RegisterStringVar(
+		"PILOT_UNKNOWN_NAMESPACE_POLICY",
+		string(UnknownNamespaceServe),
+		"Controls XDS connections from proxies whose node ID claims a namespace without any service in the registry, "+
+			"other than the mesh root namespace. If serve, config is served as for any other proxy. If reject, the "+
+			"connection is rejected with a permission denied error. If serve-empty, the connection is accepted, but every "+
+			"response has no resources.",
+	).Get())
+
+	EmptyCABundlePolicy = EmptyCABundlePolicyType(env.RegisterStringVar(
+		"PILOT_EMPTY_CA_BUNDLE_POLICY",
+		string(EmptyCABundleWarn),
+		"Controls startup when the secure gRPC server is enabled, but the CA bundle of the istiod certificate contains "+
+			"no certificate, so client certificates cannot be verified. If warn, a warning is logged. If fail, istiod "+
+			"fails to start.",
+	).Get())
+
+	DegradedModeConfig = DegradedModeConfigType(env.RegisterStringVar(
+		"PILOT_DEGRADED_MODE_CONFIG",
+		string(DegradedModeServeStale),
+		"Controls the config served while istiod is degraded by registry loss, see PILOT_DEGRADE_ON_REGISTRY_LOSS. "+
+			"If serve-stale, config changes are pushed as usual, computed from the last known registry state. If "+
+			"freeze-pushes, no changes are pushed to connected proxies, which keep their current config, while requests "+
+			"are still answered. A full push is triggered once the registry is reachable again.",
+	).Get())
+
+	MaxFileRegistryResources = env.RegisterIntVar(
+		"PILOT_MAX_FILE_REGISTRY_RESOURCES",
+		0,
+		"If set, the maximum number of resources loaded from the file registry. A load exceeding it is rejected, "+
+			"and the previously loaded config is kept. If 0, the number of resources is unbounded.",
+	).Get()
+
+	FileRegistryCoalesceWindow = env.RegisterDurationVar(
+		"PILOT_FILE_REGISTRY_COALESCE_WINDOW",
+		time.Second,
+		"The maximum time writes to the file registry are coalesced before the files are reloaded, even if writes "+
+			"are ongoing. If 0, writes are coalesced until they stop.",
+	).Get()
+
+	MaxWatchedFiles = env.RegisterIntVar(
+		"PILOT_MAX_WATCHED_FILES",
+		10000,
+		"The number of files in the file registry above which they are polled for changes, in addition to the "+
+			"watch of the root directory, so changes in subdirectories of large registries are seen. If 0, files "+
+			"are never polled.",
+	).Get()
+
+	FileReloadQPS = env.RegisterFloatVar(
+		"PILOT_FILE_RELOAD_QPS",
+		10,
+		"The maximum rate of full reloads of the file registry, per second. Changes made while a reload is "+
+			"throttled are coalesced into the next reload. If 0, reloads are not rate limited.",
+	).Get()
+
+	EnableProxyConvergenceMetric = env.RegisterBoolVar(
+		"PILOT_ENABLE_PROXY_CONVERGENCE_METRIC",
+		true,
+		"If enabled, the delay between a config change and each proxy acking the resulting push is recorded "+
+			"in the pilot_proxy_convergence_seconds metric.",
+	).Get()
+
+	GOAWAYGrace = env.RegisterDurationVar(
+		"PILOT_GOAWAY_GRACE",
+		0,
+		"If set, when istiod shuts down, XDS streams are closed this long after GOAWAY is sent, so proxies complete "+
+			"in flight exchanges and reconnect to another instance. It should be shorter than the shutdown duration, "+
+			"after which the servers are forcibly stopped. If 0, XDS streams are kept until the shutdown duration.",
+	).Get()
+
+	SuppressNoOpPushes = env.RegisterBoolVar(
+		"PILOT_SUPPRESS_NOOP_PUSHES",
+		false,
+		"If enabled, a push triggered by a config change is skipped for a type when the resources generated for the "+
+			"proxy are identical to those last pushed.",
+	).Get()
+
+	PushHashAlgorithm = PushHashAlgorithmType(env.RegisterStringVar(
+		"PILOT_PUSH_HASH_ALGORITHM",
+		string(PushHashXXHash),
+		"The hash algorithm comparing pushed resources for PILOT_SUPPRESS_NOOP_PUSHES. If xxhash, a fast "+
+			"non-cryptographic hash is used. If sha256, a slower hash resistant to collisions is used.",
+	).Get())
+
+	PushLatencyExemplars = env.RegisterBoolVar(
+		"PILOT_PUSH_LATENCY_EXEMPLARS",
+		false,
+		"If enabled, pilot_xds_push_time samples carry Prometheus exemplars with the proxy ID and, when the "+
+			"stream has a sampled OpenCensus span, its trace ID. Exemplars are only exposed in the OpenMetrics format.",
+	).Get()
+
+	// XDSPushOrder is the order resource types are pushed in within a push. Types not listed are pushed after the
+	// listed types, in no particular order.
+	XDSPushOrder = strings.Split(env.RegisterStringVar(
+		"PILOT_XDS_PUSH_ORDER",
+		"cds,eds,lds,rds,sds",
+		"Comma separated list of the order resource types are pushed in within a push, as short type names such as "+
+			"cds, or type URLs. Types not listed are pushed after the listed types, in no particular order.",
+	).Get(), ",")
+
+	EnableXDSCompression = env.RegisterBoolVar(
+		"PILOT_ENABLE_XDS_COMPRESSION",
+		false,
+		"If enabled, gzip compressed requests are accepted, and responses on such streams are compressed.",
+	).Get()
+
+	XDSCompressionMinBytes = env.RegisterIntVar(
+		"PILOT_XDS_COMPRESSION_MIN_BYTES",
+		1024,
+		"The size in bytes below which responses are sent uncompressed when PILOT_ENABLE_XDS_COMPRESSION is "+
+			"enabled, avoiding the CPU cost of compressing small messages.",
+	).Get()
+
+	EnableRESTXDS = env.RegisterBoolVar(
+		"PILOT_ENABLE_REST_XDS",
+		false,
+		"If enabled, XDS resources are also served over the REST-JSON variant of the XDS protocol on the HTTP port, "+
+			"for clients that cannot use gRPC. Requests must carry credentials accepted by the XDS authenticators, "+
+			"such as a Kubernetes service account token, and are subject to the same checks as gRPC connections.",
+	).Get()
+
 	// MaxRecvMsgSize The max receive buffer size of gRPC received channel of Pilot in bytes.
 	MaxRecvMsgSize = env.RegisterIntVar(
 		"ISTIO_GPRC_MAXRECVMSGSIZE",
@@ -256,6 +865,51 @@ var (
 	PilotCertProvider = env.RegisterStringVar("PILOT_CERT_PROVIDER", constants.CertProviderIstiod,
 		"The provider of Pilot DNS certificate.")
 
+	// PilotCertProviders is a prioritized list of providers of the Pilot DNS certificate. If set, the first provider
+	// yielding a certificate is used, instead of PilotCertProvider.
+	PilotCertProviders = func() []string {
+		v := env.RegisterStringVar("PILOT_CERT_PROVIDERS", "",
+			"Comma separated, prioritized list of providers of the Pilot DNS certificate, from file, kubernetes, istiod, "+
+				"custom and none. The first provider yielding a certificate is used. If set, PILOT_CERT_PROVIDER is ignored "+
+				"for the Pilot DNS certificate.").Get()
+		if v == "" {
+			return nil
+		}
+		return strings.Split(v, ",")
+	}()
+
+	// AllowedNodeMetadataKeys, if set, is the list of node metadata keys retained in addition to those known to
+	// istiod. Other keys sent by proxies are dropped.
+	AllowedNodeMetadataKeys = func() []string {
+		v := env.RegisterStringVar("PILOT_ALLOWED_NODE_METADATA_KEYS", "",
+			"Comma separated list of node metadata keys retained in addition to those known to istiod. If set, other "+
+				"node metadata keys sent by proxies are dropped, reducing the memory used per connection. If empty, all "+
+				"keys are retained.").Get()
+		if v == "" {
+			return nil
+		}
+		return strings.Split(v, ",")
+	}()
+
+	EnableV2Compat = env.RegisterBoolVar(
+		"PILOT_ENABLE_V2_COMPAT",
+		false,
+		"If enabled, requests for the legacy v2 type URLs listed in PILOT_V2_COMPAT_TYPES are served the equivalent "+
+			"v3 resources, so older proxies keep working during migration.",
+	).Get()
+
+	// V2CompatTypes is the list of legacy v2 type URLs translated to v3 when EnableV2Compat is set. If empty, all
+	// known legacy type URLs are translated.
+	V2CompatTypes = func() []string {
+		v := env.RegisterStringVar("PILOT_V2_COMPAT_TYPES", "",
+			"Comma separated list of legacy v2 type URLs translated to their v3 equivalents when PILOT_ENABLE_V2_COMPAT "+
+				"is set. If empty, all known legacy type URLs are translated.").Get()
+		if v == "" {
+			return nil
+		}
+		return strings.Split(v, ",")
+	}()
+
 	JwtPolicy = env.RegisterStringVar("JWT_POLICY", jwt.PolicyThirdParty,
 		"The JWT validation policy.")
 
@@ -271,6 +925,20 @@ var (
 		return durationpb.New(defaultRequestTimeoutVar.Get())
 	}()
 
+	EnableMeshStateAPI = env.RegisterBoolVar(
+		"PILOT_ENABLE_MESH_STATE_API",
+		false,
+		"If enabled, istiod serves a read-only JSON API on the monitoring port at /api/v1/meshstate, listing the "+
+			"services and endpoints of its registries, and the registry each comes from.",
+	).Get()
+
+	TolerateMissingRBAC = env.RegisterBoolVar(
+		"PILOT_TOLERATE_MISSING_RBAC",
+		false,
+		"If enabled, Istio config types istiod is forbidden to list or watch are skipped with a warning, instead of "+
+			"blocking istiod from syncing.",
+	).Get()
+
 	EnableServiceApis = env.RegisterBoolVar("PILOT_ENABLED_SERVICE_APIS", true,
 		"If this is set to true, support for Kubernetes gateway-api (github.com/kubernetes-sigs/gateway-api) will "+
 			" be enabled. In addition to this being enabled, the gateway-api CRDs need to be installed.").Get()
@@ -333,6 +1001,14 @@ var (
 	XDSCacheMaxSize = env.RegisterIntVar("PILOT_XDS_CACHE_SIZE", 20000,
 		"The maximum number of cache entries for the XDS cache.").Get()
 
+	XDSCacheCompactionInterval = env.RegisterDurationVar("PILOT_XDS_CACHE_COMPACTION_INTERVAL", 0,
+		"If set, the XDS cache is periodically compacted at this interval, removing entries for services that are no "+
+			"longer in the current push context. If 0, the cache is not compacted.").Get()
+
+	PushStalenessInterval = env.RegisterDurationVar("PILOT_PUSH_STALENESS_INTERVAL", 0,
+		"If set, the pilot_xds_max_push_staleness_seconds gauge, the longest time any connected proxy has gone "+
+			"without a successful push, is updated at this interval. If 0, the gauge is not exported.").Get()
+
 	// EnableLegacyFSGroupInjection has first-party-jwt as allowed because we only
 	// need the fsGroup configuration for the projected service account volume mount,
 	// which is only used by first-party-jwt. The installer will automatically
@@ -471,7 +1147,165 @@ var (
 		"If true, routes will use the target port of the gateway service in the route name, not the service port.").Get()
 )
 
+// EmptyEDSPolicyType is the policy for EDS responses to clusters without endpoints.
+type EmptyEDSPolicyType string
+
+const (
+	// EmptyEDSSendEmpty sends an assignment with no endpoints.
+	EmptyEDSSendEmpty EmptyEDSPolicyType = "send-empty"
+	// EmptyEDSOmit leaves the cluster out of the response.
+	EmptyEDSOmit EmptyEDSPolicyType = "omit"
+)
+
+// PushFairnessType is the scheduling policy of the push queue.
+type PushFairnessType string
+
+const (
+	// PushFairnessFIFO pushes proxies in the order they were queued.
+	PushFairnessFIFO PushFairnessType = "fifo"
+	// PushFairnessFair pushes proxies in order of the push time they consumed.
+	PushFairnessFair PushFairnessType = "fair"
+)
+
+// UnauthorizedResourcePolicyType is the policy for requests for resources a proxy is not authorized for.
+type UnauthorizedResourcePolicyType string
+
+const (
+	// UnauthorizedResourceFilterSilent leaves unauthorized resources out of the response.
+	UnauthorizedResourceFilterSilent UnauthorizedResourcePolicyType = "filter-silent"
+	// UnauthorizedResourceLogAndFilter leaves unauthorized resources out of the response, and reports them.
+	UnauthorizedResourceLogAndFilter UnauthorizedResourcePolicyType = "log-and-filter"
+	// UnauthorizedResourceDeny rejects requests for unauthorized resources.
+	UnauthorizedResourceDeny UnauthorizedResourcePolicyType = "deny"
+)
+
+// PushHashAlgorithmType is the hash algorithm comparing pushed resources.
+type PushHashAlgorithmType string
+
+const (
+	// PushHashXXHash hashes with xxhash.
+	PushHashXXHash PushHashAlgorithmType = "xxhash"
+	// PushHashSHA256 hashes with SHA-256.
+	PushHashSHA256 PushHashAlgorithmType = "sha256"
+)
+
+// UnknownNamespacePolicyType is the policy for proxies claiming a namespace unknown to the registry.
+type UnknownNamespacePolicyType string
+
+const (
+	// UnknownNamespaceServe serves config as usual.
+	UnknownNamespaceServe UnknownNamespacePolicyType = "serve"
+	// UnknownNamespaceReject rejects the connection.
+	UnknownNamespaceReject UnknownNamespacePolicyType = "reject"
+	// UnknownNamespaceServeEmpty responds without any resources.
+	UnknownNamespaceServeEmpty UnknownNamespacePolicyType = "serve-empty"
+)
+
+// EmptyCABundlePolicyType is the policy for an istiod certificate without a CA bundle.
+type EmptyCABundlePolicyType string
+
+const (
+	// EmptyCABundleWarn logs a warning.
+	EmptyCABundleWarn EmptyCABundlePolicyType = "warn"
+	// EmptyCABundleFail fails startup.
+	EmptyCABundleFail EmptyCABundlePolicyType = "fail"
+)
+
+// DegradedModeConfigType is the policy for config served while istiod is degraded.
+type DegradedModeConfigType string
+
+const (
+	// DegradedModeServeStale keeps pushing config computed from the last known registry state.
+	DegradedModeServeStale DegradedModeConfigType = "serve-stale"
+	// DegradedModeFreezePushes stops pushes to connected proxies.
+	DegradedModeFreezePushes DegradedModeConfigType = "freeze-pushes"
+)
+
+// ValidationErrorFormatType is the format of validation webhook errors.
+type ValidationErrorFormatType string
+
+const (
+	// ValidationErrorPlain writes errors as plain text.
+	ValidationErrorPlain ValidationErrorFormatType = "plain"
+	// ValidationErrorJSON writes errors as a JSON object with code and message fields.
+	ValidationErrorJSON ValidationErrorFormatType = "json"
+)
+
 // UnsafeFeaturesEnabled returns true if any unsafe features are enabled.
 func UnsafeFeaturesEnabled() bool {
 	return EnableUnsafeAdminEndpoints || EnableUnsafeAssertions
 }
+
+// ParseDurations parses a comma separated list of key=duration pairs, such as "kube-client=1m,oidc=30s".
+func ParseDurations(s string) (map[string]time.Duration, error) {
+	if s == "" {
+		return nil, nil
+	}
+	durations := map[string]time.Duration{}
+	for _, kv := range strings.Split(s, ",") {
+		kv = strings.TrimSpace(kv)
+		if kv == "" {
+			continue
+		}
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid entry %q, expected key=duration", kv)
+		}
+		d, err := time.ParseDuration(parts[1])
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("invalid duration for %q: %q", parts[0], parts[1])
+		}
+		durations[parts[0]] = d
+	}
+	return durations, nil
+}
+
+// ParseLimits parses a comma separated list of key=limit pairs, such as "us-east1=500,us-west1=100".
+func ParseLimits(s string) (map[string]int, error) {
+	if s == "" {
+		return nil, nil
+	}
+	limits := map[string]int{}
+	for _, kv := range strings.Split(s, ",") {
+		kv = strings.TrimSpace(kv)
+		if kv == "" {
+			continue
+		}
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid entry %q, expected key=limit", kv)
+		}
+		limit, err := strconv.Atoi(parts[1])
+		if err != nil || limit < 0 {
+			return nil, fmt.Errorf("invalid limit for %q: %q", parts[0], parts[1])
+		}
+		limits[parts[0]] = limit
+	}
+	return limits, nil
+}
+
+// ParseInheritedListeners parses PILOT_INHERITED_LISTENERS, a comma separated list of listener=fd pairs, such as
+// "grpc=3,http=4". File descriptors 0 to 2 are the standard streams, and cannot be listeners.
+func ParseInheritedListeners(s string) (map[string]int, error) {
+	if s == "" {
+		return nil, nil
+	}
+	fds := map[string]int{}
+	for _, kv := range strings.Split(s, ",") {
+		kv = strings.TrimSpace(kv)
+		if kv == "" {
+			continue
+		}
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid PILOT_INHERITED_LISTENERS entry %q, expected listener=fd", kv)
+		}
+		fd, err := strconv.Atoi(parts[1])
+		if err != nil || fd < 3 {
+			return nil, fmt.Errorf("invalid PILOT_INHERITED_LISTENERS fd for %q: %q, expected a file descriptor of 3 "+
+				"or more", parts[0], parts[1])
+		}
+		fds[parts[0]] = fd
+	}
+	return fds, nil
+}
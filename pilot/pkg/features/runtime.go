@@ -0,0 +1,208 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package features
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"sigs.k8s.io/yaml"
+
+	"istio.io/pkg/env"
+	"istio.io/pkg/log"
+)
+
+var RuntimeFeaturesFile = env.RegisterStringVar(
+	"PILOT_RUNTIME_FEATURES_FILE",
+	"",
+	"If set, a watched YAML file mapping feature environment variable names to values, overriding runtime-safe "+
+		"features without restarting istiod. Currently "+strings.Join(runtimeFeatureNames(), ", ")+" may be "+
+		"overridden; other features are ignored. Features removed from the file revert to their startup value.",
+).Get()
+
+// runtimeFeatureNames returns the sorted names of the features that may be overridden by RuntimeFeaturesFile.
+func runtimeFeatureNames() []string {
+	names := make([]string, 0, len(runtimeFeatures))
+	for name := range runtimeFeatures {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// runtimeFeature is a feature that is safe to change while istiod is running.
+type runtimeFeature struct {
+	// parse parses a value for the feature, returning a function applying it.
+	parse func(value string) (func(), error)
+	// reset restores the startup value of the feature.
+	reset func()
+	// get formats the current value of the feature.
+	get func() string
+}
+
+var (
+	runtimeMu       sync.Mutex
+	runtimeHandlers = map[int]func(){}
+	runtimeHandlerN int
+
+	// runtimeFeatures are the features that may be overridden by RuntimeFeaturesFile, keyed by environment variable name.
+	// Consumers of these features must register a handler with OnRuntimeFeaturesChange to pick up changes.
+	runtimeFeatures = map[string]runtimeFeature{
+		"PILOT_MAX_XDS_CONNECTIONS":              runtimeInt(&ConnectionLimit),
+		"PILOT_REGION_XDS_CONNECTION_LIMITS":     runtimeLimits(&RegionConnectionLimits),
+		"PILOT_PROXY_TYPE_XDS_CONNECTION_LIMITS": runtimeLimits(&ProxyTypeConnectionLimits),
+	}
+)
+
+func runtimeInt(v *int) runtimeFeature {
+	initial := *v
+	return runtimeFeature{
+		parse: func(value string) (func(), error) {
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, err
+			}
+			return func() { *v = n }, nil
+		},
+		reset: func() { *v = initial },
+		get:   func() string { return strconv.Itoa(*v) },
+	}
+}
+
+func runtimeLimits(v *map[string]int) runtimeFeature {
+	initial := *v
+	return runtimeFeature{
+		parse: func(value string) (func(), error) {
+			limits, err := ParseLimits(value)
+			if err != nil {
+				return nil, err
+			}
+			return func() { *v = limits }, nil
+		},
+		reset: func() { *v = initial },
+		get:   func() string { return formatLimits(*v) },
+	}
+}
+
+// formatLimits formats limits in the format parsed by ParseLimits, sorted by key.
+func formatLimits(limits map[string]int) string {
+	entries := make([]string, 0, len(limits))
+	for k, limit := range limits {
+		entries = append(entries, k+"="+strconv.Itoa(limit))
+	}
+	sort.Strings(entries)
+	return strings.Join(entries, ",")
+}
+
+// EffectiveValues returns the effective values of all registered features, keyed by environment variable name.
+// Runtime-safe features report their current value, including overrides from RuntimeFeaturesFile.
+func EffectiveValues() map[string]string {
+	values := map[string]string{}
+	for _, v := range env.VarDescriptions() {
+		if value, f := os.LookupEnv(v.Name); f {
+			values[v.Name] = value
+		} else {
+			values[v.Name] = v.DefaultValue
+		}
+	}
+	runtimeMu.Lock()
+	defer runtimeMu.Unlock()
+	for name, rf := range runtimeFeatures {
+		values[name] = rf.get()
+	}
+	return values
+}
+
+// OnRuntimeFeaturesChange registers a handler called, with the runtime features locked, on registration and each
+// time runtime features are overridden. The returned function unregisters the handler.
+func OnRuntimeFeaturesChange(handler func()) func() {
+	runtimeMu.Lock()
+	defer runtimeMu.Unlock()
+	id := runtimeHandlerN
+	runtimeHandlerN++
+	runtimeHandlers[id] = handler
+	handler()
+	return func() {
+		runtimeMu.Lock()
+		defer runtimeMu.Unlock()
+		delete(runtimeHandlers, id)
+	}
+}
+
+// LoadRuntimeFeatures reads overrides of runtime-safe features from file, and notifies the registered handlers.
+// Features that are not runtime-safe are ignored. On error, no feature is changed.
+func LoadRuntimeFeatures(file string) error {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	raw := map[string]interface{}{}
+	if err := yaml.Unmarshal(b, &raw); err != nil {
+		return fmt.Errorf("failed to parse runtime features: %v", err)
+	}
+	overrides := make(map[string]string, len(raw))
+	for k, v := range raw {
+		overrides[k] = fmt.Sprint(v)
+	}
+	return ApplyRuntimeFeatures(overrides)
+}
+
+// ApplyRuntimeFeatures overrides runtime-safe features, keyed by environment variable name, and notifies the
+// registered handlers. Runtime-safe features not present revert to their startup value. On error, no feature is changed.
+func ApplyRuntimeFeatures(overrides map[string]string) error {
+	runtimeMu.Lock()
+	defer runtimeMu.Unlock()
+
+	var ignored []string
+	for name := range overrides {
+		if _, f := runtimeFeatures[name]; !f {
+			ignored = append(ignored, name)
+		}
+	}
+	if len(ignored) > 0 {
+		sort.Strings(ignored)
+		log.Warnf("ignoring overrides of features that cannot be changed at runtime: %v", ignored)
+	}
+
+	// Parse all values first, so invalid overrides are not partially applied.
+	apply := map[string]func(){}
+	for name, value := range overrides {
+		rf, f := runtimeFeatures[name]
+		if !f {
+			continue
+		}
+		set, err := rf.parse(value)
+		if err != nil {
+			return fmt.Errorf("invalid value %q for %v: %v", value, name, err)
+		}
+		apply[name] = set
+	}
+	for name, rf := range runtimeFeatures {
+		if set, f := apply[name]; f {
+			set()
+		} else {
+			rf.reset()
+		}
+	}
+	for _, h := range runtimeHandlers {
+		h()
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpc
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+
+	"google.golang.org/grpc/encoding"
+
+	"istio.io/istio/pilot/pkg/features"
+)
+
+func init() {
+	if features.EnableXDSCompression {
+		encoding.RegisterCompressor(&thresholdCompressor{minBytes: features.XDSCompressionMinBytes})
+	}
+}
+
+// thresholdCompressor is a gzip compressor that does not spend CPU compressing messages smaller than minBytes.
+// gRPC compresses responses with the encoding of the request, so it applies to clients compressing their requests.
+type thresholdCompressor struct {
+	minBytes int
+}
+
+var _ encoding.Compressor = &thresholdCompressor{}
+
+// Name implements encoding.Compressor.
+func (c *thresholdCompressor) Name() string {
+	return "gzip"
+}
+
+// Compress implements encoding.Compressor. The message is buffered, so the compression level can be chosen from its
+// size once it is complete.
+func (c *thresholdCompressor) Compress(w io.Writer) (io.WriteCloser, error) {
+	return &thresholdWriter{w: w, minBytes: c.minBytes}, nil
+}
+
+// Decompress implements encoding.Compressor.
+func (c *thresholdCompressor) Decompress(r io.Reader) (io.Reader, error) {
+	return gzip.NewReader(r)
+}
+
+type thresholdWriter struct {
+	w        io.Writer
+	minBytes int
+	buf      bytes.Buffer
+}
+
+func (t *thresholdWriter) Write(p []byte) (int, error) {
+	return t.buf.Write(p)
+}
+
+// Close writes the buffered message. Messages smaller than minBytes are stored without compression, which
+// any gzip reader can read.
+func (t *thresholdWriter) Close() error {
+	level := gzip.DefaultCompression
+	if t.buf.Len() < t.minBytes {
+		level = gzip.NoCompression
+	}
+	z, err := gzip.NewWriterLevel(t.w, level)
+	if err != nil {
+		return err
+	}
+	if _, err := z.Write(t.buf.Bytes()); err != nil {
+		return err
+	}
+	return z.Close()
+}
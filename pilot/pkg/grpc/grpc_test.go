@@ -15,7 +15,9 @@
 package grpc
 
 import (
+	"bytes"
 	"errors"
+	"io/ioutil"
 	"testing"
 )
 
@@ -25,3 +27,42 @@ func TestIsExpectedGRPCError(t *testing.T) {
 		t.Fatalf("expected true, got %v", got)
 	}
 }
+
+func TestThresholdCompressor(t *testing.T) {
+	c := &thresholdCompressor{minBytes: 1024}
+	compress := func(in []byte) []byte {
+		t.Helper()
+		out := &bytes.Buffer{}
+		w, err := c.Compress(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(in); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		r, err := c.Decompress(bytes.NewReader(out.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, in) {
+			t.Fatalf("message changed by compression")
+		}
+		return out.Bytes()
+	}
+
+	small := bytes.Repeat([]byte("a"), 512)
+	if out := compress(small); len(out) <= len(small) {
+		t.Fatalf("expected small message to be stored uncompressed, got %d bytes from %d", len(out), len(small))
+	}
+	large := bytes.Repeat([]byte("a"), 4096)
+	if out := compress(large); len(out) >= len(large)/10 {
+		t.Fatalf("expected large message to be compressed, got %d bytes from %d", len(out), len(large))
+	}
+}
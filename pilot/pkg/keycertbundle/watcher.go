@@ -109,3 +109,10 @@ func (w *Watcher) GetCABundle() []byte {
 	defer w.mutex.Unlock()
 	return w.bundle.CABundle
 }
+
+// GetKeyCertBundle returns the bundle.
+func (w *Watcher) GetKeyCertBundle() KeyCertBundle {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.bundle
+}
@@ -36,6 +36,14 @@ const (
 	IngressController = "istio-leader"
 	StatusController  = "istio-status-leader"
 	AnalyzeController = "istio-analyze-leader"
+	// RootCertRotatorController gates the self-signed root cert rotation, if leader election of singletons is enabled.
+	RootCertRotatorController = "istio-root-cert-rotator-leader"
+	// WebhookCertController gates the Kubernetes signed webhook certificate controller, if leader election of
+	// singletons is enabled.
+	WebhookCertController = "istio-webhook-cert-controller-leader"
+	// ValidationController gates the patching of the validating webhook configuration, if leader election of
+	// singletons is enabled.
+	ValidationController = "istio-validation-controller-election"
 )
 
 type LeaderElection struct {
@@ -324,6 +324,10 @@ type WatchedResource struct {
 	// LastSent tracks the time of the generated push, to determine the time it takes the client to ack.
 	LastSent time.Time
 
+	// ChangeTime is the time of the config change that triggered the last sent response, to measure the time
+	// until the client acks it. It is zero if the response was not triggered by a config change, or once acked.
+	ChangeTime time.Time
+
 	// Updates count the number of generated updates for the resource
 	Updates int
 
@@ -190,6 +190,13 @@ type PushContext struct {
 	// Mesh configuration for the mesh.
 	Mesh *meshconfig.MeshConfig `json:"-"`
 
+	// MeshOverride is the name of the mesh config override this push context is computed with, or empty if it
+	// is computed with the mesh config of the environment.
+	MeshOverride string `json:"-"`
+
+	// MeshOverrides holds the push contexts computed with each mesh config override, keyed by name.
+	MeshOverrides map[string]*PushContext `json:"-"`
+
 	// PushVersion describes the push version this push context was computed for
 	PushVersion string
 
@@ -295,6 +302,10 @@ type PushRequest struct {
 	// Note that this does not include time spent debouncing.
 	Start time.Time
 
+	// ChangeTime is the time the earliest config change in this request was received. Unlike Start, this
+	// includes time spent debouncing. It is zero if the push was not triggered by a config change.
+	ChangeTime time.Time
+
 	// Reason represents the reason for requesting a push. This should only be a fixed set of values,
 	// to avoid unbounded cardinality in metrics. If this is not set, it may be automatically filled in later.
 	// There should only be multiple reasons if the push request is the result of two distinct triggers, rather than
@@ -327,6 +338,14 @@ const (
 	ProxyRequest TriggerReason = "proxyrequest"
 )
 
+// earliest returns the earlier of two times, ignoring zero times.
+func earliest(a, b time.Time) time.Time {
+	if a.IsZero() || (!b.IsZero() && b.Before(a)) {
+		return b
+	}
+	return a
+}
+
 // Merge two update requests together
 func (pr *PushRequest) Merge(other *PushRequest) *PushRequest {
 	if pr == nil {
@@ -342,6 +361,8 @@ func (pr *PushRequest) Merge(other *PushRequest) *PushRequest {
 	merged := &PushRequest{
 		// Keep the first (older) start time
 		Start: pr.Start,
+		// Keep the earliest change time
+		ChangeTime: earliest(pr.ChangeTime, other.ChangeTime),
 
 		// If either is full we need a full push
 		Full: pr.Full || other.Full,
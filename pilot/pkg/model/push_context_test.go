@@ -114,6 +114,18 @@ func TestMergeUpdateRequest(t *testing.T) {
 			}: {}}},
 			PushRequest{Full: true, ConfigsUpdated: nil, Reason: []TriggerReason{}},
 		},
+		{
+			"earliest change time",
+			&PushRequest{Full: true, ChangeTime: t1},
+			&PushRequest{Full: true, ChangeTime: t1.Add(-time.Second)},
+			PushRequest{Full: true, ChangeTime: t1.Add(-time.Second), Reason: []TriggerReason{}},
+		},
+		{
+			"change time one empty",
+			&PushRequest{Full: true, ChangeTime: t1},
+			&PushRequest{Full: true},
+			PushRequest{Full: true, ChangeTime: t1, Reason: []TriggerReason{}},
+		},
 	}
 
 	for _, tt := range cases {
@@ -16,6 +16,7 @@ package model
 
 import (
 	"fmt"
+	"strings"
 	"sync"
 
 	discovery "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
@@ -142,8 +143,13 @@ type XdsCache interface {
 	Clear(map[ConfigKey]struct{})
 	// ClearAll clears the entire cache.
 	ClearAll()
+	// Compact removes the cache entries that are dependent on any config for which keep returns false.
+	// It returns the number of entries removed.
+	Compact(keep func(ConfigKey) bool) int
 	// Keys returns all currently configured keys. This is for testing/debug only
 	Keys() []string
+	// SizeBytes returns the approximate number of bytes held by the cached resources.
+	SizeBytes() int
 }
 
 // NewXdsCache returns an instance of a cache.
@@ -168,6 +174,48 @@ func NewLenientXdsCache() XdsCache {
 	}
 }
 
+// NewRevisionXdsCache returns a view of cache isolating the entries of revision, so they never collide with the
+// entries of other revisions sharing the cache. Clearing and compaction still apply to all revisions.
+func NewRevisionXdsCache(cache XdsCache, revision string) XdsCache {
+	return &revisionCache{XdsCache: cache, prefix: "revision/" + revision + "/"}
+}
+
+type revisionCache struct {
+	XdsCache
+	prefix string
+}
+
+var _ XdsCache = &revisionCache{}
+
+// revisionEntry is a cache entry keyed within a revision.
+type revisionEntry struct {
+	XdsCacheEntry
+	prefix string
+}
+
+func (e revisionEntry) Key() string {
+	return e.prefix + e.XdsCacheEntry.Key()
+}
+
+func (r *revisionCache) Add(entry XdsCacheEntry, token CacheToken, value *discovery.Resource) {
+	r.XdsCache.Add(revisionEntry{XdsCacheEntry: entry, prefix: r.prefix}, token, value)
+}
+
+func (r *revisionCache) Get(entry XdsCacheEntry) (*discovery.Resource, CacheToken, bool) {
+	return r.XdsCache.Get(revisionEntry{XdsCacheEntry: entry, prefix: r.prefix})
+}
+
+// Keys returns the keys of the entries of the revision.
+func (r *revisionCache) Keys() []string {
+	var keys []string
+	for _, k := range r.XdsCache.Keys() {
+		if strings.HasPrefix(k, r.prefix) {
+			keys = append(keys, strings.TrimPrefix(k, r.prefix))
+		}
+	}
+	return keys
+}
+
 type lruCache struct {
 	enableAssertions bool
 	store            simplelru.LRUCache
@@ -306,6 +354,41 @@ func (l *lruCache) ClearAll() {
 	size(l.store.Len())
 }
 
+func (l *lruCache) Compact(keep func(ConfigKey) bool) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	removed := 0
+	for ckey, referenced := range l.configIndex {
+		if keep(ckey) {
+			continue
+		}
+		delete(l.configIndex, ckey)
+		for key := range referenced {
+			if l.store.Remove(key) {
+				removed++
+			}
+		}
+	}
+	size(l.store.Len())
+	return removed
+}
+
+func (l *lruCache) SizeBytes() int {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	size := 0
+	for _, k := range l.store.Keys() {
+		v, f := l.store.Peek(k)
+		if !f {
+			continue
+		}
+		if res := v.(cacheValue).value; res != nil {
+			size += len(res.Name) + len(res.GetResource().GetValue())
+		}
+	}
+	return size
+}
+
 func (l *lruCache) Keys() []string {
 	l.mu.RLock()
 	defer l.mu.RUnlock()
@@ -332,4 +415,8 @@ func (d DisabledCache) Clear(configsUpdated map[ConfigKey]struct{}) {}
 
 func (d DisabledCache) ClearAll() {}
 
+func (d DisabledCache) Compact(func(ConfigKey) bool) int { return 0 }
+
 func (d DisabledCache) Keys() []string { return nil }
+
+func (d DisabledCache) SizeBytes() int { return 0 }
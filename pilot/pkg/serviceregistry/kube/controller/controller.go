@@ -140,6 +140,10 @@ type Options struct {
 
 	// If meshConfig.DiscoverySelectors are specified, the DiscoveryNamespacesFilter tracks the namespaces this controller watches.
 	DiscoveryNamespacesFilter filter.DiscoveryNamespacesFilter
+
+	// ExcludedNamespaces are namespaces whose objects are ignored by the controller, even if they are selected
+	// by the DiscoveryNamespacesFilter.
+	ExcludedNamespaces []string
 }
 
 func (o Options) GetSyncInterval() time.Duration {
@@ -317,6 +321,7 @@ func NewController(kubeClient kubelib.Client, options Options) *Controller {
 	if c.discoveryNamespacesFilter == nil {
 		c.discoveryNamespacesFilter = filter.NewDiscoveryNamespacesFilter(c.nsLister, options.MeshWatcher.Mesh().DiscoverySelectors)
 	}
+	c.discoveryNamespacesFilter = filter.NewExcludedNamespacesFilter(c.discoveryNamespacesFilter, options.ExcludedNamespaces)
 
 	c.initDiscoveryHandlers(kubeClient, options.EndpointMode, options.MeshWatcher, c.discoveryNamespacesFilter)
 
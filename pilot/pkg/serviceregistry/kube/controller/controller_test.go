@@ -2102,3 +2102,98 @@ func TestKubeEndpointsControllerOnEvent(t *testing.T) {
 		})
 	}
 }
+
+func TestController_ServiceWithExcludedNamespaces(t *testing.T) {
+	svc1 := &model.Service{
+		Hostname: kube.ServiceHostname("svc1", "nsA", defaultFakeDomainSuffix),
+		Address:  "10.0.0.1",
+		Ports: model.PortList{
+			&model.Port{
+				Name:     "tcp-port",
+				Port:     8080,
+				Protocol: protocol.TCP,
+			},
+		},
+	}
+
+	svc3 := &model.Service{
+		Hostname: kube.ServiceHostname("svc3", "nsA", defaultFakeDomainSuffix),
+		Address:  "10.0.0.1",
+		Ports: model.PortList{
+			&model.Port{
+				Name:     "tcp-port",
+				Port:     8082,
+				Protocol: protocol.TCP,
+			},
+		},
+	}
+
+	cases := []struct {
+		name      string
+		selectors []*metaV1.LabelSelector
+	}{
+		{
+			name: "all namespaces",
+		},
+		{
+			name: "excluded namespace selected for discovery",
+			selectors: []*metaV1.LabelSelector{{
+				MatchLabels: map[string]string{"pilot-discovery": "enabled"},
+			}},
+		},
+	}
+	for _, c := range cases {
+		for mode, name := range EndpointModeNames {
+			mode := mode
+			t.Run(c.name+"/"+name, func(t *testing.T) {
+				controller, fx := NewFakeControllerWithOptions(FakeControllerOptions{
+					Mode:               mode,
+					MeshWatcher:        mesh.NewFixedWatcher(&meshconfig.MeshConfig{DiscoverySelectors: c.selectors}),
+					ExcludedNamespaces: []string{"nsB"},
+				})
+				defer controller.Stop()
+
+				createNamespace(t, controller.client, "nsA", map[string]string{"pilot-discovery": "enabled"})
+				createNamespace(t, controller.client, "nsB", map[string]string{"pilot-discovery": "enabled"})
+				eventually(t, func() bool {
+					list, err := controller.client.CoreV1().Namespaces().List(context.TODO(), metaV1.ListOptions{})
+					if err != nil {
+						t.Fatalf("error listing namespaces: %v", err)
+					}
+					return len(list.Items) == 2
+				})
+
+				// Services in the excluded namespace are dropped
+				createService(controller, "svc2", "nsB",
+					map[string]string{},
+					[]int32{8081}, map[string]string{"test-app": "test-app-2"}, t)
+				createService(controller, "svc1", "nsA",
+					map[string]string{},
+					[]int32{8080}, map[string]string{"test-app": "test-app-1"}, t)
+				if ev := fx.Wait("service"); ev == nil {
+					t.Fatal("Timeout creating service")
+				}
+				eventually(t, func() bool {
+					svcList, _ := controller.Services()
+					return servicesEqual(svcList, []*model.Service{svc1})
+				})
+				if got := controller.discoveryNamespacesFilter.GetMembers(); got.Has("nsB") {
+					t.Fatalf("expected excluded namespace not to be a member, got %v", got.List())
+				}
+
+				// Updating the excluded namespace does not select it
+				updateNamespace(t, controller.client, "nsB", map[string]string{"pilot-discovery": "enabled", "env": "test"})
+				createService(controller, "svc3", "nsA",
+					map[string]string{},
+					[]int32{8082}, map[string]string{"test-app": "test-app-3"}, t)
+				if ev := fx.Wait("service"); ev == nil {
+					t.Fatal("Timeout creating service")
+				}
+				eventually(t, func() bool {
+					svcList, _ := controller.Services()
+					return servicesEqual(svcList, []*model.Service{svc1, svc3})
+				})
+			})
+		}
+	}
+}
@@ -137,6 +137,7 @@ type FakeControllerOptions struct {
 	DomainSuffix              string
 	XDSUpdater                model.XDSUpdater
 	DiscoveryNamespacesFilter filter.DiscoveryNamespacesFilter
+	ExcludedNamespaces        []string
 
 	// when calling from NewFakeDiscoveryServer, we wait for the aggregate cache to sync. Waiting here can cause deadlock.
 	SkipCacheSyncWait bool
@@ -174,6 +175,7 @@ func NewFakeControllerWithOptions(opts FakeControllerOptions) (*FakeController,
 		ClusterID:                 opts.ClusterID,
 		SyncInterval:              time.Microsecond,
 		DiscoveryNamespacesFilter: opts.DiscoveryNamespacesFilter,
+		ExcludedNamespaces:        opts.ExcludedNamespaces,
 	}
 	c := NewController(opts.Client, options)
 	if opts.ServiceHandler != nil {
@@ -202,3 +202,68 @@ func (d *discoveryNamespacesFilter) isSelected(labels labels.Set) bool {
 
 	return false
 }
+
+// excludedNamespacesFilter wraps a DiscoveryNamespacesFilter, never selecting the excluded namespaces, even if
+// they are selected by the wrapped filter.
+type excludedNamespacesFilter struct {
+	DiscoveryNamespacesFilter
+	excluded sets.String
+}
+
+// NewExcludedNamespacesFilter returns a DiscoveryNamespacesFilter selecting the namespaces selected by f, except
+// the excluded namespaces. If excluded is empty, f is returned.
+func NewExcludedNamespacesFilter(f DiscoveryNamespacesFilter, excluded []string) DiscoveryNamespacesFilter {
+	if len(excluded) == 0 {
+		return f
+	}
+	return &excludedNamespacesFilter{
+		DiscoveryNamespacesFilter: f,
+		excluded:                  sets.NewString(excluded...),
+	}
+}
+
+func (e *excludedNamespacesFilter) Filter(obj interface{}) bool {
+	if e.excluded.Has(obj.(metav1.Object).GetNamespace()) {
+		return false
+	}
+	return e.DiscoveryNamespacesFilter.Filter(obj)
+}
+
+func (e *excludedNamespacesFilter) SelectorsChanged(
+	discoverySelectors []*metav1.LabelSelector,
+) (selectedNamespaces []string, deselectedNamespaces []string) {
+	selected, deselected := e.DiscoveryNamespacesFilter.SelectorsChanged(discoverySelectors)
+	return e.withoutExcluded(selected), e.withoutExcluded(deselected)
+}
+
+func (e *excludedNamespacesFilter) NamespaceCreated(ns metav1.ObjectMeta) (membershipChanged bool) {
+	changed := e.DiscoveryNamespacesFilter.NamespaceCreated(ns)
+	return changed && !e.excluded.Has(ns.Name)
+}
+
+func (e *excludedNamespacesFilter) NamespaceUpdated(oldNs, newNs metav1.ObjectMeta) (membershipChanged bool, namespaceAdded bool) {
+	changed, added := e.DiscoveryNamespacesFilter.NamespaceUpdated(oldNs, newNs)
+	if e.excluded.Has(oldNs.Name) {
+		return false, false
+	}
+	return changed, added
+}
+
+func (e *excludedNamespacesFilter) NamespaceDeleted(ns metav1.ObjectMeta) (membershipChanged bool) {
+	changed := e.DiscoveryNamespacesFilter.NamespaceDeleted(ns)
+	return changed && !e.excluded.Has(ns.Name)
+}
+
+func (e *excludedNamespacesFilter) GetMembers() sets.String {
+	return e.DiscoveryNamespacesFilter.GetMembers().Difference(e.excluded)
+}
+
+func (e *excludedNamespacesFilter) withoutExcluded(namespaces []string) []string {
+	out := make([]string, 0, len(namespaces))
+	for _, ns := range namespaces {
+		if !e.excluded.Has(ns) {
+			out = append(out, ns)
+		}
+	}
+	return out
+}
@@ -0,0 +1,171 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package xds
+
+import (
+	"path"
+	"sync"
+	"time"
+
+	"istio.io/istio/pilot/pkg/features"
+)
+
+// connectionAdmission bounds the number of XDS connections accepted by this istiod, globally, per proxy region
+// and per proxy type. This allows a remote region to be prevented from consuming all connection slots, and
+// slots to be kept for critical proxies, such as gateways, when sidecars are bounded.
+// Optionally, some of the global slots are reserved for recently disconnected nodes, so that after a
+// reconnect storm known nodes are readmitted ahead of new ones. Nodes matching priority patterns, such as
+// critical gateways, may exceed the global limit by a reserved capacity, so they can connect when other proxies
+// saturate it.
+type connectionAdmission struct {
+	mu sync.Mutex
+	// limit is the global connection limit. 0 means unlimited.
+	limit int
+	// regionLimits is the connection limit for each region. Regions not present are only bound by limit.
+	regionLimits map[string]int
+	// typeLimits is the connection limit for each proxy type, as in the node ID. Types not present are only
+	// bound by limit.
+	typeLimits map[string]int
+	// reserved is the number of global slots only available to reconnecting nodes.
+	reserved int
+	// reconnectWindow is how long after disconnecting a node is considered to be reconnecting.
+	reconnectWindow time.Duration
+	// priorityNodes are the patterns of the node IDs which may exceed limit, up to priorityReserved connections.
+	priorityNodes    []string
+	priorityReserved int
+
+	total    int
+	byRegion map[string]int
+	byType   map[string]int
+	// disconnected is the last disconnect time of each node ID, for nodes not currently connected.
+	disconnected map[string]time.Time
+	lastPrune    time.Time
+}
+
+func newConnectionAdmission(limit int, regionLimits map[string]int) *connectionAdmission {
+	return &connectionAdmission{
+		limit:        limit,
+		regionLimits: regionLimits,
+		byRegion:     map[string]int{},
+		byType:       map[string]int{},
+		disconnected: map[string]time.Time{},
+	}
+}
+
+// newConnectionAdmissionFromFeatures builds a connectionAdmission from the configured feature flags.
+func newConnectionAdmissionFromFeatures() *connectionAdmission {
+	a := newConnectionAdmission(features.ConnectionLimit, features.RegionConnectionLimits)
+	a.typeLimits = features.ProxyTypeConnectionLimits
+	a.reserved = features.ReconnectReservedConnections
+	a.reconnectWindow = features.ReconnectWindow
+	a.priorityNodes = features.PriorityConnectionNodes
+	a.priorityReserved = features.PriorityReservedConnections
+	return a
+}
+
+// setLimits updates the connection limits. Existing connections beyond the new limits are not closed.
+func (a *connectionAdmission) setLimits(limit int, regionLimits, typeLimits map[string]int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.limit = limit
+	a.regionLimits = regionLimits
+	a.typeLimits = typeLimits
+}
+
+// watchFeatures updates the connection limits when they are overridden at runtime, until stop is closed.
+func (a *connectionAdmission) watchFeatures(stop <-chan struct{}) {
+	cancel := features.OnRuntimeFeaturesChange(func() {
+		a.setLimits(features.ConnectionLimit, features.RegionConnectionLimits, features.ProxyTypeConnectionLimits)
+	})
+	go func() {
+		<-stop
+		cancel()
+	}()
+}
+
+// admit reserves a connection slot for a proxy with the given node ID, region and proxy type. It returns false if
+// the global, region or proxy type limit has been reached, or if only reserved slots remain and the node is not
+// reconnecting. Priority nodes may exceed the global limit by the priority reservation, and are not subject to the
+// reconnect reservation. Each successful admit must be paired with a release.
+func (a *connectionAdmission) admit(region, proxyType, node string, now time.Time) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	priority := a.isPriority(node)
+	limit := a.limit
+	if priority && limit > 0 {
+		limit += a.priorityReserved
+	}
+	if limit > 0 && a.total >= limit {
+		return false
+	}
+	if limit, f := a.regionLimits[region]; f && a.byRegion[region] >= limit {
+		return false
+	}
+	if limit, f := a.typeLimits[proxyType]; f && a.byType[proxyType] >= limit {
+		return false
+	}
+	if !priority && a.reserved > 0 && a.limit > 0 && a.total >= a.limit-a.reserved && !a.reconnecting(node, now) {
+		return false
+	}
+	delete(a.disconnected, node)
+	a.total++
+	a.byRegion[region]++
+	a.byType[proxyType]++
+	return true
+}
+
+// isPriority returns whether the node ID matches a priority pattern.
+func (a *connectionAdmission) isPriority(node string) bool {
+	for _, p := range a.priorityNodes {
+		if ok, _ := path.Match(p, node); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// reconnecting returns whether the node disconnected within the reconnect window.
+func (a *connectionAdmission) reconnecting(node string, now time.Time) bool {
+	t, f := a.disconnected[node]
+	return f && now.Sub(t) <= a.reconnectWindow
+}
+
+// release frees a connection slot previously reserved by admit, remembering the node as reconnecting.
+func (a *connectionAdmission) release(region, proxyType, node string, now time.Time) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.total--
+	a.byRegion[region]--
+	if a.byRegion[region] <= 0 {
+		delete(a.byRegion, region)
+	}
+	a.byType[proxyType]--
+	if a.byType[proxyType] <= 0 {
+		delete(a.byType, proxyType)
+	}
+	if a.reserved <= 0 {
+		return
+	}
+	a.disconnected[node] = now
+	// Pruning is linear in the number of disconnected nodes, so only do it periodically.
+	if now.Sub(a.lastPrune) > a.reconnectWindow {
+		for id, t := range a.disconnected {
+			if now.Sub(t) > a.reconnectWindow {
+				delete(a.disconnected, id)
+			}
+		}
+		a.lastPrune = now
+	}
+}
@@ -15,7 +15,9 @@
 package xds
 
 import (
+	"context"
 	"fmt"
+	"math/rand"
 	"strconv"
 	"strings"
 	"sync/atomic"
@@ -23,6 +25,7 @@ import (
 
 	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
 	discovery "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	"github.com/golang/protobuf/proto"
 	uatomic "go.uber.org/atomic"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/peer"
@@ -113,6 +116,67 @@ type Connection struct {
 	// (last push not ACKed). When we get an ACK from Envoy, if the type is populated here, we will trigger
 	// the push.
 	blockedPushes map[string]*model.PushRequest
+
+	// deltaVersions is a map of TypeUrl to the version of each resource last sent over a delta stream.
+	// This is used to send only resources that have changed. It is only accessed from the stream goroutine.
+	deltaVersions map[string]map[string]string
+
+	// pushed records the resources last pushed to the proxy, if EnablePushedConfigDump is set.
+	pushed *pushedResources
+
+	// lastGenerated is a map of TypeUrl to the resources last generated in full for the type. It is only
+	// populated if XDSGenerationTimeout is set, and only accessed from the push goroutine.
+	lastGenerated map[string]generatedResources
+
+	// abandonedGenerations holds the done channels of generations that timed out but are still running. It is
+	// only accessed from the push goroutine.
+	abandonedGenerations []chan struct{}
+
+	// pushedHashes is a map of TypeUrl to the hash of the resources last pushed in full for the type. It is only
+	// populated if SuppressNoOpPushes is set, and only accessed from the push goroutine.
+	pushedHashes map[string]string
+
+	// admitted is set once the connection holds a slot in the connection admission limits.
+	admitted bool
+
+	// servesEmpty is set if responses on the connection have no resources, per UnknownNamespacePolicy.
+	servesEmpty bool
+
+	// bucket is the experiment bucket of the connection, controlBucket or experimentBucket.
+	bucket string
+
+	// fairness is the scheduling state of the connection in a fair PushQueue. It is only accessed by the queue.
+	fairness pushFairness
+
+	// sentNonces is a map of TypeUrl to the nonces sent since the last ACKed one, oldest first, including it. It
+	// is nil unless StrictNonceValidation was set when the server was created, and guarded by the proxy lock.
+	sentNonces map[string][]string
+
+	// goroutines is the number of goroutines serving the connection.
+	goroutines uatomic.Int32
+
+	// lastPush is the time of the last successful push to the connection, in Unix nanoseconds, or 0 if
+	// nothing was pushed yet.
+	lastPush uatomic.Int64
+}
+
+// lastPushTime returns the time of the last successful push to the connection, and false if nothing was
+// pushed yet.
+func (conn *Connection) lastPushTime() (time.Time, bool) {
+	last := conn.lastPush.Load()
+	if last == 0 {
+		return time.Time{}, false
+	}
+	return time.Unix(0, last), true
+}
+
+// pushStaleness returns how long the connection has gone without a successful push at now. A connection
+// that was never pushed is stale since it connected.
+func (conn *Connection) pushStaleness(now time.Time) time.Duration {
+	if last, ok := conn.lastPushTime(); ok {
+		return now.Sub(last)
+	}
+	return now.Sub(conn.Connect)
 }
 
 // Event represents a config or registry event that results in a push.
@@ -135,10 +199,14 @@ func newConnection(peerAddr string, stream DiscoveryStream) *Connection {
 		Connect:       time.Now(),
 		stream:        stream,
 		blockedPushes: map[string]*model.PushRequest{},
+		pushed:        newPushedResources(),
+		lastGenerated: map[string]generatedResources{},
+		pushedHashes:  map[string]string{},
 	}
 }
 
 func (s *DiscoveryServer) receive(con *Connection) {
+	defer s.trackGoroutine(con)()
 	defer func() {
 		close(con.errorChan)
 		close(con.reqChan)
@@ -192,6 +260,15 @@ func (s *DiscoveryServer) receive(con *Connection) {
 // handles 'push' requests and close - the code will eventually call the 'push' code, and it needs more mutex
 // protection. Original code avoided the mutexes by doing both 'push' and 'process requests' in same thread.
 func (s *DiscoveryServer) processRequest(req *discovery.DiscoveryRequest, con *Connection) error {
+	req.TypeUrl = s.translateTypeURL(req.TypeUrl)
+	if err := checkRequestResources(con, req.TypeUrl, len(req.ResourceNames)); err != nil {
+		return err
+	}
+	if features.ValidateResourceNames {
+		if err := checkResourceNames(con, req.TypeUrl, req.ResourceNames); err != nil {
+			return err
+		}
+	}
 	if !s.shouldProcessRequest(con.proxy, req) {
 		return nil
 	}
@@ -205,6 +282,11 @@ func (s *DiscoveryServer) processRequest(req *discovery.DiscoveryRequest, con *C
 	if s.StatusReporter != nil {
 		s.StatusReporter.RegisterEvent(con.ConID, req.TypeUrl, req.ResponseNonce)
 	}
+	if s.strictNonceValidation {
+		if err := checkNonce(con, req); err != nil {
+			return err
+		}
+	}
 	shouldRespond := s.shouldRespond(con, req)
 
 	var request *model.PushRequest
@@ -235,6 +317,31 @@ func (s *DiscoveryServer) processRequest(req *discovery.DiscoveryRequest, con *C
 	return s.pushXds(con, push, versionInfo(), con.Watched(req.TypeUrl), request)
 }
 
+// streamContext returns the context of the connection's stream.
+func (conn *Connection) streamContext() context.Context {
+	if conn.deltaStream != nil {
+		return conn.deltaStream.Context()
+	}
+	return conn.stream.Context()
+}
+
+// withRequestSlot runs f once a request processing slot is available. This is a semaphore, not a worker pool:
+// f still runs on the goroutine of the connection, and ADSRequestWorkers only bounds how many requests, across
+// all connections, are processed concurrently. Waiting requests are not queued in order. If unset, f is run
+// immediately.
+func (s *DiscoveryServer) withRequestSlot(con *Connection, f func() error) error {
+	if s.requestLimit == nil {
+		return f()
+	}
+	select {
+	case s.requestLimit <- struct{}{}:
+	case <-con.streamContext().Done():
+		return con.streamContext().Err()
+	}
+	defer func() { <-s.requestLimit }()
+	return f()
+}
+
 // StreamAggregatedResources implements the ADS interface.
 func (s *DiscoveryServer) StreamAggregatedResources(stream discovery.AggregatedDiscoveryService_StreamAggregatedResourcesServer) error {
 	return s.Stream(stream)
@@ -286,6 +393,10 @@ func (s *DiscoveryServer) Stream(stream DiscoveryStream) error {
 	}
 	con := newConnection(peerAddr, stream)
 	con.Identities = ids
+	if s.strictNonceValidation {
+		con.sentNonces = map[string][]string{}
+	}
+	defer s.trackGoroutine(con)()
 
 	// Do not call: defer close(con.pushChannel). The push channel will be garbage collected
 	// when the connection is no longer used. Closing the channel can cause subtle race conditions
@@ -296,18 +407,25 @@ func (s *DiscoveryServer) Stream(stream DiscoveryStream) error {
 	// We need 2 go routines because 'read' blocks in Recv().
 	go s.receive(con)
 
-	// Wait for the proxy to be fully initialized before we start serving traffic. Because
-	// initialization doesn't have dependencies that will block, there is no need to add any timeout
-	// here. Prior to this explicit wait, we were implicitly waiting by receive() not sending to
-	// reqChannel and the connection not being enqueued for pushes to pushChannel until the
-	// initialization is complete.
-	<-con.initialized
+	// Wait for the proxy to be fully initialized before we start serving traffic. Initialization
+	// doesn't have dependencies that will block, but the first request may never come, which is
+	// bounded by InitialRequestTimeout. Prior to this explicit wait, we were implicitly waiting by
+	// receive() not sending to reqChannel and the connection not being enqueued for pushes to
+	// pushChannel until the initialization is complete.
+	if err := waitForInitialRequest(con); err != nil {
+		return err
+	}
+
+	lifetime, stopLifetime := connectionLifetime()
+	defer stopLifetime()
 
 	for {
 		select {
 		case req, ok := <-con.reqChan:
 			if ok {
-				if err := s.processRequest(req, con); err != nil {
+				if err := s.withRequestSlot(con, func() error {
+					return s.processRequest(req, con)
+				}); err != nil {
 					return err
 				}
 			} else {
@@ -322,10 +440,106 @@ func (s *DiscoveryServer) Stream(stream DiscoveryStream) error {
 			}
 		case <-con.stop:
 			return nil
+		case <-s.drain:
+			log.Infof("ADS: closing connection for node:%s, istiod is draining", con.ConID)
+			return nil
+		case <-lifetime:
+			// Any in progress push has completed, as pushes are handled on this goroutine.
+			log.Infof("ADS: closing connection for node:%s, maximum connection lifetime reached", con.ConID)
+			return nil
 		}
 	}
 }
 
+// waitForInitialRequest waits until the connection is initialized, once its first request is received. It
+// returns an error if InitialRequestTimeout is set and no request is received in time.
+func waitForInitialRequest(con *Connection) error {
+	if features.InitialRequestTimeout <= 0 {
+		<-con.initialized
+		return nil
+	}
+	t := time.NewTimer(features.InitialRequestTimeout)
+	defer t.Stop()
+	select {
+	case <-con.initialized:
+		return nil
+	case <-t.C:
+		log.Infof("ADS: closing connection from %s, no initial request within %v", con.PeerAddr, features.InitialRequestTimeout)
+		xdsInitialRequestTimeouts.Increment()
+		return status.Errorf(codes.DeadlineExceeded, "no initial request received within %v", features.InitialRequestTimeout)
+	}
+}
+
+// connectionLifetime returns a channel that fires once a connection reaches MaxConnectionLifetime,
+// with up to 10% jitter to avoid all proxies reconnecting at once. If MaxConnectionLifetime is not
+// set, the channel never fires. The returned function releases the underlying timer.
+func connectionLifetime() (<-chan time.Time, func()) {
+	if features.MaxConnectionLifetime <= 0 {
+		return nil, func() {}
+	}
+	jitter := time.Duration(rand.Int63n(int64(features.MaxConnectionLifetime)/10 + 1))
+	t := time.NewTimer(features.MaxConnectionLifetime + jitter)
+	return t.C, func() { t.Stop() }
+}
+
+// checkRequestResources returns an error if a request names more resources than MaxDiscoveryRequestResources,
+// to protect against requests exhausting memory.
+func checkRequestResources(con *Connection, typeURL string, n int) error {
+	if features.MaxDiscoveryRequestResources <= 0 || n <= features.MaxDiscoveryRequestResources {
+		return nil
+	}
+	xdsOversizedRequests.With(typeTag.Value(v3.GetMetricType(typeURL))).Increment()
+	log.Warnf("ADS:%s: rejecting request for %d resources from %s, exceeding the limit of %d",
+		v3.GetShortType(typeURL), n, con.ConID, features.MaxDiscoveryRequestResources)
+	return status.Errorf(codes.InvalidArgument, "request for %d resources exceeds the limit of %d",
+		n, features.MaxDiscoveryRequestResources)
+}
+
+// maxSentNonces bounds the nonces tracked per type for StrictNonceValidation, if a proxy does not ACK.
+const maxSentNonces = 64
+
+// recordSentNonce records a nonce sent for the type. The caller holds the proxy lock.
+func (conn *Connection) recordSentNonce(typeURL, nonce string) {
+	nonces := append(conn.sentNonces[typeURL], nonce)
+	if len(nonces) > maxSentNonces {
+		nonces = nonces[len(nonces)-maxSentNonces:]
+	}
+	conn.sentNonces[typeURL] = nonces
+}
+
+// checkNonce returns an error if the request carries a stale nonce, not sent since the last one ACKed for the
+// type. A proxy never goes back to an older nonce once it ACKed a newer one, so such a nonce is replayed.
+// Nonces older than the ACKed one are forgotten.
+func checkNonce(con *Connection, req *discovery.DiscoveryRequest) error {
+	if req.ErrorDetail != nil {
+		return nil
+	}
+	return checkResponseNonce(con, req.TypeUrl, req.ResponseNonce)
+}
+
+// checkResponseNonce implements checkNonce for the nonce of a SotW or delta request of the type.
+func checkResponseNonce(con *Connection, typeURL, nonce string) error {
+	if nonce == "" {
+		return nil
+	}
+	con.proxy.Lock()
+	defer con.proxy.Unlock()
+	if con.proxy.WatchedResources[typeURL] == nil {
+		// Reconnecting, the nonce was sent by another connection.
+		return nil
+	}
+	nonces := con.sentNonces[typeURL]
+	for i, n := range nonces {
+		if n == nonce {
+			con.sentNonces[typeURL] = nonces[i:]
+			return nil
+		}
+	}
+	log.Warnf("ADS:%s: rejecting request with stale nonce %s from %s", v3.GetShortType(typeURL), nonce, con.ConID)
+	xdsStaleNonceRejections.With(typeTag.Value(v3.GetMetricType(typeURL))).Increment()
+	return status.Errorf(codes.InvalidArgument, "stale nonce %s", nonce)
+}
+
 // shouldRespond determines whether this request needs to be responded back. It applies the ack/nack rules as per xds protocol
 // using WatchedResource for previous state and discovery request for the current state.
 func (s *DiscoveryServer) shouldRespond(con *Connection, request *discovery.DiscoveryRequest) bool {
@@ -404,7 +618,12 @@ func (s *DiscoveryServer) shouldRespond(con *Connection, request *discovery.Disc
 	con.proxy.WatchedResources[request.TypeUrl].NonceNacked = ""
 	con.proxy.WatchedResources[request.TypeUrl].ResourceNames = request.ResourceNames
 	con.proxy.WatchedResources[request.TypeUrl].LastRequest = request
+	changeTime := con.proxy.WatchedResources[request.TypeUrl].ChangeTime
+	con.proxy.WatchedResources[request.TypeUrl].ChangeTime = time.Time{}
 	con.proxy.Unlock()
+	if !changeTime.IsZero() {
+		proxyConvergence.With(typeTag.Value(v3.GetMetricType(request.TypeUrl))).Record(time.Since(changeTime).Seconds())
+	}
 
 	// Envoy can send two DiscoveryRequests with same version and nonce
 	// when it detects a new resource. We should respond if they change.
@@ -469,6 +688,45 @@ func listEqualUnordered(a []string, b []string) bool {
 // update the node associated with the connection, after receiving a packet from envoy, also adds the connection
 // to the tracking map.
 func (s *DiscoveryServer) initConnection(node *core.Node, con *Connection) error {
+	if err := s.admitConnection(node, con); err != nil {
+		return err
+	}
+	xdsConnectionsTotal.Increment()
+
+	// Register the connection. this allows pushes to be triggered for the proxy. Note: the timing of
+	// this and initializeProxy important. While registering for pushes *after* initialization is complete seems like
+	// a better choice, it introduces a race condition; If we complete initialization of a new push
+	// context between initializeProxy and addCon, we would not get any pushes triggered for the new
+	// push context, leading the proxy to have a stale state until the next full push.
+	s.addCon(con.ConID, con)
+	// Register that initialization is complete. This triggers to calls that it is safe to access the
+	// proxy
+	defer close(con.initialized)
+
+	// Complete full initialization of the proxy
+	if err := s.initializeProxy(node, con); err != nil {
+		s.closeConnection(con)
+		return err
+	}
+
+	if s.StatusGen != nil {
+		s.StatusGen.OnConnect(con)
+	}
+	return nil
+}
+
+// admitConnection initializes the proxy metadata of the connection from its node, and checks the connection may be
+// served: its metadata size and identity, memory pressure, the distinct node limit and the connection admission
+// limits. Once admitted, the connection holds an admission slot, freed by releaseConnection.
+func (s *DiscoveryServer) admitConnection(node *core.Node, con *Connection) error {
+	// Check the size first, so oversized metadata is not parsed.
+	if size := proto.Size(node.GetMetadata()); features.MaxNodeMetadataBytes > 0 && size > features.MaxNodeMetadataBytes {
+		log.Warnf("Rejecting XDS connection of %v from %v: node metadata of %d bytes exceeds the limit of %d",
+			node.GetId(), con.PeerAddr, size, features.MaxNodeMetadataBytes)
+		xdsOversizedNodeMetadata.Increment()
+		return status.Errorf(codes.InvalidArgument, "node metadata of %d bytes exceeds the limit of %d bytes",
+			size, features.MaxNodeMetadataBytes)
+	}
 	// Setup the initial proxy metadata
 	proxy, err := s.initProxyMetadata(node)
 	if err != nil {
@@ -488,32 +746,44 @@ func (s *DiscoveryServer) initConnection(node *core.Node, con *Connection) error
 		con.proxy.VerifiedIdentity = id
 	}
 
-	// Register the connection. this allows pushes to be triggered for the proxy. Note: the timing of
-	// this and initializeProxy important. While registering for pushes *after* initialization is complete seems like
-	// a better choice, it introduces a race condition; If we complete initialization of a new push
-	// context between initializeProxy and addCon, we would not get any pushes triggered for the new
-	// push context, leading the proxy to have a stale state until the next full push.
-	s.addCon(con.ConID, con)
-	// Register that initialization is complete. This triggers to calls that it is safe to access the
-	// proxy
-	defer close(con.initialized)
+	if s.underMemoryPressure() {
+		log.Warnf("Rejecting XDS connection %v from %v: memory pressure", con.ConID, con.PeerAddr)
+		xdsMemoryPressureRejections.Increment()
+		return status.Errorf(codes.ResourceExhausted, "memory pressure")
+	}
 
-	// Complete full initialization of the proxy
-	if err := s.initializeProxy(node, con); err != nil {
-		s.closeConnection(con)
-		return err
+	unobserve, ok := s.nodes.observe(node.Id, time.Now())
+	if !ok {
+		log.Warnf("Rejecting XDS connection %v from %v: distinct node limit reached", con.ConID, con.PeerAddr)
+		xdsRejectedNodes.Increment()
+		return status.Errorf(codes.ResourceExhausted, "distinct node limit reached")
 	}
 
-	if s.StatusGen != nil {
-		s.StatusGen.OnConnect(con)
+	if !s.admission.admit(connectionRegion(con), connectionProxyType(con), node.Id, time.Now()) {
+		// The node did not connect, so does not count towards the distinct node limit.
+		unobserve()
+		log.Warnf("Rejecting XDS connection %v from %v: connection limit reached for region %q and proxy type %q",
+			con.ConID, con.PeerAddr, connectionRegion(con), connectionProxyType(con))
+		xdsConnectionLimitRejections.Increment()
+		return status.Errorf(codes.ResourceExhausted, "connection limit reached")
 	}
+	con.admitted = true
 	return nil
 }
 
+// pushesFrozen returns true if pushes to connected proxies are suppressed, as istiod is degraded.
+func (s *DiscoveryServer) pushesFrozen() bool {
+	return features.DegradedModeConfig == features.DegradedModeFreezePushes && s.Degraded != nil && s.Degraded()
+}
+
 func (s *DiscoveryServer) closeConnection(con *Connection) {
 	if con.ConID == "" {
 		return
 	}
+	if con.admitted {
+		s.releaseConnection(con)
+		xdsDisconnectionsTotal.Increment()
+	}
 	s.removeCon(con.ConID)
 	if s.StatusGen != nil {
 		s.StatusGen.OnDisconnect(con)
@@ -524,6 +794,26 @@ func (s *DiscoveryServer) closeConnection(con *Connection) {
 	s.WorkloadEntryController.QueueUnregisterWorkload(con.proxy, con.Connect)
 }
 
+// releaseConnection frees the admission slot of a connection admitted by admitConnection.
+func (s *DiscoveryServer) releaseConnection(con *Connection) {
+	if !con.admitted {
+		return
+	}
+	s.admission.release(connectionRegion(con), connectionProxyType(con), con.node.Id, time.Now())
+	con.admitted = false
+}
+
+// connectionRegion returns the region of the proxy, as reported in the node locality.
+func connectionRegion(con *Connection) string {
+	return con.node.GetLocality().GetRegion()
+}
+
+// connectionProxyType returns the proxy type of the connection, the first component of its node ID, such as
+// sidecar or router.
+func connectionProxyType(con *Connection) string {
+	return strings.SplitN(con.node.GetId(), "~", 2)[0]
+}
+
 func checkConnectionIdentity(con *Connection) (*spiffe.Identity, error) {
 	for _, rawID := range con.Identities {
 		spiffeID, err := spiffe.ParseIdentity(rawID)
@@ -550,6 +840,7 @@ func connectionID(node string) string {
 // initProxyState such that we can perform authorization before attempting expensive computations to
 // fully initialize the proxy.
 func (s *DiscoveryServer) initProxyMetadata(node *core.Node) (*model.Proxy, error) {
+	node = filterNodeMetadata(node)
 	meta, err := model.ParseMetadata(node.Metadata)
 	if err != nil {
 		return nil, err
@@ -573,7 +864,48 @@ func (s *DiscoveryServer) initializeProxy(node *core.Node, con *Connection) erro
 	if err := s.WorkloadEntryController.RegisterWorkload(proxy, con.Connect); err != nil {
 		return err
 	}
+	if err := s.configureConnection(node, con); err != nil {
+		return err
+	}
+	s.initializeProxyState(node, proxy)
+	recordXDSClients(proxy.Metadata.IstioVersion, 1)
+	return nil
+}
+
+// configureConnection applies UnknownNamespacePolicy and the experiment bucket to the connection.
+func (s *DiscoveryServer) configureConnection(node *core.Node, con *Connection) error {
+	proxy := con.proxy
+	if features.UnknownNamespacePolicy != features.UnknownNamespaceServe && !s.isKnownNamespace(proxy.ConfigNamespace) {
+		log.Warnf("Connection %v claims namespace %q, unknown to the registry", con.ConID, proxy.ConfigNamespace)
+		switch features.UnknownNamespacePolicy {
+		case features.UnknownNamespaceReject:
+			return status.Errorf(codes.PermissionDenied, "unknown namespace %q", proxy.ConfigNamespace)
+		case features.UnknownNamespaceServeEmpty:
+			con.servesEmpty = true
+		}
+	}
+	con.bucket = connectionBucket(node.Id, features.ExperimentBucketPercent)
+	if con.bucket == experimentBucket && s.ExperimentGenerator != "" && proxy.Metadata.Generator == "" {
+		proxy.Metadata.Generator = s.ExperimentGenerator
+	}
+	return nil
+}
 
+// isKnownNamespace returns true if the registry has a service in the namespace, or it is the mesh root namespace.
+func (s *DiscoveryServer) isKnownNamespace(namespace string) bool {
+	if namespace == s.Env.Mesh().GetRootNamespace() {
+		return true
+	}
+	for _, svcs := range s.globalPushContext().ServiceIndex.HostnameAndNamespace {
+		if _, f := svcs[namespace]; f {
+			return true
+		}
+	}
+	return false
+}
+
+// initializeProxyState computes the state of a proxy needed to generate its config, from the registries and its node.
+func (s *DiscoveryServer) initializeProxyState(node *core.Node, proxy *model.Proxy) {
 	proxy.SetWorkloadLabels(s.Env)
 	s.computeProxyState(proxy, nil)
 
@@ -600,12 +932,17 @@ func (s *DiscoveryServer) initializeProxy(node *core.Node, con *Connection) erro
 
 	proxy.WatchedResources = map[string]*model.WatchedResource{}
 	// Based on node metadata and version, we can associate a different generator.
+	if proxy.Metadata.Generator == "" {
+		for _, sel := range s.GeneratorSelectors {
+			if sel.Match(proxy) {
+				proxy.Metadata.Generator = sel.Generator
+				break
+			}
+		}
+	}
 	if proxy.Metadata.Generator != "" {
 		proxy.XdsResourceGenerator = s.Generators[proxy.Metadata.Generator]
 	}
-
-	recordXDSClients(proxy.Metadata.IstioVersion, 1)
-	return nil
 }
 
 func (s *DiscoveryServer) updateProxy(proxy *model.Proxy, request *model.PushRequest) {
@@ -691,7 +1028,16 @@ func (s *DiscoveryServer) DeltaAggregatedResources(stream discovery.AggregatedDi
 func (s *DiscoveryServer) pushConnection(con *Connection, pushEv *Event) error {
 	pushRequest := pushEv.pushRequest
 
+	if s.pushesFrozen() {
+		log.Debugf("Skipping push to %v, pushes are frozen while degraded", con.ConID)
+		degradedSkippedPushes.Increment()
+		return nil
+	}
+
 	if pushRequest.Full {
+		if err := con.waitForAbandonedGenerations(); err != nil {
+			return err
+		}
 		// Update Proxy with current information.
 		s.updateProxy(con.proxy, pushRequest)
 	}
@@ -753,16 +1099,34 @@ func (s *DiscoveryServer) pushConnection(con *Connection, pushEv *Event) error {
 }
 
 // PushOrder defines the order that updates will be pushed in. Any types not listed here will be pushed in random
-// order after the types listed here
-var PushOrder = []string{v3.ClusterType, v3.EndpointType, v3.ListenerType, v3.RouteType, v3.SecretType}
-
-// KnownOrderedTypeUrls has typeUrls for which we know the order of push.
-var KnownOrderedTypeUrls = map[string]struct{}{
-	v3.ClusterType:  {},
-	v3.EndpointType: {},
-	v3.ListenerType: {},
-	v3.RouteType:    {},
-	v3.SecretType:   {},
+// order after the types listed here. It is set from features.XDSPushOrder.
+var PushOrder = parsePushOrder(features.XDSPushOrder)
+
+// parsePushOrder returns the type URLs of types, each either a short type name such as cds, or a type URL.
+// Unknown names are ignored.
+func parsePushOrder(types []string) []string {
+	shortTypes := map[string]string{}
+	for _, tp := range []string{
+		v3.ClusterType, v3.EndpointType, v3.ListenerType, v3.RouteType, v3.SecretType,
+		v3.NameTableType, v3.ProxyConfigType, v3.ExtensionConfigurationType,
+	} {
+		shortTypes[v3.GetMetricType(tp)] = tp
+	}
+	out := make([]string, 0, len(types))
+	for _, t := range types {
+		t = strings.TrimSpace(t)
+		if t == "" {
+			continue
+		}
+		if tp, f := shortTypes[strings.ToLower(t)]; f {
+			out = append(out, tp)
+		} else if strings.Contains(t, "/") {
+			out = append(out, t)
+		} else {
+			log.Warnf("ignoring unknown type %q in PILOT_XDS_PUSH_ORDER", t)
+		}
+	}
+	return out
 }
 
 // orderWatchedResources orders the resources in accordance with known push order.
@@ -776,13 +1140,23 @@ func orderWatchedResources(resources map[string]*model.WatchedResource) []*model
 	}
 	// Then add any undeclared types
 	for tp, w := range resources {
-		if _, f := KnownOrderedTypeUrls[tp]; !f {
+		if !isOrderedType(tp) {
 			wr = append(wr, w)
 		}
 	}
 	return wr
 }
 
+// isOrderedType returns true if typeURL is listed in PushOrder.
+func isOrderedType(typeURL string) bool {
+	for _, tp := range PushOrder {
+		if tp == typeURL {
+			return true
+		}
+	}
+	return false
+}
+
 func reportAllEvents(s DistributionStatusCache, id, version string, ignored map[string]*model.WatchedResource) {
 	if s == nil {
 		return
@@ -928,7 +1302,11 @@ func (conn *Connection) send(res *discovery.DiscoveryResponse) error {
 			conn.proxy.WatchedResources[res.TypeUrl].VersionSent = res.VersionInfo
 			conn.proxy.WatchedResources[res.TypeUrl].LastSent = time.Now()
 			conn.proxy.WatchedResources[res.TypeUrl].LastSize = sz
+			if conn.sentNonces != nil {
+				conn.recordSentNonce(res.TypeUrl, res.Nonce)
+			}
 			conn.proxy.Unlock()
+			conn.lastPush.Store(time.Now().UnixNano())
 		}
 	} else if status.Convert(err).Code() == codes.DeadlineExceeded {
 		log.Infof("Timeout writing %s", conn.ConID)
@@ -14,18 +14,36 @@
 package xds_test
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
 	"reflect"
+	"runtime"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	cluster "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
 	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
 	discovery "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	"go.opencensus.io/stats/view"
+	"go.uber.org/atomic"
 	"google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc/codes"
+	grpcstatus "google.golang.org/grpc/status"
 
 	networking "istio.io/api/networking/v1alpha3"
 	"istio.io/istio/pilot/pkg/features"
 	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/networking/util"
 	"istio.io/istio/pilot/pkg/util/sets"
 	"istio.io/istio/pilot/pkg/xds"
 	v3 "istio.io/istio/pilot/pkg/xds/v3"
@@ -35,6 +53,8 @@ import (
 	"istio.io/istio/pkg/config/host"
 	"istio.io/istio/pkg/config/protocol"
 	"istio.io/istio/pkg/config/schema/gvk"
+	"istio.io/istio/pkg/security"
+	"istio.io/istio/pkg/test"
 	"istio.io/istio/pkg/test/util/retry"
 	"istio.io/istio/tests/util/leak"
 )
@@ -1029,3 +1049,1536 @@ func TestEdsCache(t *testing.T) {
 	assertEndpoints(ads)
 	t.Logf("endpoints: %+v", ads.GetEndpoints())
 }
+
+func TestConnectionAdmission(t *testing.T) {
+	originalLimit, originalRegionLimits := features.ConnectionLimit, features.RegionConnectionLimits
+	t.Cleanup(func() {
+		features.ConnectionLimit, features.RegionConnectionLimits = originalLimit, originalRegionLimits
+	})
+	features.ConnectionLimit = 3
+	features.RegionConnectionLimits = map[string]int{"remote": 1}
+	s := xds.NewFakeDiscoveryServer(t, xds.FakeOptions{})
+
+	connect := func(id, region string) *xds.AdsTest {
+		return s.ConnectADS().
+			WithID("sidecar~1.1.1.1~" + id + ".default~default.svc.cluster.local").
+			WithLocality(&core.Locality{Region: region}).
+			WithType(v3.ClusterType)
+	}
+
+	remote := connect("remote-1", "remote")
+	remote.RequestResponseAck(nil)
+
+	// The remote region is at its sub-limit, so further remote proxies are rejected
+	rejected := connect("remote-2", "remote")
+	rejected.Request(nil)
+	if err := rejected.ExpectError(); grpcstatus.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("expected resource exhausted, got %v", err)
+	}
+
+	// Local proxies may still use the remaining slots
+	connect("local-1", "local").RequestResponseAck(nil)
+	connect("local-2", "local").RequestResponseAck(nil)
+
+	// The global limit is reached
+	rejected = connect("local-3", "local")
+	rejected.Request(nil)
+	if err := rejected.ExpectError(); grpcstatus.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("expected resource exhausted, got %v", err)
+	}
+
+	// Closing the remote connection frees its slot
+	remote.Cleanup()
+	retry.UntilSuccessOrFail(t, func() error {
+		if n := len(s.Discovery.AllClients()); n != 2 {
+			return fmt.Errorf("expected 2 clients, got %d", n)
+		}
+		return nil
+	}, retry.Timeout(time.Second*5))
+	connect("remote-3", "remote").RequestResponseAck(nil)
+}
+
+func TestProxyTypeAdmission(t *testing.T) {
+	originalLimit, originalTypeLimits := features.ConnectionLimit, features.ProxyTypeConnectionLimits
+	t.Cleanup(func() {
+		features.ConnectionLimit, features.ProxyTypeConnectionLimits = originalLimit, originalTypeLimits
+	})
+	features.ConnectionLimit = 4
+	features.ProxyTypeConnectionLimits = map[string]int{"sidecar": 2}
+	s := xds.NewFakeDiscoveryServer(t, xds.FakeOptions{})
+
+	connect := func(proxyType, id string) *xds.AdsTest {
+		return s.ConnectADS().
+			WithID(proxyType + "~1.1.1.1~" + id + ".default~default.svc.cluster.local").
+			WithType(v3.ClusterType)
+	}
+	expectRejected := func(ads *xds.AdsTest) {
+		t.Helper()
+		ads.Request(nil)
+		if err := ads.ExpectError(); grpcstatus.Code(err) != codes.ResourceExhausted {
+			t.Fatalf("expected resource exhausted, got %v", err)
+		}
+	}
+
+	// Sidecars are bounded by their sub-limit, even though global slots remain
+	connect("sidecar", "app-1").RequestResponseAck(nil)
+	connect("sidecar", "app-2").RequestResponseAck(nil)
+	expectRejected(connect("sidecar", "app-3"))
+
+	// The remaining slots are kept for gateways
+	connect("router", "gateway-1").RequestResponseAck(nil)
+	connect("router", "gateway-2").RequestResponseAck(nil)
+
+	// The global limit still applies to gateways
+	expectRejected(connect("router", "gateway-3"))
+}
+
+func TestReconnectAdmission(t *testing.T) {
+	originalLimit, originalReserved := features.ConnectionLimit, features.ReconnectReservedConnections
+	t.Cleanup(func() {
+		features.ConnectionLimit, features.ReconnectReservedConnections = originalLimit, originalReserved
+	})
+	features.ConnectionLimit = 6
+	features.ReconnectReservedConnections = 3
+	s := xds.NewFakeDiscoveryServer(t, xds.FakeOptions{})
+	connect := func(name string) *xds.AdsTest {
+		return s.ConnectADS().WithID("sidecar~1.1.1.1~" + name + ".default~default.svc.cluster.local").WithType(v3.ClusterType)
+	}
+	expectRejected := func(name string) {
+		t.Helper()
+		rejected := connect(name)
+		rejected.Request(nil)
+		if err := rejected.ExpectError(); grpcstatus.Code(err) != codes.ResourceExhausted {
+			t.Fatalf("expected %v to be rejected with resource exhausted, got %v", name, err)
+		}
+	}
+
+	known := []string{"known-1", "known-2", "known-3"}
+	var conns []*xds.AdsTest
+	for _, name := range known {
+		ads := connect(name)
+		ads.RequestResponseAck(nil)
+		conns = append(conns, ads)
+	}
+	// Only the reserved slots remain, so new nodes are rejected
+	expectRejected("new-0")
+
+	// Simulate a partition: all known nodes disconnect
+	for _, ads := range conns {
+		ads.Cleanup()
+	}
+	retry.UntilSuccessOrFail(t, func() error {
+		if n := len(s.Discovery.AllClients()); n != 0 {
+			return fmt.Errorf("expected 0 clients, got %d", n)
+		}
+		return nil
+	}, retry.Timeout(time.Second*5))
+
+	// During the reconnect storm new nodes race the known nodes, but may only take the unreserved slots
+	for i := 1; i <= 3; i++ {
+		connect(fmt.Sprintf("new-%d", i)).RequestResponseAck(nil)
+	}
+	expectRejected("new-4")
+	// Known nodes are still readmitted
+	for _, name := range known {
+		connect(name).RequestResponseAck(nil)
+	}
+	expectRejected("known-4")
+}
+
+func TestPriorityConnectionAdmission(t *testing.T) {
+	originalLimit, originalNodes, originalReserved := features.ConnectionLimit, features.PriorityConnectionNodes,
+		features.PriorityReservedConnections
+	t.Cleanup(func() {
+		features.ConnectionLimit, features.PriorityConnectionNodes, features.PriorityReservedConnections =
+			originalLimit, originalNodes, originalReserved
+	})
+	features.ConnectionLimit = 3
+	features.PriorityConnectionNodes = []string{"router~*~istio-ingressgateway-*"}
+	features.PriorityReservedConnections = 1
+	s := xds.NewFakeDiscoveryServer(t, xds.FakeOptions{})
+	expectRejected := func(id string) {
+		t.Helper()
+		rejected := s.ConnectADS().WithID(id).WithType(v3.ClusterType)
+		rejected.Request(nil)
+		if err := rejected.ExpectError(); grpcstatus.Code(err) != codes.ResourceExhausted {
+			t.Fatalf("expected %v to be rejected with resource exhausted, got %v", id, err)
+		}
+	}
+
+	// Sidecars saturate the limit
+	for i := 0; i < 3; i++ {
+		s.ConnectADS().WithID(fmt.Sprintf("sidecar~1.1.1.1~app-%d.default~default.svc.cluster.local", i)).
+			WithType(v3.ClusterType).RequestResponseAck(nil)
+	}
+	expectRejected("sidecar~1.1.1.1~app-3.default~default.svc.cluster.local")
+
+	// A priority gateway still connects, up to the reserved capacity
+	s.ConnectADS().WithID("router~1.1.1.2~istio-ingressgateway-1.istio-system~istio-system.svc.cluster.local").
+		WithType(v3.ClusterType).RequestResponseAck(nil)
+	expectRejected("router~1.1.1.3~istio-ingressgateway-2.istio-system~istio-system.svc.cluster.local")
+	// Other gateways are not prioritized
+	expectRejected("router~1.1.1.4~istio-egressgateway-1.istio-system~istio-system.svc.cluster.local")
+}
+
+func TestMemoryPressureRejection(t *testing.T) {
+	original := features.MemoryPressureRejectThreshold
+	t.Cleanup(func() {
+		features.MemoryPressureRejectThreshold = original
+	})
+	s := xds.NewFakeDiscoveryServer(t, xds.FakeOptions{})
+	pressure := atomic.NewFloat64(1)
+	s.Discovery.MemoryPressure = func() (float64, error) {
+		return pressure.Load(), nil
+	}
+	connect := func(name string) *xds.AdsTest {
+		return s.ConnectADS().WithID("sidecar~1.1.1.1~" + name + ".default~default.svc.cluster.local").WithType(v3.ClusterType)
+	}
+
+	// Disabled by default
+	connect("disabled").RequestResponseAck(nil)
+
+	features.MemoryPressureRejectThreshold = 0.9
+	pressure.Store(0.5)
+	existing := connect("existing")
+	existing.RequestResponseAck(nil)
+
+	// Under pressure, new connections are rejected
+	pressure.Store(0.95)
+	rejected := connect("rejected")
+	rejected.Request(nil)
+	if err := rejected.ExpectError(); grpcstatus.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("expected resource exhausted, got %v", err)
+	}
+	// Existing connections are preserved
+	existing.RequestResponseAck(&discovery.DiscoveryRequest{TypeUrl: v3.ListenerType})
+
+	// Once pressure drops, new connections are accepted again
+	pressure.Store(0.5)
+	connect("recovered").RequestResponseAck(nil)
+}
+
+// sumValue returns the value of a sum metric, or 0 if it was not recorded.
+func sumValue(t *testing.T, name string) float64 {
+	t.Helper()
+	data, err := view.RetrieveData(name)
+	if err != nil {
+		t.Fatalf("failed to get %v: %v", name, err)
+	}
+	if len(data) == 0 {
+		return 0
+	}
+	return data[0].Data.(*view.SumData).Value
+}
+
+func TestConnectionChurnMetrics(t *testing.T) {
+	original := features.ConnectionLimit
+	t.Cleanup(func() {
+		features.ConnectionLimit = original
+	})
+	features.ConnectionLimit = 2
+	s := xds.NewFakeDiscoveryServer(t, xds.FakeOptions{})
+	connect := func(name string) *xds.AdsTest {
+		return s.ConnectADS().WithID("sidecar~1.1.1.1~" + name + ".default~default.svc.cluster.local").WithType(v3.ClusterType)
+	}
+	connects, disconnects := sumValue(t, "pilot_xds_connections_total"), sumValue(t, "pilot_xds_disconnections_total")
+	rejections := sumValue(t, "pilot_xds_connection_limit_rejections_total")
+
+	// A flapping proxy connects and disconnects repeatedly
+	for i := 0; i < 3; i++ {
+		ads := connect("flapping")
+		ads.RequestResponseAck(nil)
+		ads.Cleanup()
+	}
+	retry.UntilSuccessOrFail(t, func() error {
+		if v := sumValue(t, "pilot_xds_disconnections_total") - disconnects; v != 3 {
+			return fmt.Errorf("expected 3 disconnections, got %v", v)
+		}
+		return nil
+	}, retry.Timeout(time.Second*5))
+
+	connect("a").RequestResponseAck(nil)
+	connect("b").RequestResponseAck(nil)
+	rejected := connect("c")
+	rejected.Request(nil)
+	if err := rejected.ExpectError(); grpcstatus.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("expected resource exhausted, got %v", err)
+	}
+
+	if v := sumValue(t, "pilot_xds_connections_total") - connects; v != 5 {
+		t.Fatalf("expected 5 connections, got %v", v)
+	}
+	// Rejected connections are counted separately
+	if v := sumValue(t, "pilot_xds_connection_limit_rejections_total") - rejections; v != 1 {
+		t.Fatalf("expected 1 connection limit rejection, got %v", v)
+	}
+	if v := sumValue(t, "pilot_xds_disconnections_total") - disconnects; v != 3 {
+		t.Fatalf("expected rejected connections not to count as disconnections, got %v", v)
+	}
+}
+
+func TestProxyConvergenceMetric(t *testing.T) {
+	count := func() int64 {
+		data, err := view.RetrieveData("pilot_proxy_convergence_seconds")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, row := range data {
+			for _, tag := range row.Tags {
+				if tag.Value == v3.GetMetricType(v3.ClusterType) {
+					return row.Data.(*view.DistributionData).Count
+				}
+			}
+		}
+		return 0
+	}
+	s := xds.NewFakeDiscoveryServer(t, xds.FakeOptions{})
+	before := count()
+	ads := s.ConnectADS().WithType(v3.ClusterType)
+	ads.RequestResponseAck(nil)
+
+	s.Discovery.ConfigUpdate(&model.PushRequest{Full: true})
+	res := ads.ExpectResponse()
+	ads.Request(&discovery.DiscoveryRequest{ResponseNonce: res.Nonce, VersionInfo: res.VersionInfo})
+
+	// Only the ACK of the push triggered by the config change is measured, not the ACK of the initial response
+	retry.UntilSuccessOrFail(t, func() error {
+		if got := count() - before; got != 1 {
+			return fmt.Errorf("expected 1 convergence measurement, got %v", got)
+		}
+		return nil
+	}, retry.Timeout(time.Second*5))
+}
+
+func TestDegradedModeFreezePushes(t *testing.T) {
+	original := features.DegradedModeConfig
+	t.Cleanup(func() {
+		features.DegradedModeConfig = original
+	})
+	features.DegradedModeConfig = features.DegradedModeFreezePushes
+	s := xds.NewFakeDiscoveryServer(t, xds.FakeOptions{})
+	degraded := atomic.NewBool(false)
+	s.Discovery.Degraded = degraded.Load
+	ads := s.ConnectADS().WithType(v3.ClusterType)
+	ads.RequestResponseAck(nil)
+
+	// Simulate registry loss; config changes are no longer pushed
+	degraded.Store(true)
+	skipped := sumValue(t, "pilot_xds_degraded_skipped_pushes")
+	xds.AdsPushAll(s.Discovery)
+	ads.ExpectNoResponse()
+	if v := sumValue(t, "pilot_xds_degraded_skipped_pushes") - skipped; v != 1 {
+		t.Fatalf("expected 1 skipped push, got %v", v)
+	}
+
+	// Requests are still answered, and new proxies can connect
+	ads.RequestResponseAck(&discovery.DiscoveryRequest{ResourceNames: []string{"foo"}})
+	s.ConnectADS().WithType(v3.ClusterType).RequestResponseAck(nil)
+
+	// Once the registry recovers, pushes resume
+	degraded.Store(false)
+	xds.AdsPushAll(s.Discovery)
+	ads.ExpectResponse()
+}
+
+func TestDegradedModeServeStale(t *testing.T) {
+	s := xds.NewFakeDiscoveryServer(t, xds.FakeOptions{})
+	s.Discovery.Degraded = func() bool { return true }
+	ads := s.ConnectADS().WithType(v3.ClusterType)
+	ads.RequestResponseAck(nil)
+
+	// By default pushes continue while degraded
+	xds.AdsPushAll(s.Discovery)
+	ads.ExpectResponse()
+}
+
+// slowGenerator wraps a generator, blocking generation while slow is set until release is closed.
+type slowGenerator struct {
+	gen     model.XdsResourceGenerator
+	slow    *atomic.Bool
+	release chan struct{}
+}
+
+func (g slowGenerator) Generate(proxy *model.Proxy, push *model.PushContext, w *model.WatchedResource,
+	updates *model.PushRequest) (model.Resources, model.XdsLogDetails, error) {
+	if g.slow.Load() {
+		<-g.release
+	}
+	return g.gen.Generate(proxy, push, w, updates)
+}
+
+func TestXdsGenerationTimeout(t *testing.T) {
+	original := features.XDSGenerationTimeout
+	t.Cleanup(func() {
+		features.XDSGenerationTimeout = original
+	})
+	features.XDSGenerationTimeout = 100 * time.Millisecond
+	s := xds.NewFakeDiscoveryServer(t, xds.FakeOptions{})
+	gen := slowGenerator{
+		gen:     s.Discovery.Generators[v3.ClusterType],
+		slow:    atomic.NewBool(false),
+		release: make(chan struct{}),
+	}
+	t.Cleanup(func() {
+		close(gen.release)
+	})
+	s.Discovery.Generators["slow/"+v3.ClusterType] = gen
+
+	ads := s.ConnectADS().WithMetadata(model.NodeMetadata{Generator: "slow"}).WithType(v3.ClusterType).WithTimeout(5 * time.Second)
+	good := ads.RequestResponseAck(nil)
+
+	// Generation now stalls; the previous good version should be served once the timeout kicks in
+	gen.slow.Store(true)
+	xds.AdsPushAll(s.Discovery)
+	stale := ads.ExpectResponse()
+	if len(good.Resources) != len(stale.Resources) {
+		t.Fatalf("expected %d previous resources, got %d", len(good.Resources), len(stale.Resources))
+	}
+	for i := range good.Resources {
+		if !proto.Equal(good.Resources[i], stale.Resources[i]) {
+			t.Fatalf("resource %d differs from the previously served version", i)
+		}
+	}
+	data, err := view.RetrieveData("pilot_xds_generation_timeouts")
+	if err != nil || len(data) == 0 {
+		t.Fatalf("failed to get pilot_xds_generation_timeouts: %v", err)
+	}
+	if v := data[0].Data.(*view.SumData).Value; v < 1 {
+		t.Fatalf("expected generation timeouts to be recorded, got %v", v)
+	}
+}
+
+func TestXdsGenerationTimeoutInitialRequest(t *testing.T) {
+	original := features.XDSGenerationTimeout
+	t.Cleanup(func() {
+		features.XDSGenerationTimeout = original
+	})
+	features.XDSGenerationTimeout = 50 * time.Millisecond
+	s := xds.NewFakeDiscoveryServer(t, xds.FakeOptions{})
+	gen := slowGenerator{
+		gen:     s.Discovery.Generators[v3.ClusterType],
+		slow:    atomic.NewBool(true),
+		release: make(chan struct{}),
+	}
+	s.Discovery.Generators["slow/"+v3.ClusterType] = gen
+
+	// Without a previous version to serve, the initial request must still be answered once generation completes
+	ads := s.ConnectADS().WithMetadata(model.NodeMetadata{Generator: "slow"}).WithType(v3.ClusterType).WithTimeout(5 * time.Second)
+	ads.Request(nil)
+	time.AfterFunc(4*features.XDSGenerationTimeout, func() {
+		close(gen.release)
+	})
+	if res := ads.ExpectResponse(); len(res.Resources) == 0 {
+		t.Fatalf("expected clusters in the initial response")
+	}
+}
+
+// concurrencyGenerator wraps a generator, tracking the maximum number of concurrent generations.
+type concurrencyGenerator struct {
+	gen      model.XdsResourceGenerator
+	inflight *atomic.Int32
+	max      *atomic.Int32
+}
+
+func newConcurrencyGenerator(gen model.XdsResourceGenerator) concurrencyGenerator {
+	return concurrencyGenerator{gen: gen, inflight: atomic.NewInt32(0), max: atomic.NewInt32(0)}
+}
+
+func (g concurrencyGenerator) Generate(proxy *model.Proxy, push *model.PushContext, w *model.WatchedResource,
+	updates *model.PushRequest) (model.Resources, model.XdsLogDetails, error) {
+	cur := g.inflight.Inc()
+	defer g.inflight.Dec()
+	for {
+		max := g.max.Load()
+		if cur <= max || g.max.CAS(max, cur) {
+			break
+		}
+	}
+	// Hold the request long enough for others to pile up
+	time.Sleep(10 * time.Millisecond)
+	return g.gen.Generate(proxy, push, w, updates)
+}
+
+// connectionStorm connects n proxies concurrently, each requesting clusters, with at most limit requests
+// processed concurrently, and returns the maximum number of requests processed concurrently.
+func connectionStorm(t test.Failer, limit, n int) int32 {
+	original := features.ADSRequestWorkers
+	defer func() {
+		features.ADSRequestWorkers = original
+	}()
+	features.ADSRequestWorkers = limit
+	s := xds.NewFakeDiscoveryServer(t, xds.FakeOptions{})
+	gen := newConcurrencyGenerator(s.Discovery.Generators[v3.ClusterType])
+	s.Discovery.Generators["counting/"+v3.ClusterType] = gen
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < n; i++ {
+		ads := s.ConnectADS().
+			WithID(fmt.Sprintf("sidecar~1.1.1.1~storm-%d.default~default.svc.cluster.local", i)).
+			WithMetadata(model.NodeMetadata{Generator: "counting"}).
+			WithType(v3.ClusterType).
+			WithTimeout(10 * time.Second)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ads.Request(nil)
+			ads.ExpectResponse()
+		}()
+	}
+	wg.Wait()
+	return gen.max.Load()
+}
+
+func TestADSRequestWorkers(t *testing.T) {
+	if max := connectionStorm(t, 2, 10); max > 2 {
+		t.Fatalf("expected at most 2 concurrent requests, got %d", max)
+	}
+}
+
+// BenchmarkADSRequestConcurrencyLimit measures a connection storm with and without a bound on the number of
+// requests processed concurrently. The bound does not add workers, so it only caps the reported concurrency.
+func BenchmarkADSRequestConcurrencyLimit(b *testing.B) {
+	for _, limit := range []int{0, 4} {
+		b.Run(fmt.Sprintf("limit-%d", limit), func(b *testing.B) {
+			var max int32
+			for n := 0; n < b.N; n++ {
+				if m := connectionStorm(b, limit, 50); m > max {
+					max = m
+				}
+			}
+			b.ReportMetric(float64(max), "max-concurrent-requests")
+		})
+	}
+}
+
+func TestMaxConnectionLifetime(t *testing.T) {
+	original := features.MaxConnectionLifetime
+	t.Cleanup(func() {
+		features.MaxConnectionLifetime = original
+	})
+	features.MaxConnectionLifetime = 200 * time.Millisecond
+	s := xds.NewFakeDiscoveryServer(t, xds.FakeOptions{})
+
+	ads := s.ConnectADS().WithType(v3.ClusterType).WithTimeout(5 * time.Second)
+	ads.RequestResponseAck(nil)
+	// The connection is closed by the server once its lifetime is reached
+	if err := ads.ExpectError(); err != io.EOF {
+		t.Fatalf("expected connection to be closed, got %v", err)
+	}
+	retry.UntilSuccessOrFail(t, func() error {
+		if n := len(s.Discovery.AllClients()); n != 0 {
+			return fmt.Errorf("expected no clients, got %d", n)
+		}
+		return nil
+	}, retry.Timeout(time.Second*5))
+
+	// The proxy can reconnect
+	s.ConnectADS().WithType(v3.ClusterType).RequestResponseAck(nil)
+}
+
+func TestReadinessSettling(t *testing.T) {
+	s := xds.NewFakeDiscoveryServer(t, xds.FakeOptions{DebounceTime: 200 * time.Millisecond})
+	for i := 0; i < 10; i++ {
+		s.ConnectADS().WithType(v3.ClusterType).RequestResponseAck(nil)
+	}
+	if s.Discovery.IsSettling(time.Minute) {
+		t.Fatalf("expected server to be settled before any config change")
+	}
+
+	configs := map[model.ConfigKey]struct{}{}
+	for i := 0; i < 1000; i++ {
+		configs[model.ConfigKey{Kind: gvk.ServiceEntry, Name: fmt.Sprintf("se-%d", i), Namespace: "default"}] = struct{}{}
+	}
+	s.Discovery.ConfigUpdate(&model.PushRequest{Full: true, ConfigsUpdated: configs, Reason: []model.TriggerReason{model.ConfigUpdate}})
+	if !s.Discovery.IsSettling(time.Minute) {
+		t.Fatalf("expected server to be settling after config change")
+	}
+	// Once the settle window has passed, the server is considered settled even if pushes are still in progress.
+	if s.Discovery.IsSettling(0) {
+		t.Fatalf("expected server to be settled after the settle window")
+	}
+	retry.UntilSuccessOrFail(t, func() error {
+		if s.Discovery.IsSettling(time.Minute) {
+			return fmt.Errorf("server still settling")
+		}
+		return nil
+	}, retry.Timeout(time.Second*10))
+}
+
+func TestMaxDiscoveryRequestResources(t *testing.T) {
+	original := features.MaxDiscoveryRequestResources
+	t.Cleanup(func() {
+		features.MaxDiscoveryRequestResources = original
+	})
+	features.MaxDiscoveryRequestResources = 2
+	s := xds.NewFakeDiscoveryServer(t, xds.FakeOptions{})
+
+	// Requests within the limit are served
+	s.ConnectADS().WithType(v3.EndpointType).RequestResponseAck(&discovery.DiscoveryRequest{
+		ResourceNames: []string{"outbound|80||a.default.svc.cluster.local", "outbound|80||b.default.svc.cluster.local"},
+	})
+
+	ads := s.ConnectADS().WithType(v3.EndpointType)
+	ads.Request(&discovery.DiscoveryRequest{
+		ResourceNames: []string{"a", "b", "c"},
+	})
+	if err := ads.ExpectError(); grpcstatus.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected invalid argument, got %v", err)
+	}
+	data, err := view.RetrieveData("pilot_xds_oversized_requests")
+	if err != nil || len(data) == 0 {
+		t.Fatalf("failed to get pilot_xds_oversized_requests: %v", err)
+	}
+	if v := data[0].Data.(*view.SumData).Value; v < 1 {
+		t.Fatalf("expected oversized requests to be recorded, got %v", v)
+	}
+}
+
+func TestRuntimeConnectionLimit(t *testing.T) {
+	t.Cleanup(func() {
+		if err := features.ApplyRuntimeFeatures(nil); err != nil {
+			t.Fatal(err)
+		}
+	})
+	file := filepath.Join(t.TempDir(), "features.yaml")
+	load := func(content string) {
+		t.Helper()
+		if err := ioutil.WriteFile(file, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := features.LoadRuntimeFeatures(file); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s := xds.NewFakeDiscoveryServer(t, xds.FakeOptions{})
+	s.ConnectADS().WithID("sidecar~1.1.1.1~a.default~default.svc.cluster.local").WithType(v3.ClusterType).RequestResponseAck(nil)
+
+	// Lowering the limit applies to new connections, existing connections are kept
+	load("PILOT_MAX_XDS_CONNECTIONS: 1\nPILOT_DEBOUNCE_AFTER: 1s\n")
+	rejected := s.ConnectADS().WithID("sidecar~1.1.1.2~b.default~default.svc.cluster.local").WithType(v3.ClusterType)
+	rejected.Request(nil)
+	if err := rejected.ExpectError(); grpcstatus.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("expected resource exhausted, got %v", err)
+	}
+
+	// Invalid values are rejected, keeping the previous limit
+	if err := ioutil.WriteFile(file, []byte("PILOT_MAX_XDS_CONNECTIONS: many\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := features.LoadRuntimeFeatures(file); err == nil {
+		t.Fatalf("expected invalid runtime features to be rejected")
+	}
+	if features.ConnectionLimit != 1 {
+		t.Fatalf("expected connection limit to be kept, got %v", features.ConnectionLimit)
+	}
+
+	// Removing the override restores the startup value
+	load("{}")
+	s.ConnectADS().WithID("sidecar~1.1.1.3~c.default~default.svc.cluster.local").WithType(v3.ClusterType).RequestResponseAck(nil)
+}
+
+func TestMeshConfigOverrides(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "overrides.yaml")
+	overrides := `
+- name: experiment
+  selector:
+    mesh: experiment
+  meshConfig: |
+    connectTimeout: 7s
+`
+	if err := ioutil.WriteFile(file, []byte(overrides), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	original := features.MeshConfigOverridesFile
+	t.Cleanup(func() {
+		features.MeshConfigOverridesFile = original
+	})
+	features.MeshConfigOverridesFile = file
+	s := xds.NewFakeDiscoveryServer(t, xds.FakeOptions{})
+
+	connectTimeout := func(labels map[string]string) time.Duration {
+		t.Helper()
+		res := s.ConnectADS().WithType(v3.ClusterType).WithMetadata(model.NodeMetadata{Labels: labels}).RequestResponseAck(nil)
+		for _, r := range res.Resources {
+			c := &cluster.Cluster{}
+			if err := proto.Unmarshal(r.Value, c); err != nil {
+				t.Fatal(err)
+			}
+			if c.Name == util.BlackHoleCluster {
+				return c.ConnectTimeout.AsDuration()
+			}
+		}
+		t.Fatalf("no %v cluster generated", util.BlackHoleCluster)
+		return 0
+	}
+
+	if got := connectTimeout(map[string]string{"mesh": "experiment"}); got != 7*time.Second {
+		t.Fatalf("expected the connect timeout of the override for a matching proxy, got %v", got)
+	}
+	if got := connectTimeout(map[string]string{"mesh": "default"}); got != 10*time.Second {
+		t.Fatalf("expected the default connect timeout for other proxies, got %v", got)
+	}
+}
+
+func TestStrictNonceValidation(t *testing.T) {
+	for _, strict := range []bool{false, true} {
+		t.Run(fmt.Sprint(strict), func(t *testing.T) {
+			original := features.StrictNonceValidation
+			t.Cleanup(func() {
+				features.StrictNonceValidation = original
+			})
+			features.StrictNonceValidation = strict
+			s := xds.NewFakeDiscoveryServer(t, xds.FakeOptions{})
+
+			ads := s.ConnectADS().WithType(v3.ClusterType)
+			first := ads.RequestResponseAck(nil)
+			s.Discovery.Push(&model.PushRequest{Full: true})
+			second := ads.ExpectResponse()
+			ads.Request(&discovery.DiscoveryRequest{ResponseNonce: second.Nonce, VersionInfo: second.VersionInfo})
+
+			// Replay the ACK of the first response, after the second one was ACKed
+			ads.Request(&discovery.DiscoveryRequest{ResponseNonce: first.Nonce, VersionInfo: first.VersionInfo})
+			if !strict {
+				ads.ExpectNoResponse()
+				return
+			}
+			if err := ads.ExpectError(); grpcstatus.Code(err) != codes.InvalidArgument || !strings.Contains(err.Error(), "stale nonce") {
+				t.Fatalf("expected the replayed nonce to be rejected, got %v", err)
+			}
+			data, err := view.RetrieveData("pilot_xds_stale_nonce_rejections")
+			if err != nil || len(data) == 0 {
+				t.Fatalf("failed to get pilot_xds_stale_nonce_rejections: %v", err)
+			}
+		})
+	}
+}
+
+func TestInitialRequestTimeout(t *testing.T) {
+	original := features.InitialRequestTimeout
+	t.Cleanup(func() {
+		features.InitialRequestTimeout = original
+	})
+	features.InitialRequestTimeout = 100 * time.Millisecond
+	s := xds.NewFakeDiscoveryServer(t, xds.FakeOptions{})
+
+	// A connection sending its first request in time is served
+	s.ConnectADS().WithType(v3.ClusterType).RequestResponseAck(nil)
+
+	// A connection that never sends a request is closed
+	idle := s.ConnectADS().WithTimeout(5 * time.Second)
+	if err := idle.ExpectError(); grpcstatus.Code(err) != codes.DeadlineExceeded {
+		t.Fatalf("expected the idle connection to be closed, got %v", err)
+	}
+
+	data, err := view.RetrieveData("pilot_xds_initial_request_timeouts")
+	if err != nil || len(data) == 0 {
+		t.Fatalf("failed to get pilot_xds_initial_request_timeouts: %v", err)
+	}
+	if v := data[0].Data.(*view.SumData).Value; v < 1 {
+		t.Fatalf("expected the timeout to be recorded, got %v", v)
+	}
+}
+
+func TestMaxNodeMetadataBytes(t *testing.T) {
+	original := features.MaxNodeMetadataBytes
+	t.Cleanup(func() {
+		features.MaxNodeMetadataBytes = original
+	})
+	features.MaxNodeMetadataBytes = 1024
+	s := xds.NewFakeDiscoveryServer(t, xds.FakeOptions{})
+
+	s.ConnectADS().WithType(v3.ClusterType).
+		WithMetadata(model.NodeMetadata{Labels: map[string]string{"app": "small"}}).
+		RequestResponseAck(nil)
+
+	oversized := s.ConnectADS().WithType(v3.ClusterType).
+		WithMetadata(model.NodeMetadata{Labels: map[string]string{"app": strings.Repeat("x", 2048)}})
+	oversized.Request(nil)
+	err := oversized.ExpectError()
+	if grpcstatus.Code(err) != codes.InvalidArgument || !strings.Contains(err.Error(), "node metadata") {
+		t.Fatalf("expected the oversized node metadata to be rejected, got %v", err)
+	}
+
+	data, err := view.RetrieveData("pilot_xds_oversized_node_metadata")
+	if err != nil || len(data) == 0 {
+		t.Fatalf("failed to get pilot_xds_oversized_node_metadata: %v", err)
+	}
+	if v := data[0].Data.(*view.SumData).Value; v < 1 {
+		t.Fatalf("expected the rejection to be recorded, got %v", v)
+	}
+}
+
+func TestMaxDistinctNodes(t *testing.T) {
+	original := features.MaxDistinctNodes
+	t.Cleanup(func() {
+		features.MaxDistinctNodes = original
+	})
+	features.MaxDistinctNodes = 5
+	s := xds.NewFakeDiscoveryServer(t, xds.FakeOptions{})
+	id := func(i int) string {
+		return fmt.Sprintf("sidecar~1.1.1.%d~app-%d.default~default.svc.cluster.local", i, i)
+	}
+
+	for i := 0; i < 5; i++ {
+		ads := s.ConnectADS().WithID(id(i)).WithType(v3.ClusterType)
+		ads.RequestResponseAck(nil)
+		ads.Cleanup()
+	}
+
+	// New node IDs beyond the cap are rejected, even though the earlier connections are closed
+	for i := 5; i < 10; i++ {
+		rejected := s.ConnectADS().WithID(id(i)).WithType(v3.ClusterType)
+		rejected.Request(nil)
+		if err := rejected.ExpectError(); grpcstatus.Code(err) != codes.ResourceExhausted {
+			t.Fatalf("expected resource exhausted, got %v", err)
+		}
+	}
+
+	// Node IDs already seen may reconnect
+	s.ConnectADS().WithID(id(0)).WithType(v3.ClusterType).RequestResponseAck(nil)
+
+	data, err := view.RetrieveData("pilot_xds_distinct_nodes")
+	if err != nil || len(data) == 0 {
+		t.Fatalf("failed to get pilot_xds_distinct_nodes: %v", err)
+	}
+	if v := data[0].Data.(*view.LastValueData).Value; v != 5 {
+		t.Fatalf("expected 5 distinct nodes, got %v", v)
+	}
+	data, err = view.RetrieveData("pilot_xds_rejected_nodes")
+	if err != nil || len(data) == 0 {
+		t.Fatalf("failed to get pilot_xds_rejected_nodes: %v", err)
+	}
+	if v := data[0].Data.(*view.SumData).Value; v < 5 {
+		t.Fatalf("expected rejected nodes to be recorded, got %v", v)
+	}
+}
+
+// fixedClusterGenerator generates a single cluster with a fixed name.
+type fixedClusterGenerator struct {
+	name string
+}
+
+func (g fixedClusterGenerator) Generate(*model.Proxy, *model.PushContext, *model.WatchedResource,
+	*model.PushRequest) (model.Resources, model.XdsLogDetails, error) {
+	return model.Resources{{Name: g.name, Resource: util.MessageToAny(&cluster.Cluster{Name: g.name})}}, model.DefaultXdsLogDetails, nil
+}
+
+func TestGeneratorSelectors(t *testing.T) {
+	s := xds.NewFakeDiscoveryServer(t, xds.FakeOptions{})
+	s.Discovery.Generators["experiment/"+v3.ClusterType] = fixedClusterGenerator{name: "experiment"}
+	s.Discovery.GeneratorSelectors = []xds.GeneratorSelector{{
+		Match:     xds.ProxyIDPrefix("experiment-"),
+		Generator: "experiment",
+	}}
+
+	clusterNames := func(resp *discovery.DiscoveryResponse) []string {
+		names := []string{}
+		for _, r := range resp.Resources {
+			c := &cluster.Cluster{}
+			if err := proto.Unmarshal(r.Value, c); err != nil {
+				t.Fatal(err)
+			}
+			names = append(names, c.Name)
+		}
+		return names
+	}
+
+	matching := s.ConnectADS().WithID("sidecar~1.1.1.1~experiment-1.default~default.svc.cluster.local").WithType(v3.ClusterType)
+	if got := clusterNames(matching.RequestResponseAck(nil)); !reflect.DeepEqual(got, []string{"experiment"}) {
+		t.Fatalf("expected clusters from the experiment generator, got %v", got)
+	}
+
+	other := s.ConnectADS().WithID("sidecar~1.1.1.1~app-1.default~default.svc.cluster.local").WithType(v3.ClusterType)
+	if got := clusterNames(other.RequestResponseAck(nil)); reflect.DeepEqual(got, []string{"experiment"}) {
+		t.Fatalf("expected clusters from the default generator, got %v", got)
+	}
+}
+
+// countingGenerator tracks the number of concurrent generations.
+type countingGenerator struct {
+	fixedClusterGenerator
+	delay  time.Duration
+	calls  *atomic.Int32
+	active *atomic.Int32
+	max    *atomic.Int32
+}
+
+func (g countingGenerator) Generate(proxy *model.Proxy, push *model.PushContext, w *model.WatchedResource,
+	req *model.PushRequest) (model.Resources, model.XdsLogDetails, error) {
+	g.calls.Inc()
+	active := g.active.Inc()
+	defer g.active.Dec()
+	for {
+		max := g.max.Load()
+		if active <= max || g.max.CAS(max, active) {
+			break
+		}
+	}
+	time.Sleep(g.delay)
+	return g.fixedClusterGenerator.Generate(proxy, push, w, req)
+}
+
+func TestMaxConcurrentComputations(t *testing.T) {
+	original := features.MaxConcurrentComputations
+	t.Cleanup(func() {
+		features.MaxConcurrentComputations = original
+	})
+	features.MaxConcurrentComputations = 2
+	s := xds.NewFakeDiscoveryServer(t, xds.FakeOptions{})
+	gen := countingGenerator{
+		fixedClusterGenerator: fixedClusterGenerator{name: "counted"},
+		delay:                 50 * time.Millisecond,
+		calls:                 atomic.NewInt32(0),
+		active:                atomic.NewInt32(0),
+		max:                   atomic.NewInt32(0),
+	}
+	s.Discovery.Generators["counting/"+v3.ClusterType] = gen
+	s.Discovery.GeneratorSelectors = []xds.GeneratorSelector{{
+		Match:     func(*model.Proxy) bool { return true },
+		Generator: "counting",
+	}}
+
+	const proxies = 10
+	for i := 0; i < proxies; i++ {
+		s.ConnectADS().WithID(fmt.Sprintf("sidecar~1.1.1.%d~app-%d.default~default.svc.cluster.local", i, i)).
+			WithType(v3.ClusterType).RequestResponseAck(nil)
+	}
+	// Rapid config changes trigger full pushes to all proxies at once
+	for i := 0; i < 5; i++ {
+		s.Discovery.ConfigUpdate(&model.PushRequest{Full: true})
+		time.Sleep(10 * time.Millisecond)
+	}
+	retry.UntilSuccessOrFail(t, func() error {
+		if c := gen.calls.Load(); c < 2*proxies {
+			return fmt.Errorf("expected pushes to all proxies, got %d generations", c)
+		}
+		return nil
+	}, retry.Timeout(10*time.Second))
+	if m := gen.max.Load(); m != 2 {
+		t.Fatalf("expected at most 2 concurrent computations, and the limit to be reached, got %d", m)
+	}
+}
+
+func TestV2Compat(t *testing.T) {
+	original := features.EnableV2Compat
+	t.Cleanup(func() {
+		features.EnableV2Compat = original
+	})
+	features.EnableV2Compat = true
+	s := xds.NewFakeDiscoveryServer(t, xds.FakeOptions{})
+
+	ads := s.ConnectADS().WithType("type.googleapis.com/envoy.api.v2.Cluster")
+	res := ads.RequestResponseAck(nil)
+	if res.TypeUrl != v3.ClusterType {
+		t.Fatalf("expected type %s, got %s", v3.ClusterType, res.TypeUrl)
+	}
+	for _, r := range res.Resources {
+		c := &cluster.Cluster{}
+		if err := r.UnmarshalTo(c); err != nil {
+			t.Fatalf("expected a v3 cluster: %v", err)
+		}
+	}
+	// The ACK, sent with the legacy type URL, is not answered again
+	ads.ExpectNoResponse()
+}
+
+func TestSuppressNoOpPushes(t *testing.T) {
+	original := features.SuppressNoOpPushes
+	t.Cleanup(func() {
+		features.SuppressNoOpPushes = original
+	})
+
+	features.SuppressNoOpPushes = false
+	s := xds.NewFakeDiscoveryServer(t, xds.FakeOptions{})
+	ads := s.ConnectADS().WithType(v3.ClusterType)
+	ads.RequestResponseAck(nil)
+	// Without suppression, a config change that does not change the clusters is pushed again
+	xds.AdsPushAll(s.Discovery)
+	ads.ExpectResponse()
+	ads.Cleanup()
+
+	features.SuppressNoOpPushes = true
+	s = xds.NewFakeDiscoveryServer(t, xds.FakeOptions{})
+	ads = s.ConnectADS().WithType(v3.ClusterType)
+	req := &discovery.DiscoveryRequest{}
+	res := ads.RequestResponseAck(req)
+	before := sumValue(t, "pilot_xds_noop_pushes_suppressed")
+	xds.AdsPushAll(s.Discovery)
+	ads.ExpectNoResponse()
+	retry.UntilSuccessOrFail(t, func() error {
+		if got := sumValue(t, "pilot_xds_noop_pushes_suppressed"); got != before+1 {
+			return fmt.Errorf("expected %v suppressed pushes, got %v", before+1, got)
+		}
+		return nil
+	})
+
+	// Requests of the proxy are always answered, even if the resources are unchanged
+	req.ResponseNonce = ""
+	if again := ads.RequestResponseAck(req); len(again.Resources) != len(res.Resources) {
+		t.Fatalf("expected %d clusters, got %d", len(res.Resources), len(again.Resources))
+	}
+}
+
+func TestPushOrder(t *testing.T) {
+	original := xds.PushOrder
+	t.Cleanup(func() {
+		xds.PushOrder = original
+	})
+	xds.PushOrder = []string{v3.ListenerType, v3.ClusterType}
+	s := xds.NewFakeDiscoveryServer(t, xds.FakeOptions{})
+
+	ads := s.ConnectADS()
+	ads.RequestResponseAck(&discovery.DiscoveryRequest{TypeUrl: v3.ClusterType})
+	ads.RequestResponseAck(&discovery.DiscoveryRequest{TypeUrl: v3.ListenerType})
+
+	for i := 0; i < 3; i++ {
+		xds.AdsPushAll(s.Discovery)
+		for _, want := range xds.PushOrder {
+			if got := ads.ExpectResponse().TypeUrl; got != want {
+				t.Fatalf("expected %s to be pushed, got %s", want, got)
+			}
+		}
+	}
+}
+
+// tokenAuthenticator authenticates requests carrying a bearer token as the identity mapped to the token.
+type tokenAuthenticator map[string]string
+
+func (a tokenAuthenticator) Authenticate(context.Context) (*security.Caller, error) {
+	return nil, fmt.Errorf("not implemented")
+}
+
+func (a tokenAuthenticator) AuthenticateRequest(req *http.Request) (*security.Caller, error) {
+	id, f := a[strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")]
+	if !f {
+		return nil, fmt.Errorf("invalid token")
+	}
+	return &security.Caller{Identities: []string{id}}, nil
+}
+
+func (a tokenAuthenticator) AuthenticatorType() string {
+	return "TokenAuthenticator"
+}
+
+func postREST(t *testing.T, url, token, id string) *http.Response {
+	t.Helper()
+	body, err := (&jsonpb.Marshaler{}).MarshalToString(&discovery.DiscoveryRequest{
+		Node: &core.Node{Id: id, Metadata: model.NodeMetadata{}.ToStruct()},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := http.NewRequest(http.MethodPost, url+"/v3/discovery:clusters", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestRESTXDS(t *testing.T) {
+	s := xds.NewFakeDiscoveryServer(t, xds.FakeOptions{})
+	s.Discovery.Authenticators = []security.Authenticator{
+		tokenAuthenticator{"default": "spiffe://cluster.local/ns/default/sa/default"},
+	}
+	mux := http.NewServeMux()
+	s.Discovery.AddRESTHandlers(mux)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	ads := s.ConnectADS().WithType(v3.ClusterType)
+	grpcRes := ads.RequestResponseAck(nil)
+
+	resp := postREST(t, srv.URL, "default", ads.ID)
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		b, _ := ioutil.ReadAll(resp.Body)
+		t.Fatalf("unexpected status %d: %s", resp.StatusCode, b)
+	}
+	restRes := &discovery.DiscoveryResponse{}
+	if err := jsonpb.Unmarshal(resp.Body, restRes); err != nil {
+		t.Fatal(err)
+	}
+
+	if restRes.TypeUrl != v3.ClusterType {
+		t.Fatalf("expected type %s, got %s", v3.ClusterType, restRes.TypeUrl)
+	}
+	clusters := func(res *discovery.DiscoveryResponse) map[string]*cluster.Cluster {
+		out := map[string]*cluster.Cluster{}
+		for _, r := range res.Resources {
+			c := &cluster.Cluster{}
+			if err := r.UnmarshalTo(c); err != nil {
+				t.Fatal(err)
+			}
+			out[c.Name] = c
+		}
+		return out
+	}
+	want, got := clusters(grpcRes), clusters(restRes)
+	if len(got) != len(want) {
+		t.Fatalf("expected %d clusters, got %d", len(want), len(got))
+	}
+	for name, c := range want {
+		if !proto.Equal(c, got[name]) {
+			t.Fatalf("cluster %s differs over REST:\n%v\n%v", name, c, got[name])
+		}
+	}
+
+	// The REST request does not hold on to its connection
+	if n := len(s.Discovery.AllClients()); n != 1 {
+		t.Fatalf("expected 1 client, got %d", n)
+	}
+
+	get, err := http.Get(srv.URL + "/v3/discovery:clusters")
+	if err != nil {
+		t.Fatal(err)
+	}
+	get.Body.Close()
+	if get.StatusCode != http.StatusMethodNotAllowed {
+		t.Fatalf("expected GET to be rejected, got %d", get.StatusCode)
+	}
+}
+
+func TestRESTXDSRejections(t *testing.T) {
+	originalLimit := features.ConnectionLimit
+	t.Cleanup(func() {
+		features.ConnectionLimit = originalLimit
+	})
+	features.ConnectionLimit = 1
+	s := xds.NewFakeDiscoveryServer(t, xds.FakeOptions{})
+	s.Discovery.Authenticators = []security.Authenticator{tokenAuthenticator{
+		"default": "spiffe://cluster.local/ns/default/sa/default",
+		"other":   "spiffe://cluster.local/ns/other/sa/default",
+	}}
+	mux := http.NewServeMux()
+	s.Discovery.AddRESTHandlers(mux)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	id := "sidecar~1.1.1.1~test.default~default.svc.cluster.local"
+	expect := func(name, token string, code int) {
+		t.Helper()
+		resp := postREST(t, srv.URL, token, id)
+		b, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != code {
+			t.Fatalf("%s: expected status %d, got %d: %s", name, code, resp.StatusCode, b)
+		}
+	}
+	expect("no credentials", "", http.StatusUnauthorized)
+	expect("invalid credentials", "invalid", http.StatusUnauthorized)
+	expect("identity of another namespace", "other", http.StatusForbidden)
+	expect("authorized", "default", http.StatusOK)
+
+	// A gRPC connection takes the only connection slot
+	s.ConnectADS().WithID("sidecar~1.1.1.2~other.default~default.svc.cluster.local").
+		WithType(v3.ClusterType).RequestResponseAck(nil)
+	expect("connection limit", "default", http.StatusTooManyRequests)
+}
+
+func TestMaxConcurrentPushesPerNode(t *testing.T) {
+	original := features.MaxConcurrentPushesPerNode
+	t.Cleanup(func() {
+		features.MaxConcurrentPushesPerNode = original
+	})
+	features.MaxConcurrentPushesPerNode = 1
+	s := xds.NewFakeDiscoveryServer(t, xds.FakeOptions{})
+	gen := countingGenerator{
+		fixedClusterGenerator: fixedClusterGenerator{name: "counted"},
+		delay:                 50 * time.Millisecond,
+		calls:                 atomic.NewInt32(0),
+		active:                atomic.NewInt32(0),
+		max:                   atomic.NewInt32(0),
+	}
+	s.Discovery.Generators["counting/"+v3.ClusterType] = gen
+	s.Discovery.GeneratorSelectors = []xds.GeneratorSelector{{
+		Match:     func(*model.Proxy) bool { return true },
+		Generator: "counting",
+	}}
+
+	// A flapping proxy reconnects rapidly, with the same node ID, before its earlier connections are closed
+	const connections = 5
+	wg := sync.WaitGroup{}
+	for i := 0; i < connections; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.ConnectADS().WithType(v3.ClusterType).RequestResponseAck(nil)
+		}()
+	}
+	wg.Wait()
+	if c := gen.calls.Load(); c < connections {
+		t.Fatalf("expected a generation per connection, got %d", c)
+	}
+	if m := gen.max.Load(); m != 1 {
+		t.Fatalf("expected at most 1 concurrent generation for the node, got %d", m)
+	}
+}
+
+func TestUnknownNamespacePolicy(t *testing.T) {
+	config := `
+apiVersion: networking.istio.io/v1alpha3
+kind: ServiceEntry
+metadata:
+  name: app
+  namespace: default
+spec:
+  hosts:
+  - app.com
+  ports:
+  - number: 80
+    name: http
+    protocol: HTTP
+  resolution: STATIC
+  endpoints:
+  - address: 1.1.1.1
+`
+	unknownID := "sidecar~1.1.1.1~test.unknown~unknown.svc.cluster.local"
+	setPolicy := func(t *testing.T, policy features.UnknownNamespacePolicyType) {
+		original := features.UnknownNamespacePolicy
+		t.Cleanup(func() {
+			features.UnknownNamespacePolicy = original
+		})
+		features.UnknownNamespacePolicy = policy
+	}
+
+	t.Run("serve", func(t *testing.T) {
+		s := xds.NewFakeDiscoveryServer(t, xds.FakeOptions{ConfigString: config})
+		s.ConnectADS().WithType(v3.ClusterType).WithID(unknownID).RequestResponseAck(nil)
+	})
+	t.Run("reject", func(t *testing.T) {
+		setPolicy(t, features.UnknownNamespaceReject)
+		s := xds.NewFakeDiscoveryServer(t, xds.FakeOptions{ConfigString: config})
+		s.ConnectADS().WithType(v3.ClusterType).RequestResponseAck(nil)
+
+		ads := s.ConnectADS().WithType(v3.ClusterType).WithID(unknownID)
+		ads.Request(nil)
+		if err := ads.ExpectError(); grpcstatus.Code(err) != codes.PermissionDenied {
+			t.Fatalf("expected permission denied, got %v", err)
+		}
+	})
+	t.Run("serve-empty", func(t *testing.T) {
+		setPolicy(t, features.UnknownNamespaceServeEmpty)
+		s := xds.NewFakeDiscoveryServer(t, xds.FakeOptions{ConfigString: config})
+		s.ConnectADS().WithType(v3.ClusterType).RequestResponseAck(nil)
+
+		ads := s.ConnectADS().WithType(v3.ClusterType).WithID(unknownID)
+		ads.Request(nil)
+		ads.ExpectEmptyResponse()
+		xds.AdsPushAll(s.Discovery)
+		ads.ExpectEmptyResponse()
+	})
+}
+
+func TestStandbyMode(t *testing.T) {
+	original := features.StandbyMode
+	t.Cleanup(func() {
+		features.StandbyMode = original
+	})
+	features.StandbyMode = true
+	s := xds.NewFakeDiscoveryServer(t, xds.FakeOptions{})
+	waitCommitted := func() {
+		t.Helper()
+		expected := s.Discovery.InboundUpdates.Load()
+		retry.UntilSuccessOrFail(t, func() error {
+			if s.Discovery.CommittedUpdates.Load() < expected {
+				return fmt.Errorf("updates not yet committed")
+			}
+			return nil
+		}, retry.Timeout(time.Second*5))
+	}
+
+	// A standby serves requests from the initial state
+	ads := s.ConnectADS().WithType(v3.ClusterType)
+	ads.RequestResponseAck(nil)
+
+	// Config changes are not pushed
+	s.Discovery.ConfigUpdate(&model.PushRequest{Full: true})
+	waitCommitted()
+	ads.ExpectNoResponse()
+
+	req := httptest.NewRequest(http.MethodGet, "/debug/promote", nil)
+	rr := httptest.NewRecorder()
+	s.Discovery.PromoteHandler(rr, req)
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected GET to be rejected, got %v", rr.Code)
+	}
+	ads.ExpectNoResponse()
+
+	// Once promoted, config is pushed again
+	req = httptest.NewRequest(http.MethodPost, "/debug/promote", nil)
+	rr = httptest.NewRecorder()
+	s.Discovery.PromoteHandler(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected promotion to succeed, got %v", rr.Code)
+	}
+	ads.ExpectResponse()
+
+	s.Discovery.ConfigUpdate(&model.PushRequest{Full: true})
+	ads.ExpectResponse()
+}
+
+func TestExperimentBucket(t *testing.T) {
+	original := features.ExperimentBucketPercent
+	t.Cleanup(func() {
+		features.ExperimentBucketPercent = original
+	})
+	features.ExperimentBucketPercent = 50
+
+	buckets := func(s *xds.FakeDiscoveryServer) map[string]string {
+		rr := httptest.NewRecorder()
+		s.Discovery.ConnectionsHandler(rr, httptest.NewRequest(http.MethodGet, "/debug/connections", nil))
+		clients := xds.AdsClients{}
+		if err := json.Unmarshal(rr.Body.Bytes(), &clients); err != nil {
+			t.Fatal(err)
+		}
+		out := map[string]string{}
+		for _, c := range clients.Connected {
+			// Strip the connection counter, leaving the proxy ID
+			out[c.ConnectionID[:strings.LastIndex(c.ConnectionID, "-")]] = c.Bucket
+		}
+		return out
+	}
+	connect := func(s *xds.FakeDiscoveryServer, agents int) {
+		for i := 0; i < agents; i++ {
+			id := fmt.Sprintf("sidecar~1.1.1.%d~app-%d.default~default.svc.cluster.local", i, i)
+			s.ConnectADS().WithType(v3.ClusterType).WithID(id).RequestResponseAck(nil)
+		}
+	}
+
+	s := xds.NewFakeDiscoveryServer(t, xds.FakeOptions{})
+	s.Discovery.Generators["experiment/"+v3.ClusterType] = fixedClusterGenerator{name: "experiment"}
+	s.Discovery.ExperimentGenerator = "experiment"
+	connect(s, 40)
+	first := buckets(s)
+	if len(first) != 40 {
+		t.Fatalf("expected 40 connections, got %v", first)
+	}
+	experiment := 0
+	for _, bucket := range first {
+		if bucket == "experiment" {
+			experiment++
+		}
+	}
+	if experiment == 0 || experiment == len(first) {
+		t.Fatalf("expected connections in both buckets, got %v", first)
+	}
+
+	// The experiment bucket is served by the experiment generator
+	for i := 0; i < 40; i++ {
+		id := fmt.Sprintf("sidecar~1.1.1.%d~app-%d.default~default.svc.cluster.local", i, i)
+		resp := s.ConnectADS().WithType(v3.ClusterType).WithID(id).RequestResponseAck(nil)
+		c := &cluster.Cluster{}
+		if err := proto.Unmarshal(resp.Resources[0].Value, c); err != nil {
+			t.Fatal(err)
+		}
+		bucket := first[fmt.Sprintf("app-%d.default", i)]
+		if served := c.Name == "experiment"; served != (bucket == "experiment") {
+			t.Fatalf("expected %v in bucket %v to be served accordingly, got cluster %v", id, bucket, c.Name)
+		}
+	}
+
+	// The same node IDs are bucketed the same on another istiod
+	other := xds.NewFakeDiscoveryServer(t, xds.FakeOptions{})
+	connect(other, 40)
+	if got := buckets(other); !reflect.DeepEqual(got, first) {
+		t.Fatalf("expected deterministic buckets %v, got %v", first, got)
+	}
+
+	// By default all connections are in the control bucket
+	features.ExperimentBucketPercent = 0
+	control := xds.NewFakeDiscoveryServer(t, xds.FakeOptions{})
+	connect(control, 40)
+	for id, bucket := range buckets(control) {
+		if bucket != "control" {
+			t.Fatalf("expected %v in the control bucket, got %v", id, bucket)
+		}
+	}
+}
+
+// spinningGenerator wraps a generator, spinning the CPU for spin before generating.
+type spinningGenerator struct {
+	fixedClusterGenerator
+	spin time.Duration
+}
+
+func (g spinningGenerator) Generate(proxy *model.Proxy, push *model.PushContext, w *model.WatchedResource,
+	req *model.PushRequest) (model.Resources, model.XdsLogDetails, error) {
+	// Busy wait, as sleeping uses no CPU time
+	for deadline := time.Now().Add(g.spin); time.Now().Before(deadline); {
+	}
+	return g.fixedClusterGenerator.Generate(proxy, push, w, req)
+}
+
+func TestGenerationCPUWarnThreshold(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("CPU time is only measured on linux")
+	}
+	original := features.GenerationCPUWarnThreshold
+	t.Cleanup(func() {
+		features.GenerationCPUWarnThreshold = original
+	})
+	features.GenerationCPUWarnThreshold = 50 * time.Millisecond
+	s := xds.NewFakeDiscoveryServer(t, xds.FakeOptions{})
+
+	// A cheap generation does not exceed the threshold
+	before := sumValue(t, "pilot_xds_expensive_generations")
+	s.ConnectADS().WithType(v3.ClusterType).RequestResponseAck(nil)
+	if v := sumValue(t, "pilot_xds_expensive_generations") - before; v != 0 {
+		t.Fatalf("expected no expensive generation, got %v", v)
+	}
+
+	s.Discovery.Generators[v3.ClusterType] = spinningGenerator{
+		fixedClusterGenerator: fixedClusterGenerator{name: "expensive"},
+		spin:                  300 * time.Millisecond,
+	}
+	s.ConnectADS().WithType(v3.ClusterType).RequestResponseAck(nil)
+	if v := sumValue(t, "pilot_xds_expensive_generations") - before; v != 1 {
+		t.Fatalf("expected 1 expensive generation, got %v", v)
+	}
+}
+
+type memoryPushEventSink struct {
+	mu     sync.Mutex
+	events []xds.PushEvent
+}
+
+func (m *memoryPushEventSink) Publish(events []xds.PushEvent) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.events = append(m.events, events...)
+	return nil
+}
+
+func (m *memoryPushEventSink) get() []xds.PushEvent {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]xds.PushEvent{}, m.events...)
+}
+
+func TestPushEvents(t *testing.T) {
+	sink := &memoryPushEventSink{}
+	s := xds.NewFakeDiscoveryServer(t, xds.FakeOptions{
+		DiscoveryServerModifier: func(s *xds.DiscoveryServer) {
+			s.SetPushEventSink(sink)
+		},
+	})
+	expectEvent := func(t *testing.T, node string) {
+		retry.UntilSuccessOrFail(t, func() error {
+			for _, ev := range sink.get() {
+				if ev.Node == node && ev.Type == v3.ClusterType {
+					if ev.Size == 0 || ev.Time.IsZero() {
+						return fmt.Errorf("incomplete push event: %+v", ev)
+					}
+					return nil
+				}
+			}
+			return fmt.Errorf("push event not published, got %+v", sink.get())
+		}, retry.Timeout(5*time.Second))
+	}
+
+	t.Run("sotw", func(t *testing.T) {
+		ads := s.ConnectADS().WithType(v3.ClusterType).WithID("sidecar~1.1.1.1~test.default~default.svc.cluster.local")
+		ads.RequestResponseAck(nil)
+		expectEvent(t, "test.default")
+	})
+	t.Run("delta", func(t *testing.T) {
+		ads := s.ConnectDeltaADS().WithType(v3.ClusterType).WithID("sidecar~1.1.1.2~delta.default~default.svc.cluster.local")
+		ads.RequestResponseAck(nil)
+		expectEvent(t, "delta.default")
+	})
+}
+
+func TestValidateResourceNames(t *testing.T) {
+	original := features.ValidateResourceNames
+	t.Cleanup(func() {
+		features.ValidateResourceNames = original
+	})
+	features.ValidateResourceNames = true
+	s := xds.NewFakeDiscoveryServer(t, xds.FakeOptions{})
+
+	// Valid names are served
+	s.ConnectADS().WithType(v3.EndpointType).
+		RequestResponseAck(&discovery.DiscoveryRequest{ResourceNames: []string{"outbound|80||foo.default.svc.cluster.local"}})
+	s.ConnectADS().WithType(v3.RouteType).RequestResponseAck(&discovery.DiscoveryRequest{ResourceNames: []string{"80", "foo:8080"}})
+
+	cases := []struct {
+		name     string
+		typeURL  string
+		resource string
+		message  string
+	}{
+		{"whitespace", v3.ClusterType, "foo bar", `invalid character ' '`},
+		{"cluster port", v3.EndpointType, "outbound|http||foo.default.svc.cluster.local", `invalid port "http"`},
+		{"cluster parts", v3.EndpointType, "outbound|80|foo.default.svc.cluster.local", "expected direction|port|subset|hostname"},
+		{"route port", v3.RouteType, "foo:99999", `invalid port "99999"`},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			ads := s.ConnectADS().WithType(tt.typeURL)
+			ads.Request(&discovery.DiscoveryRequest{ResourceNames: []string{tt.resource}})
+			err := ads.ExpectError()
+			if grpcstatus.Code(err) != codes.InvalidArgument {
+				t.Fatalf("expected the request to be rejected, got %v", err)
+			}
+			if !strings.Contains(grpcstatus.Convert(err).Message(), tt.message) {
+				t.Fatalf("expected error %q, got %v", tt.message, err)
+			}
+		})
+	}
+}
+
+func TestConnectionGoroutinesMetric(t *testing.T) {
+	original := features.XDSRuntimeStatsInterval
+	t.Cleanup(func() {
+		features.XDSRuntimeStatsInterval = original
+	})
+	features.XDSRuntimeStatsInterval = 10 * time.Millisecond
+	s := xds.NewFakeDiscoveryServer(t, xds.FakeOptions{})
+
+	gauge := func(name string) float64 {
+		data, err := view.RetrieveData(name)
+		if err != nil || len(data) == 0 {
+			return -1
+		}
+		return data[0].Data.(*view.LastValueData).Value
+	}
+	expectGoroutines := func(connections int) {
+		t.Helper()
+		retry.UntilSuccessOrFail(t, func() error {
+			// Each connection is served by its stream and receive goroutines
+			if got, want := gauge("pilot_xds_connection_goroutines"), float64(2*connections); got != want {
+				return fmt.Errorf("expected %v connection goroutines, got %v", want, got)
+			}
+			if connections == 0 {
+				return nil
+			}
+			if got := gauge("pilot_xds_goroutines_per_connection"); got != 2 {
+				return fmt.Errorf("expected 2 goroutines per connection, got %v", got)
+			}
+			return nil
+		}, retry.Timeout(5*time.Second))
+	}
+
+	var conns []*xds.AdsTest
+	for i := 0; i < 3; i++ {
+		ads := s.ConnectADS().WithType(v3.ClusterType).WithID(fmt.Sprintf("sidecar~1.1.1.1~app-%d.default~default.svc.cluster.local", i))
+		ads.RequestResponseAck(nil)
+		conns = append(conns, ads)
+	}
+	expectGoroutines(3)
+
+	conns[0].Cleanup()
+	expectGoroutines(2)
+
+	if gauge("pilot_xds_cache_bytes") < 0 {
+		t.Fatalf("expected the cache size to be recorded")
+	}
+}
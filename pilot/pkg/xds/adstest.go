@@ -77,6 +77,7 @@ type AdsTest struct {
 	t         test.Failer
 	conn      *grpc.ClientConn
 	metadata  model.NodeMetadata
+	locality  *core.Locality
 
 	ID   string
 	Type string
@@ -153,6 +154,23 @@ func (a *AdsTest) ExpectResponse() *discovery.DiscoveryResponse {
 	return nil
 }
 
+// ExpectEmptyResponse waits until a response without resources is received and returns it
+func (a *AdsTest) ExpectEmptyResponse() *discovery.DiscoveryResponse {
+	a.t.Helper()
+	select {
+	case <-time.After(a.timeout):
+		a.t.Fatalf("did not get response in time")
+	case resp := <-a.responses:
+		if resp == nil || len(resp.Resources) != 0 {
+			a.t.Fatalf("got unexpected non-empty response: %v", resp)
+		}
+		return resp
+	case err := <-a.error:
+		a.t.Fatalf("got error: %v", err)
+	}
+	return nil
+}
+
 // ExpectError waits until an error is received and returns it
 func (a *AdsTest) ExpectError() error {
 	a.t.Helper()
@@ -187,6 +205,7 @@ func (a *AdsTest) fillInRequestDefaults(req *discovery.DiscoveryRequest) *discov
 		req.Node = &core.Node{
 			Id:       a.ID,
 			Metadata: a.metadata.ToStruct(),
+			Locality: a.locality,
 		}
 	}
 	return req
@@ -240,6 +259,11 @@ func (a *AdsTest) WithMetadata(m model.NodeMetadata) *AdsTest {
 	return a
 }
 
+func (a *AdsTest) WithLocality(l *core.Locality) *AdsTest {
+	a.locality = l
+	return a
+}
+
 func (a *AdsTest) WithTimeout(t time.Duration) *AdsTest {
 	a.timeout = t
 	return a
@@ -18,6 +18,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/http"
 	"strings"
 
 	"google.golang.org/grpc/credentials"
@@ -65,3 +66,23 @@ func (s *DiscoveryServer) authenticate(ctx context.Context) ([]string, error) {
 	log.Errorf("Failed to authenticate client from %s: %s", peerInfo.Addr.String(), strings.Join(authFailMsgs, "; "))
 	return nil, errors.New("authentication failure")
 }
+
+// authenticateRequest authenticates a REST xDS request using the configured authenticators, returning the
+// validated principals or an error. Unlike authenticate, plain text requests are not trusted: the REST handlers
+// are served on the plain text HTTP port, so a request is only accepted if an authenticator validates it.
+func (s *DiscoveryServer) authenticateRequest(req *http.Request) ([]string, error) {
+	if !features.XDSAuth {
+		return nil, nil
+	}
+	authFailMsgs := []string{}
+	for _, authn := range s.Authenticators {
+		u, err := authn.AuthenticateRequest(req)
+		if u != nil && u.Identities != nil && err == nil {
+			return u.Identities, nil
+		}
+		authFailMsgs = append(authFailMsgs, fmt.Sprintf("Authenticator %s: %v", authn.AuthenticatorType(), err))
+	}
+
+	log.Errorf("Failed to authenticate REST client from %s: %s", req.RemoteAddr, strings.Join(authFailMsgs, "; "))
+	return nil, errors.New("authentication failure")
+}
@@ -94,6 +94,10 @@ type AdsClient struct {
 	ConnectionID string              `json:"connectionId"`
 	ConnectedAt  time.Time           `json:"connectedAt"`
 	PeerAddress  string              `json:"address"`
+	Bucket       string              `json:"bucket,omitempty"`
+	LastPushedAt *time.Time          `json:"lastPushedAt,omitempty"`
+	Staleness    string              `json:"staleness"`
+	Goroutines   int                 `json:"goroutines"`
 	Watches      map[string][]string `json:"watches,omitempty"`
 }
 
@@ -116,6 +120,18 @@ type SyncStatus struct {
 	RouteAcked    string `json:"route_acked,omitempty"`
 	EndpointSent  string `json:"endpoint_sent,omitempty"`
 	EndpointAcked string `json:"endpoint_acked,omitempty"`
+	// PushVersion is the version of the current push, all proxies converge to.
+	PushVersion string `json:"push_version,omitempty"`
+	// Types is the synchronization status of each type URL watched by the proxy.
+	Types map[string]TypeSyncStatus `json:"types,omitempty"`
+}
+
+// TypeSyncStatus is the synchronization status of a type of resource between Pilot and a given Envoy.
+type TypeSyncStatus struct {
+	VersionSent  string `json:"version_sent,omitempty"`
+	VersionAcked string `json:"version_acked,omitempty"`
+	// Synced is set if the version acked by the proxy is the current push version.
+	Synced bool `json:"synced"`
 }
 
 // SyncedVersions shows what resourceVersion of a given resource has been acked by Envoy.
@@ -192,11 +208,15 @@ func (s *DiscoveryServer) AddDebugHandlers(mux, internalMux *http.ServeMux, enab
 	s.addDebugHandler(mux, internalMux, "/debug/push_status", "Last PushContext Details", s.PushStatusHandler)
 	s.addDebugHandler(mux, internalMux, "/debug/pushcontext", "Debug support for current push context", s.PushContextHandler)
 	s.addDebugHandler(mux, internalMux, "/debug/connections", "Info about the connected XDS clients", s.ConnectionsHandler)
+	s.addDebugHandler(mux, internalMux, "/debug/connections/", "Recent push errors of a proxy, at /debug/connections/{id}/errors",
+		s.ConnectionErrorsHandler)
 
 	s.addDebugHandler(mux, internalMux, "/debug/inject", "Active inject template", s.InjectTemplateHandler(webhook))
 	s.addDebugHandler(mux, internalMux, "/debug/mesh", "Active mesh config", s.MeshHandler)
 	s.addDebugHandler(mux, internalMux, "/debug/networkz", "List cross-network gateways", s.networkz)
 
+	s.addDebugHandler(mux, internalMux, "/debug/promote", "Promotes a standby istiod to full operation. POST only", s.PromoteHandler)
+
 	s.addDebugHandler(mux, internalMux, "/debug/list", "List all supported debug commands in json", s.List)
 }
 
@@ -211,6 +231,17 @@ func (s *DiscoveryServer) addDebugHandler(mux *http.ServeMux, internalMux *http.
 	mux.HandleFunc(path, s.allowAuthenticatedOrLocalhost(http.HandlerFunc(handler)))
 }
 
+// AddDebugHandler registers an additional debug handler on mux, using the same authentication as the built-in
+// debug handlers. It returns an error if a debug handler is already registered for path.
+func (s *DiscoveryServer) AddDebugHandler(mux *http.ServeMux, path string, help string, handler http.Handler) error {
+	if _, f := s.debugHandlers[path]; f {
+		return fmt.Errorf("debug handler for %v already registered", path)
+	}
+	s.debugHandlers[path] = help
+	mux.HandleFunc(path, s.allowAuthenticatedOrLocalhost(handler))
+	return nil
+}
+
 func (s *DiscoveryServer) allowAuthenticatedOrLocalhost(next http.Handler) http.HandlerFunc {
 	return func(w http.ResponseWriter, req *http.Request) {
 		// Request is from localhost, no need to authenticate
@@ -255,6 +286,7 @@ func isRequestFromLocalhost(r *http.Request) bool {
 // Syncz dumps the synchronization status of all Envoys connected to this Pilot instance
 func (s *DiscoveryServer) Syncz(w http.ResponseWriter, _ *http.Request) {
 	syncz := make([]SyncStatus, 0)
+	pushVersion := versionInfo()
 	for _, con := range s.Clients() {
 		node := con.proxy
 		if node != nil {
@@ -269,12 +301,33 @@ func (s *DiscoveryServer) Syncz(w http.ResponseWriter, _ *http.Request) {
 				RouteAcked:    con.NonceAcked(v3.RouteType),
 				EndpointSent:  con.NonceSent(v3.EndpointType),
 				EndpointAcked: con.NonceAcked(v3.EndpointType),
+				PushVersion:   pushVersion,
+				Types:         con.syncStatus(pushVersion),
 			})
 		}
 	}
 	writeJSON(w, syncz)
 }
 
+// syncStatus returns the synchronization status of each type watched by the proxy, other than debug types,
+// against the push version.
+func (conn *Connection) syncStatus(pushVersion string) map[string]TypeSyncStatus {
+	conn.proxy.RLock()
+	defer conn.proxy.RUnlock()
+	types := make(map[string]TypeSyncStatus, len(conn.proxy.WatchedResources))
+	for typeURL, w := range conn.proxy.WatchedResources {
+		if strings.HasPrefix(typeURL, v3.DebugType) {
+			continue
+		}
+		types[typeURL] = TypeSyncStatus{
+			VersionSent:  w.VersionSent,
+			VersionAcked: w.VersionAcked,
+			Synced:       w.VersionAcked == pushVersion,
+		}
+	}
+	return types
+}
+
 // registryz providees debug support for registry - adding and listing model items.
 // Can be combined with the push debug interface to reproduce changes.
 func (s *DiscoveryServer) registryz(w http.ResponseWriter, req *http.Request) {
@@ -471,11 +524,18 @@ func (s *DiscoveryServer) ConnectionsHandler(w http.ResponseWriter, req *http.Re
 	connections := s.Clients()
 	adsClients.Total = len(connections)
 
+	now := time.Now()
 	for _, c := range connections {
 		adsClient := AdsClient{
 			ConnectionID: c.ConID,
 			ConnectedAt:  c.Connect,
 			PeerAddress:  c.PeerAddr,
+			Bucket:       c.bucket,
+			Staleness:    c.pushStaleness(now).String(),
+			Goroutines:   int(c.goroutines.Load()),
+		}
+		if last, ok := c.lastPushTime(); ok {
+			adsClient.LastPushedAt = &last
 		}
 		adsClients.Connected = append(adsClients.Connected, adsClient)
 	}
@@ -497,6 +557,7 @@ func (s *DiscoveryServer) adsz(w http.ResponseWriter, req *http.Request) {
 			ConnectionID: c.ConID,
 			ConnectedAt:  c.Connect,
 			PeerAddress:  c.PeerAddr,
+			Bucket:       c.bucket,
 			Watches:      map[string][]string{},
 		}
 		c.proxy.RLock()
@@ -521,7 +582,13 @@ func (s *DiscoveryServer) ConfigDump(w http.ResponseWriter, req *http.Request) {
 	if con == nil {
 		return
 	}
-	dump, err := s.configDump(con)
+	var dump *adminapi.ConfigDump
+	var err error
+	if con.pushed != nil {
+		dump, err = pushedConfigDump(con)
+	} else {
+		dump, err = s.configDump(con)
+	}
 	if err != nil {
 		handleHTTPError(w, err)
 		return
@@ -529,6 +596,43 @@ func (s *DiscoveryServer) ConfigDump(w http.ResponseWriter, req *http.Request) {
 	writeJSONProto(w, dump)
 }
 
+// pushedConfigDump converts the resources last pushed to the connection into an Envoy Admin API config dump proto.
+// Unlike configDump, this reflects exactly what was sent to the proxy rather than regenerating the config.
+func pushedConfigDump(conn *Connection) (*adminapi.ConfigDump, error) {
+	clusters := &adminapi.ClustersConfigDump{VersionInfo: versionInfo()}
+	for _, r := range conn.pushed.get(v3.ClusterType) {
+		clusters.DynamicActiveClusters = append(clusters.DynamicActiveClusters,
+			&adminapi.ClustersConfigDump_DynamicCluster{Cluster: r.Resource})
+	}
+	listeners := &adminapi.ListenersConfigDump{VersionInfo: versionInfo()}
+	for _, r := range conn.pushed.get(v3.ListenerType) {
+		listeners.DynamicListeners = append(listeners.DynamicListeners, &adminapi.ListenersConfigDump_DynamicListener{
+			Name:        r.Name,
+			ActiveState: &adminapi.ListenersConfigDump_DynamicListenerState{Listener: r.Resource},
+		})
+	}
+	routes := &adminapi.RoutesConfigDump{}
+	for _, r := range conn.pushed.get(v3.RouteType) {
+		routes.DynamicRouteConfigs = append(routes.DynamicRouteConfigs,
+			&adminapi.RoutesConfigDump_DynamicRouteConfig{RouteConfig: r.Resource})
+	}
+	endpoints := &adminapi.EndpointsConfigDump{}
+	for _, r := range conn.pushed.get(v3.EndpointType) {
+		endpoints.DynamicEndpointConfigs = append(endpoints.DynamicEndpointConfigs,
+			&adminapi.EndpointsConfigDump_DynamicEndpointConfig{EndpointConfig: r.Resource})
+	}
+
+	configs := make([]*any.Any, 0, 5)
+	for _, m := range []proto.Message{&adminapi.BootstrapConfigDump{}, clusters, listeners, routes, endpoints} {
+		a, err := util.MessageToAnyWithError(m)
+		if err != nil {
+			return nil, err
+		}
+		configs = append(configs, a)
+	}
+	return &adminapi.ConfigDump{Configs: configs}, nil
+}
+
 // configDump converts the connection internal state into an Envoy Admin API config dump proto
 // It is used in debugging to create a consistent object for comparison between Envoy and Pilot outputs
 func (s *DiscoveryServer) configDump(conn *Connection) (*adminapi.ConfigDump, error) {
@@ -16,17 +16,27 @@ package xds_test
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
+	admin "github.com/envoyproxy/go-control-plane/envoy/admin/v3"
+	cluster "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
 	discovery "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	"github.com/golang/protobuf/proto"
 
 	"istio.io/istio/istioctl/pkg/util/configdump"
+	"istio.io/istio/pilot/pkg/features"
 	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/util/sets"
 	"istio.io/istio/pilot/pkg/xds"
 	v3 "istio.io/istio/pilot/pkg/xds/v3"
+	"istio.io/istio/pkg/test/util/retry"
 	"istio.io/istio/tests/util/leak"
 )
 
@@ -69,6 +79,46 @@ func TestSyncz(t *testing.T) {
 	})
 }
 
+func TestSyncStatusTypes(t *testing.T) {
+	s := xds.NewFakeDiscoveryServer(t, xds.FakeOptions{})
+	synced := s.ConnectADS().WithType(v3.ClusterType).WithID("sidecar~1.1.1.1~synced.default~default.svc.cluster.local")
+	synced.RequestResponseAck(nil)
+	pending := s.ConnectADS().WithType(v3.ClusterType).WithID("sidecar~1.1.1.2~pending.default~default.svc.cluster.local")
+	pending.Request(nil)
+	pending.ExpectResponse()
+	nacked := s.ConnectADS().WithType(v3.ClusterType).WithID("sidecar~1.1.1.3~nacked.default~default.svc.cluster.local")
+	nacked.RequestResponseNack(nil)
+
+	want := map[string]bool{
+		"synced.default":  true,
+		"pending.default": false,
+		"nacked.default":  false,
+	}
+	retry.UntilSuccessOrFail(t, func() error {
+		got := map[string]bool{}
+		for _, ss := range getSyncStatus(t, s.Discovery) {
+			if _, f := want[ss.ProxyID]; !f {
+				continue
+			}
+			if ss.PushVersion == "" {
+				return fmt.Errorf("push version not set for %v", ss.ProxyID)
+			}
+			status, f := ss.Types[v3.ClusterType]
+			if !f {
+				return fmt.Errorf("cluster status not set for %v", ss.ProxyID)
+			}
+			if status.VersionSent == "" {
+				return fmt.Errorf("sent version not set for %v", ss.ProxyID)
+			}
+			got[ss.ProxyID] = status.Synced
+		}
+		if !reflect.DeepEqual(got, want) {
+			return fmt.Errorf("got sync status %v, want %v", got, want)
+		}
+		return nil
+	}, retry.Timeout(5*time.Second))
+}
+
 func getSyncStatus(t *testing.T, server *xds.DiscoveryServer) []xds.SyncStatus {
 	req, err := http.NewRequest("GET", "/debug", nil)
 	if err != nil {
@@ -178,6 +228,67 @@ func TestConfigDump(t *testing.T) {
 	}
 }
 
+func TestPushedConfigDump(t *testing.T) {
+	leak.Check(t)
+	original := features.EnablePushedConfigDump
+	t.Cleanup(func() {
+		features.EnablePushedConfigDump = original
+	})
+	features.EnablePushedConfigDump = true
+	s := xds.NewFakeDiscoveryServer(t, xds.FakeOptions{})
+	ads := s.ConnectADS()
+	cds := ads.RequestResponseAck(&discovery.DiscoveryRequest{TypeUrl: v3.ClusterType})
+	eds := ads.RequestResponseAck(&discovery.DiscoveryRequest{
+		TypeUrl:       v3.EndpointType,
+		ResourceNames: []string{"outbound|9080||app2.default.svc.cluster.local"},
+	})
+	ads.RequestResponseAck(&discovery.DiscoveryRequest{TypeUrl: v3.ListenerType})
+
+	wrapper := getConfigDump(t, s.Discovery, "test.default", 200)
+	clusters, err := wrapper.GetDynamicClusterDump(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pushedClusters := sets.NewSet()
+	for _, r := range cds.Resources {
+		c := &cluster.Cluster{}
+		if err := r.UnmarshalTo(c); err != nil {
+			t.Fatal(err)
+		}
+		pushedClusters.Insert(c.Name)
+	}
+	dumpedClusters := sets.NewSet()
+	for _, c := range clusters.DynamicActiveClusters {
+		cl := &cluster.Cluster{}
+		if err := c.Cluster.UnmarshalTo(cl); err != nil {
+			t.Fatal(err)
+		}
+		dumpedClusters.Insert(cl.Name)
+	}
+	if !reflect.DeepEqual(pushedClusters, dumpedClusters) {
+		t.Fatalf("expected clusters %v, got %v", pushedClusters.SortedList(), dumpedClusters.SortedList())
+	}
+
+	var endpoints *admin.EndpointsConfigDump
+	for _, c := range wrapper.Configs {
+		if c.TypeUrl == "type.googleapis.com/envoy.admin.v3.EndpointsConfigDump" {
+			endpoints = &admin.EndpointsConfigDump{}
+			if err := c.UnmarshalTo(endpoints); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if endpoints == nil || len(endpoints.DynamicEndpointConfigs) != len(eds.Resources) {
+		t.Fatalf("expected %d endpoint configs, got %v", len(eds.Resources), endpoints)
+	}
+	if !proto.Equal(endpoints.DynamicEndpointConfigs[0].EndpointConfig, eds.Resources[0]) {
+		t.Fatalf("dumped endpoints do not match pushed endpoints")
+	}
+
+	// A proxy that is not connected is not found
+	getConfigDump(t, s.Discovery, "not-found", 404)
+}
+
 func getConfigDump(t *testing.T, s *xds.DiscoveryServer, proxyID string, wantCode int) *configdump.Wrapper {
 	path := "/config_dump"
 	if proxyID != "" {
@@ -217,3 +328,127 @@ func TestDebugHandlers(t *testing.T) {
 		t.Errorf("Error in generatating debug endpoint list")
 	}
 }
+
+// failingGenerator fails every generation.
+type failingGenerator struct {
+	err error
+}
+
+func (g failingGenerator) Generate(*model.Proxy, *model.PushContext, *model.WatchedResource,
+	*model.PushRequest) (model.Resources, model.XdsLogDetails, error) {
+	return nil, model.DefaultXdsLogDetails, g.err
+}
+
+func TestConnectionErrors(t *testing.T) {
+	s := xds.NewFakeDiscoveryServer(t, xds.FakeOptions{})
+	s.Discovery.Generators[v3.ClusterType] = failingGenerator{err: errors.New("injected generation failure")}
+	id := "sidecar~1.1.1.1~failing.default~default.svc.cluster.local"
+
+	getErrors := func(id string, wantCode int) []xds.ProxyError {
+		t.Helper()
+		req, err := http.NewRequest("GET", "/debug/connections/"+id+"/errors", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(s.Discovery.ConnectionErrorsHandler).ServeHTTP(rr, req)
+		if rr.Code != wantCode {
+			t.Fatalf("wanted response code %v, got %v", wantCode, rr.Code)
+		}
+		if wantCode != http.StatusOK {
+			return nil
+		}
+		got := []xds.ProxyError{}
+		if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+
+	// A connected proxy without errors has none reported
+	s.ConnectADS().WithType(v3.ListenerType).WithID(id).RequestResponseAck(nil)
+	if got := getErrors(id, http.StatusOK); len(got) != 0 {
+		t.Fatalf("expected no errors, got %v", got)
+	}
+
+	// The failing generation closes the connection, but its error is still reported
+	ads := s.ConnectADS().WithType(v3.ClusterType).WithID(id)
+	ads.Request(nil)
+	ads.ExpectError()
+	got := getErrors(id, http.StatusOK)
+	if len(got) != 1 || got[0].TypeURL != v3.ClusterType || !strings.Contains(got[0].Error, "injected generation failure") {
+		t.Fatalf("expected the injected generation error, got %v", got)
+	}
+
+	// Errors of delta connections are reported too
+	deltaID := "sidecar~1.1.1.2~delta.default~default.svc.cluster.local"
+	delta := s.ConnectDeltaADS().WithType(v3.ClusterType).WithID(deltaID)
+	delta.Request(nil)
+	delta.ExpectError()
+	got = getErrors(deltaID, http.StatusOK)
+	if len(got) != 1 || got[0].TypeURL != v3.ClusterType || !strings.Contains(got[0].Error, "injected generation failure") {
+		t.Fatalf("expected the injected generation error of the delta connection, got %v", got)
+	}
+
+	getErrors("sidecar~1.1.1.1~unknown.default~default.svc.cluster.local", http.StatusNotFound)
+}
+
+func TestConnectionsPushStaleness(t *testing.T) {
+	s := xds.NewFakeDiscoveryServer(t, xds.FakeOptions{})
+
+	getClients := func() map[string]xds.AdsClient {
+		t.Helper()
+		req, err := http.NewRequest("GET", "/debug/connections", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(s.Discovery.ConnectionsHandler).ServeHTTP(rr, req)
+		got := xds.AdsClients{}
+		if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+			t.Fatal(err)
+		}
+		clients := map[string]xds.AdsClient{}
+		for _, c := range got.Connected {
+			clients[strings.SplitN(c.ConnectionID, "-", 2)[0]] = c
+		}
+		return clients
+	}
+	staleness := func(c xds.AdsClient) time.Duration {
+		t.Helper()
+		d, err := time.ParseDuration(c.Staleness)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+
+	pushed := s.ConnectADS().WithType(v3.ClusterType).WithID("sidecar~1.1.1.1~pushed.default~default.svc.cluster.local")
+	pushed.RequestResponseAck(nil)
+	// Debug responses are not pushes of config, so this proxy is never pushed.
+	idle := s.ConnectADS().WithType(v3.DebugType + "/syncz").WithID("sidecar~1.1.1.2~idle.default~default.svc.cluster.local")
+	idle.Request(nil)
+	idle.ExpectEmptyResponse()
+
+	before := getClients()
+	if before["pushed.default"].LastPushedAt == nil {
+		t.Fatalf("expected the last push time of the pushed proxy, got %+v", before["pushed.default"])
+	}
+	if before["idle.default"].LastPushedAt != nil {
+		t.Fatalf("expected no last push time for the idle proxy, got %+v", before["idle.default"])
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	s.Discovery.Push(&model.PushRequest{Full: true})
+	pushed.ExpectResponse()
+
+	after := getClients()
+	if !after["pushed.default"].LastPushedAt.After(*before["pushed.default"].LastPushedAt) {
+		t.Fatalf("expected the last push time to be updated, got %v then %v",
+			before["pushed.default"].LastPushedAt, after["pushed.default"].LastPushedAt)
+	}
+	if staleness(after["idle.default"]) <= staleness(before["idle.default"]) {
+		t.Fatalf("expected the staleness of the idle proxy to grow, got %v then %v",
+			before["idle.default"].Staleness, after["idle.default"].Staleness)
+	}
+}
@@ -15,6 +15,8 @@
 package xds
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"strings"
@@ -80,6 +82,10 @@ func (s *DiscoveryServer) StreamDeltas(stream DeltaDiscoveryStream) error {
 	}
 	con := newDeltaConnection(peerAddr, stream)
 	con.Identities = ids
+	if s.strictNonceValidation {
+		con.sentNonces = map[string][]string{}
+	}
+	defer s.trackGoroutine(con)()
 
 	// Do not call: defer close(con.pushChannel). The push channel will be garbage collected
 	// when the connection is no longer used. Closing the channel can cause subtle race conditions
@@ -90,12 +96,17 @@ func (s *DiscoveryServer) StreamDeltas(stream DeltaDiscoveryStream) error {
 	// We need 2 go routines because 'read' blocks in Recv().
 	go s.receiveDelta(con)
 
-	// Wait for the proxy to be fully initialized before we start serving traffic. Because
-	// initialization doesn't have dependencies that will block, there is no need to add any timeout
-	// here. Prior to this explicit wait, we were implicitly waiting by receive() not sending to
-	// reqChannel and the connection not being enqueued for pushes to pushChannel until the
-	// initialization is complete.
-	<-con.initialized
+	// Wait for the proxy to be fully initialized before we start serving traffic. Initialization
+	// doesn't have dependencies that will block, but the first request may never come, which is
+	// bounded by InitialRequestTimeout. Prior to this explicit wait, we were implicitly waiting by
+	// receive() not sending to reqChannel and the connection not being enqueued for pushes to
+	// pushChannel until the initialization is complete.
+	if err := waitForInitialRequest(con); err != nil {
+		return err
+	}
+
+	lifetime, stopLifetime := connectionLifetime()
+	defer stopLifetime()
 
 	for {
 		select {
@@ -104,7 +115,9 @@ func (s *DiscoveryServer) StreamDeltas(stream DeltaDiscoveryStream) error {
 				// processRequest is calling pushXXX, accessing common structs with pushConnection.
 				// Adding sync is the second issue to be resolved if we want to save 1/2 of the threads.
 				log.Debugf("Got Delta Request: %+v", req.TypeUrl)
-				if err := s.processDeltaRequest(req, con); err != nil {
+				if err := s.withRequestSlot(con, func() error {
+					return s.processDeltaRequest(req, con)
+				}); err != nil {
 					return err
 				}
 			} else {
@@ -119,6 +132,12 @@ func (s *DiscoveryServer) StreamDeltas(stream DeltaDiscoveryStream) error {
 			}
 		case <-con.stop:
 			return nil
+		case <-s.drain:
+			log.Infof("ADS: closing connection for node:%s, istiod is draining", con.ConID)
+			return nil
+		case <-lifetime:
+			log.Infof("ADS: closing connection for node:%s, maximum connection lifetime reached", con.ConID)
+			return nil
 		}
 	}
 }
@@ -128,7 +147,16 @@ func (s *DiscoveryServer) StreamDeltas(stream DeltaDiscoveryStream) error {
 func (s *DiscoveryServer) pushConnectionDelta(con *Connection, pushEv *Event) error {
 	pushRequest := pushEv.pushRequest
 
+	if s.pushesFrozen() {
+		log.Debugf("Skipping push to %v, pushes are frozen while degraded", con.ConID)
+		degradedSkippedPushes.Increment()
+		return nil
+	}
+
 	if pushRequest.Full {
+		if err := con.waitForAbandonedGenerations(); err != nil {
+			return err
+		}
 		// Update Proxy with current information.
 		s.updateProxy(con.proxy, pushRequest)
 	}
@@ -190,6 +218,7 @@ func (s *DiscoveryServer) pushConnectionDelta(con *Connection, pushEv *Event) er
 }
 
 func (s *DiscoveryServer) receiveDelta(con *Connection) {
+	defer s.trackGoroutine(con)()
 	defer func() {
 		close(con.deltaReqChan)
 		close(con.errorChan)
@@ -259,7 +288,11 @@ func (conn *Connection) sendDelta(res *discovery.DeltaDiscoveryResponse) error {
 			conn.proxy.WatchedResources[res.TypeUrl].VersionSent = res.SystemVersionInfo
 			conn.proxy.WatchedResources[res.TypeUrl].LastSent = time.Now()
 			conn.proxy.WatchedResources[res.TypeUrl].LastSize = sz
+			if conn.sentNonces != nil {
+				conn.recordSentNonce(res.TypeUrl, res.Nonce)
+			}
 			conn.proxy.Unlock()
+			conn.lastPush.Store(time.Now().UnixNano())
 		}
 	} else {
 		log.Infof("Timeout writing %s", conn.ConID)
@@ -272,6 +305,15 @@ func (conn *Connection) sendDelta(res *discovery.DeltaDiscoveryResponse) error {
 // handles 'push' requests and close - the code will eventually call the 'push' code, and it needs more mutex
 // protection. Original code avoided the mutexes by doing both 'push' and 'process requests' in same thread.
 func (s *DiscoveryServer) processDeltaRequest(req *discovery.DeltaDiscoveryRequest, con *Connection) error {
+	req.TypeUrl = s.translateTypeURL(req.TypeUrl)
+	if err := checkRequestResources(con, req.TypeUrl, len(req.ResourceNamesSubscribe)); err != nil {
+		return err
+	}
+	if features.ValidateResourceNames {
+		if err := checkResourceNames(con, req.TypeUrl, req.ResourceNamesSubscribe); err != nil {
+			return err
+		}
+	}
 	if !s.shouldProcessRequest(con.proxy, deltaToSotwRequest(req)) {
 		return nil
 	}
@@ -283,6 +325,12 @@ func (s *DiscoveryServer) processDeltaRequest(req *discovery.DeltaDiscoveryReque
 	if s.StatusReporter != nil {
 		s.StatusReporter.RegisterEvent(con.ConID, req.TypeUrl, req.ResponseNonce)
 	}
+	if s.strictNonceValidation && req.ErrorDetail == nil {
+		if err := checkResponseNonce(con, req.TypeUrl, req.ResponseNonce); err != nil {
+			return err
+		}
+	}
+	con.updateDeltaVersions(req)
 	shouldRespond := s.shouldRespondDelta(con, req)
 
 	var request *model.PushRequest
@@ -413,10 +461,14 @@ func (s *DiscoveryServer) pushDeltaXds(con *Connection, push *model.PushContext,
 	if gen == nil {
 		return nil
 	}
+	push = s.meshOverridePush(con.proxy, push)
 
 	t0 := time.Now()
 
-	res, logdata, err := gen.Generate(con.proxy, push, w, req)
+	res, logdata, err := s.generate(con, gen, push, w, req)
+	if err != nil {
+		s.recordProxyError(con, w.TypeUrl, err)
+	}
 	if err != nil || res == nil {
 		// If we have nothing to send, report that we got an ACK for this version.
 		if s.StatusReporter != nil {
@@ -424,23 +476,12 @@ func (s *DiscoveryServer) pushDeltaXds(con *Connection, push *model.PushContext,
 		}
 		return err
 	}
-	defer func() { recordPushTime(w.TypeUrl, time.Since(t0)) }()
+	defer func() { recordPushTime(w.TypeUrl, time.Since(t0), con) }()
 
 	originalNames := extractNames(res)
-	if subscribe != nil {
-		// If subscribe is set, client is requesting specific resources. We should just give it the
-		// new resources it needs, rather than the entire set of known resources.
-		subres := sets.NewSet(subscribe...)
-		filteredResponse := []*discovery.Resource{}
-		for _, r := range res {
-			if subres.Contains(r.Name) {
-				filteredResponse = append(filteredResponse, r)
-			} else {
-				log.Debugf("ADS:%v SKIP %v", v3.GetShortType(w.TypeUrl), r.Name)
-			}
-		}
-		res = filteredResponse
-	}
+	// The first response for a type must always be sent, even if empty, so the client can complete initialization.
+	_, sentBefore := con.deltaVersions[w.TypeUrl]
+	res = con.changedDeltaResources(w.TypeUrl, res, subscribe)
 	resp := &discovery.DeltaDiscoveryResponse{
 		ControlPlane:      ControlPlane(),
 		TypeUrl:           w.TypeUrl,
@@ -448,19 +489,31 @@ func (s *DiscoveryServer) pushDeltaXds(con *Connection, push *model.PushContext,
 		Nonce:             nonce(push.LedgerVersion),
 		Resources:         res,
 	}
-	// We take the set of watched resources and anything not in the response is sent as RemovedResources
-	// This is similar to SotW, but done on the server side instead of the client.
-	cur := sets.NewSet(w.ResourceNames...)
-	cur.Delete(originalNames...)
-	resp.RemovedResources = cur.SortedList()
-	if len(resp.RemovedResources) > 0 {
-		log.Infof("ADS:%v REMOVE %v", v3.GetShortType(w.TypeUrl), resp.RemovedResources)
+	// Incremental generators only return the resources that changed, so anything missing from the
+	// response is still valid and must not be removed.
+	if !logdata.Incremental {
+		// We take the set of watched resources and anything not in the response is sent as RemovedResources
+		// This is similar to SotW, but done on the server side instead of the client.
+		cur := sets.NewSet(w.ResourceNames...)
+		cur.Delete(originalNames...)
+		resp.RemovedResources = cur.SortedList()
+		if len(resp.RemovedResources) > 0 {
+			log.Infof("ADS:%v REMOVE %v", v3.GetShortType(w.TypeUrl), resp.RemovedResources)
+		}
+		con.forgetDeltaResources(w.TypeUrl, resp.RemovedResources)
+		if isWildcardTypeURL(w.TypeUrl) {
+			// this is probably a bad idea...
+			con.proxy.Lock()
+			w.ResourceNames = originalNames
+			con.proxy.Unlock()
+		}
 	}
-	if isWildcardTypeURL(w.TypeUrl) {
-		// this is probably a bad idea...
-		con.proxy.Lock()
-		w.ResourceNames = originalNames
-		con.proxy.Unlock()
+	if sentBefore && len(resp.Resources) == 0 && len(resp.RemovedResources) == 0 {
+		log.Debugf("ADS:%v SKIP for node:%s, no resources changed", v3.GetShortType(w.TypeUrl), con.ConID)
+		if s.StatusReporter != nil {
+			s.StatusReporter.RegisterEvent(con.ConID, w.TypeUrl, push.LedgerVersion)
+		}
+		return nil
 	}
 
 	configSize := ResourceSize(res)
@@ -468,8 +521,11 @@ func (s *DiscoveryServer) pushDeltaXds(con *Connection, push *model.PushContext,
 
 	if err := con.sendDelta(resp); err != nil {
 		recordSendError(w.TypeUrl, con.ConID, err)
+		s.recordProxyError(con, w.TypeUrl, err)
 		return err
 	}
+	con.pushed.record(w.TypeUrl, res, false)
+	s.publishPushEvent(con, w.TypeUrl, configSize, t0)
 
 	ptype := "PUSH"
 	info := ""
@@ -510,7 +566,86 @@ func newDeltaConnection(peerAddr string, stream DeltaDiscoveryStream) *Connectio
 		deltaReqChan:  make(chan *discovery.DeltaDiscoveryRequest, 1),
 		errorChan:     make(chan error, 1),
 		blockedPushes: map[string]*model.PushRequest{},
+		deltaVersions: map[string]map[string]string{},
+		pushed:        newPushedResources(),
+		lastGenerated: map[string]generatedResources{},
+		pushedHashes:  map[string]string{},
+	}
+}
+
+// updateDeltaVersions records the resource versions the client claims to have, and drops the
+// versions of resources the client is no longer watching, so they are sent in full if they are
+// subscribed to again.
+func (conn *Connection) updateDeltaVersions(req *discovery.DeltaDiscoveryRequest) {
+	if len(req.InitialResourceVersions) > 0 {
+		versions := conn.deltaVersions[req.TypeUrl]
+		if versions == nil {
+			versions = make(map[string]string, len(req.InitialResourceVersions))
+			conn.deltaVersions[req.TypeUrl] = versions
+		}
+		for name, version := range req.InitialResourceVersions {
+			versions[name] = version
+		}
+	}
+	conn.forgetDeltaResources(req.TypeUrl, req.ResourceNamesUnsubscribe)
+}
+
+// forgetDeltaResources drops the recorded versions for the given resources.
+func (conn *Connection) forgetDeltaResources(typeURL string, names []string) {
+	versions := conn.deltaVersions[typeURL]
+	for _, name := range names {
+		delete(versions, name)
+	}
+	conn.pushed.remove(typeURL, names)
+}
+
+// changedDeltaResources returns the resources that differ from the versions last sent to the client,
+// and records their new versions. Resources explicitly subscribed to are always returned; if subscribe
+// is set, only those resources are returned.
+func (conn *Connection) changedDeltaResources(typeURL string, res model.Resources, subscribe []string) model.Resources {
+	var subres sets.Set
+	if subscribe != nil {
+		subres = sets.NewSet(subscribe...)
+	}
+	versions := conn.deltaVersions[typeURL]
+	if versions == nil {
+		versions = make(map[string]string, len(res))
+		conn.deltaVersions[typeURL] = versions
+	}
+	changed := make(model.Resources, 0, len(res))
+	for _, r := range res {
+		if subres != nil && !subres.Contains(r.Name) {
+			log.Debugf("ADS:%v SKIP %v", v3.GetShortType(typeURL), r.Name)
+			continue
+		}
+		version := r.Version
+		if version == "" {
+			version = resourceVersion(r)
+		}
+		if subres == nil && versions[r.Name] == version {
+			continue
+		}
+		versions[r.Name] = version
+		// Resources may be shared through the cache, so the response gets its own copy.
+		changed = append(changed, &discovery.Resource{
+			Name:         r.Name,
+			Aliases:      r.Aliases,
+			Version:      version,
+			Resource:     r.Resource,
+			Ttl:          r.Ttl,
+			CacheControl: r.CacheControl,
+		})
+	}
+	return changed
+}
+
+// resourceVersion computes a version for a resource based on its content.
+func resourceVersion(r *discovery.Resource) string {
+	if r.Resource == nil {
+		return ""
 	}
+	sum := sha256.Sum256(r.Resource.Value)
+	return hex.EncodeToString(sum[:8])
 }
 
 // To satisfy methods that need DiscoveryRequest. Not suitable for real usage
@@ -15,14 +15,23 @@
 package xds
 
 import (
+	"fmt"
 	"reflect"
+	"strings"
 	"testing"
 
+	cluster "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
 	discovery "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	"go.uber.org/atomic"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
+	"istio.io/istio/pilot/pkg/features"
 	"istio.io/istio/pilot/pkg/model"
 	v3 "istio.io/istio/pilot/pkg/xds/v3"
 	"istio.io/istio/pilot/test/xdstest"
+	"istio.io/istio/pkg/config/host"
+	"istio.io/istio/pkg/test/util/retry"
 	"istio.io/istio/tests/util/leak"
 )
 
@@ -55,6 +64,146 @@ func TestDeltaAdsClusterUpdate(t *testing.T) {
 	sendEDSReqAndVerify([]string{"outbound|80||local.default.svc.cluster.local"}, nil, []string{"outbound|80||local.default.svc.cluster.local"})
 	// Only send the one that is requested
 	sendEDSReqAndVerify([]string{"outbound|81||local.default.svc.cluster.local"}, nil, []string{"outbound|81||local.default.svc.cluster.local"})
-	// TODO: should we just respond with nothing here? Probably...
-	sendEDSReqAndVerify(nil, []string{"outbound|81||local.default.svc.cluster.local"}, []string{"outbound|80||local.default.svc.cluster.local"})
+	// Nothing changed for the remaining cluster, so there is nothing to respond with
+	ads.Request(&discovery.DeltaDiscoveryRequest{
+		ResourceNamesUnsubscribe: []string{"outbound|81||local.default.svc.cluster.local"},
+		ResponseNonce:            nonce,
+	})
+	ads.ExpectNoResponse()
+	// Resubscribing sends the resource again, even though it did not change
+	sendEDSReqAndVerify([]string{"outbound|81||local.default.svc.cluster.local"}, nil, []string{"outbound|81||local.default.svc.cluster.local"})
+}
+
+func TestDeltaAdsEndpointUpdate(t *testing.T) {
+	s := NewFakeDiscoveryServer(t, FakeOptions{})
+	hosts := []string{"delta-a.default.svc.cluster.local", "delta-b.default.svc.cluster.local"}
+	for i, h := range hosts {
+		s.Discovery.MemRegistry.AddHTTPService(h, fmt.Sprintf("10.10.0.%d", i+1), 80)
+		s.Discovery.MemRegistry.SetEndpoints(h, "", []*model.IstioEndpoint{{
+			Address:         fmt.Sprintf("10.0.0.%d", i+1),
+			ServicePortName: "http-main",
+			EndpointPort:    80,
+		}})
+	}
+	retry.UntilOrFail(t, func() bool {
+		for _, h := range hosts {
+			if s.PushContext().ServiceForHostname(nil, host.Name(h)) == nil {
+				return false
+			}
+		}
+		return true
+	})
+	clusterA := "outbound|80||delta-a.default.svc.cluster.local"
+	clusterB := "outbound|80||delta-b.default.svc.cluster.local"
+
+	ads := s.ConnectDeltaADS().WithType(v3.EndpointType)
+	res := ads.RequestResponseAck(&discovery.DeltaDiscoveryRequest{
+		ResourceNamesSubscribe: []string{clusterA, clusterB},
+	})
+	if got := xdstest.MapKeys(xdstest.ExtractLoadAssignments(xdstest.UnmarshalClusterLoadAssignment(t, model.ResourcesToAny(res.Resources)))); !reflect.DeepEqual(got, []string{clusterA, clusterB}) {
+		t.Fatalf("expected clusters %v got %v", []string{clusterA, clusterB}, got)
+	}
+
+	// A full push with no changes should not send anything
+	s.Discovery.ConfigUpdate(&model.PushRequest{Full: true})
+	ads.ExpectNoResponse()
+
+	// Changing the endpoints of a single service should send only that resource
+	s.Discovery.MemRegistry.SetEndpoints(hosts[0], "", []*model.IstioEndpoint{{
+		Address:         "10.0.0.10",
+		ServicePortName: "http-main",
+		EndpointPort:    80,
+	}})
+	res = ads.ExpectResponse()
+	if got := xdstest.MapKeys(xdstest.ExtractLoadAssignments(xdstest.UnmarshalClusterLoadAssignment(t, model.ResourcesToAny(res.Resources)))); !reflect.DeepEqual(got, []string{clusterA}) {
+		t.Fatalf("expected clusters %v got %v", []string{clusterA}, got)
+	}
+	if len(res.RemovedResources) != 0 {
+		t.Fatalf("expected no removed resources, got %v", res.RemovedResources)
+	}
+	for _, r := range res.Resources {
+		if r.Version == "" {
+			t.Fatalf("expected resource %v to have a version", r.Name)
+		}
+	}
+}
+
+func TestDeltaDegradedModeFreezePushes(t *testing.T) {
+	original := features.DegradedModeConfig
+	t.Cleanup(func() {
+		features.DegradedModeConfig = original
+	})
+	features.DegradedModeConfig = features.DegradedModeFreezePushes
+	s := NewFakeDiscoveryServer(t, FakeOptions{})
+	degraded := atomic.NewBool(false)
+	s.Discovery.Degraded = degraded.Load
+	ads := s.ConnectDeltaADS().WithType(v3.ClusterType)
+	ads.RequestResponseAck(nil)
+
+	// Simulate registry loss; config changes are no longer pushed
+	degraded.Store(true)
+	s.Discovery.MemRegistry.AddHTTPService("frozen.default.svc.cluster.local", "10.10.0.1", 80)
+	s.Discovery.ConfigUpdate(&model.PushRequest{Full: true})
+	ads.ExpectNoResponse()
+
+	// Once the registry recovers, pushes resume
+	degraded.Store(false)
+	s.Discovery.ConfigUpdate(&model.PushRequest{Full: true})
+	ads.ExpectResponse()
+}
+
+func TestDeltaV2Compat(t *testing.T) {
+	original := features.EnableV2Compat
+	t.Cleanup(func() {
+		features.EnableV2Compat = original
+	})
+	features.EnableV2Compat = true
+	s := NewFakeDiscoveryServer(t, FakeOptions{})
+
+	ads := s.ConnectDeltaADS().WithType("type.googleapis.com/envoy.api.v2.Cluster")
+	res := ads.RequestResponseAck(nil)
+	if res.TypeUrl != v3.ClusterType {
+		t.Fatalf("expected type %s, got %s", v3.ClusterType, res.TypeUrl)
+	}
+	if len(res.Resources) == 0 {
+		t.Fatalf("expected clusters")
+	}
+	for _, r := range res.Resources {
+		c := &cluster.Cluster{}
+		if err := r.Resource.UnmarshalTo(c); err != nil {
+			t.Fatalf("expected a v3 cluster: %v", err)
+		}
+	}
+	// The ACK, sent with the legacy type URL, is not answered again
+	ads.ExpectNoResponse()
+}
+
+func TestDeltaStrictNonceValidation(t *testing.T) {
+	for _, strict := range []bool{false, true} {
+		t.Run(fmt.Sprint(strict), func(t *testing.T) {
+			original := features.StrictNonceValidation
+			t.Cleanup(func() {
+				features.StrictNonceValidation = original
+			})
+			features.StrictNonceValidation = strict
+			s := NewFakeDiscoveryServer(t, FakeOptions{})
+
+			ads := s.ConnectDeltaADS().WithType(v3.ClusterType)
+			first := ads.RequestResponseAck(nil)
+			s.Discovery.MemRegistry.AddHTTPService("nonce.default.svc.cluster.local", "10.10.0.1", 80)
+			s.Discovery.ConfigUpdate(&model.PushRequest{Full: true})
+			second := ads.ExpectResponse()
+			ads.Request(&discovery.DeltaDiscoveryRequest{ResponseNonce: second.Nonce})
+
+			// Replay the ACK of the first response, after the second one was ACKed
+			ads.Request(&discovery.DeltaDiscoveryRequest{ResponseNonce: first.Nonce})
+			if !strict {
+				ads.ExpectNoResponse()
+				return
+			}
+			if err := ads.ExpectError(); status.Code(err) != codes.InvalidArgument || !strings.Contains(err.Error(), "stale nonce") {
+				t.Fatalf("expected the replayed nonce to be rejected, got %v", err)
+			}
+		})
+	}
 }
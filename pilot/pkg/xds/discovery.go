@@ -16,6 +16,7 @@ package xds
 
 import (
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -35,6 +36,8 @@ import (
 	"istio.io/istio/pilot/pkg/serviceregistry/memory"
 	"istio.io/istio/pilot/pkg/util/sets"
 	v3 "istio.io/istio/pilot/pkg/xds/v3"
+	"istio.io/istio/pkg/config/host"
+	"istio.io/istio/pkg/config/schema/gvk"
 	"istio.io/istio/pkg/security"
 )
 
@@ -66,6 +69,23 @@ type debounceOptions struct {
 	enableEDSDebounce bool
 }
 
+// GeneratorSelector selects the generator set used for matching proxies.
+type GeneratorSelector struct {
+	// Match returns true if the proxy should be served by Generator.
+	Match func(proxy *model.Proxy) bool
+	// Generator is the name of the generator set, as would be set in the Generator node metadata. Generators
+	// registered as "<Generator>/<TypeUrl>" are used for each type, falling back to the default generators.
+	Generator string
+}
+
+// ProxyIDPrefix returns a GeneratorSelector match function selecting proxies whose ID, the <pod>.<namespace>
+// part of the node ID, starts with prefix.
+func ProxyIDPrefix(prefix string) func(proxy *model.Proxy) bool {
+	return func(proxy *model.Proxy) bool {
+		return strings.HasPrefix(proxy.ID, prefix)
+	}
+}
+
 // DiscoveryServer is Pilot's gRPC implementation for Envoy's xds APIs
 type DiscoveryServer struct {
 	// Env is the model environment.
@@ -85,15 +105,73 @@ type DiscoveryServer struct {
 	// Normal istio clients use the default generator - will not be impacted by this.
 	Generators map[string]model.XdsResourceGenerator
 
+	// GeneratorSelectors select a generator set for proxies that do not request one in their Generator metadata,
+	// allowing a subset of proxies to be served by alternate generators. The first matching selector is used.
+	GeneratorSelectors []GeneratorSelector
+
+	// ExperimentGenerator is the name of the generator set serving connections in the experiment bucket, see
+	// ExperimentBucketPercent. If empty, connections in both buckets are served alike.
+	ExperimentGenerator string
+
 	// ProxyNeedsPush is a function that determines whether a push can be completely skipped. Individual generators
 	// may also choose to not send any updates.
 	ProxyNeedsPush func(proxy *model.Proxy, req *model.PushRequest) bool
 
 	concurrentPushLimit chan struct{}
+
+	// requestLimit bounds the number of discovery requests processed concurrently across all connections.
+	// It is nil if ADSRequestWorkers is unset.
+	requestLimit chan struct{}
+
+	// strictNonceValidation is the value of StrictNonceValidation when the server was created.
+	strictNonceValidation bool
+
+	// computeLimit bounds the number of full config generations run concurrently across all connections.
+	// It is nil if MaxConcurrentComputations is unset.
+	computeLimit chan struct{}
+
+	// nodeGenerations bounds the number of generations run concurrently for the same node ID.
+	// It is nil if MaxConcurrentPushesPerNode is unset.
+	nodeGenerations *nodeGenerationLimit
+
+	// proxyErrors records the recent push errors of each node ID. It is nil if ProxyErrorHistory is unset.
+	proxyErrors *proxyErrorHistory
+
+	// admission bounds the number of accepted XDS connections, globally and per region.
+	admission *connectionAdmission
+
+	// nodes tracks the distinct node IDs recently connected, bounding them by MaxDistinctNodes.
+	nodes *nodeTracker
+
+	// connectionGoroutines is the number of goroutines serving XDS connections.
+	connectionGoroutines atomic.Int64
+
+	// plugins are the networking plugins the config generator is built with.
+	plugins []string
+
+	// pushEvents publishes push events to a sink, if set with SetPushEventSink.
+	pushEvents *pushEventPublisher
+
+	// meshOverrides are the mesh config overrides for the proxies matching their selectors, from
+	// MeshConfigOverridesFile.
+	meshOverrides []meshConfigOverride
+
+	// Degraded returns true if istiod is degraded by registry loss. While degraded, pushes are suppressed if
+	// DegradedModeConfig is freeze-pushes. It may be nil.
+	Degraded func() bool
+
+	// MemoryPressure returns the memory usage of istiod as a fraction of its limit. New connections are rejected
+	// while it is above MemoryPressureRejectThreshold. It defaults to reading the cgroup memory usage.
+	MemoryPressure func() (float64, error)
+
 	// mutex protecting global structs updated or read by ADS service, including ConfigsUpdated and
 	// shards.
 	mutex sync.RWMutex
 
+	// stagedEDS holds the endpoint updates not yet applied to the shards, if AtomicEDSSwap is set.
+	stagedEDS      map[endpointShardKey][]*model.IstioEndpoint
+	stagedEDSMutex sync.Mutex
+
 	// InboundUpdates describes the number of configuration updates the discovery server has received
 	InboundUpdates *atomic.Int64
 	// CommittedUpdates describes the number of configuration updates the discovery server has
@@ -134,6 +212,12 @@ type DiscoveryServer struct {
 	// serverReady indicates caches have been synced up and server is ready to process requests.
 	serverReady atomic.Bool
 
+	// standby is set while the server is a warm standby, see StandbyMode.
+	standby atomic.Bool
+
+	// lastConfigChange is the time, in unix nanoseconds, of the last config change requiring a full push.
+	lastConfigChange atomic.Int64
+
 	debounceOptions debounceOptions
 
 	instanceID string
@@ -143,6 +227,13 @@ type DiscoveryServer struct {
 
 	// JwtKeyResolver holds a reference to the JWT key resolver instance.
 	JwtKeyResolver *model.JwksResolver
+
+	// drain is closed by CloseConnections to end all XDS streams.
+	drain     chan struct{}
+	drainOnce sync.Once
+
+	// v2CompatTypes maps the legacy type URLs served as their v3 equivalents, see features.EnableV2Compat.
+	v2CompatTypes map[string]string
 }
 
 // EndpointShards holds the set of endpoint shards of a service. Registries update
@@ -173,20 +264,46 @@ func NewDiscoveryServer(env *model.Environment, plugins []string, instanceID str
 		ProxyNeedsPush:          DefaultProxyNeedsPush,
 		EndpointShardsByService: map[string]map[string]*EndpointShards{},
 		concurrentPushLimit:     make(chan struct{}, features.PushThrottle),
+		admission:               newConnectionAdmissionFromFeatures(),
+		plugins:                 plugins,
+		nodes:                   newNodeTrackerFromFeatures(),
+		MemoryPressure:          newCgroupMemoryPressure(time.Second),
 		InboundUpdates:          atomic.NewInt64(0),
 		CommittedUpdates:        atomic.NewInt64(0),
 		pushChannel:             make(chan *model.PushRequest, 10),
 		pushQueue:               NewPushQueue(),
 		debugHandlers:           map[string]string{},
 		adsClients:              map[string]*Connection{},
+		drain:                   make(chan struct{}),
+		v2CompatTypes:           v2CompatTypeURLs(),
 		debounceOptions: debounceOptions{
 			debounceAfter:     features.DebounceAfter,
 			debounceMax:       features.DebounceMax,
 			enableEDSDebounce: features.EnableEDSDebounce.Get(),
 		},
-		Cache:      model.DisabledCache{},
-		instanceID: instanceID,
+		Cache:                 model.DisabledCache{},
+		instanceID:            instanceID,
+		strictNonceValidation: features.StrictNonceValidation,
+	}
+
+	if features.ADSRequestWorkers > 0 {
+		out.requestLimit = make(chan struct{}, features.ADSRequestWorkers)
+	}
+	if features.MaxConcurrentComputations > 0 {
+		out.computeLimit = make(chan struct{}, features.MaxConcurrentComputations)
 	}
+	if features.MaxConcurrentPushesPerNode > 0 {
+		out.nodeGenerations = newNodeGenerationLimit(features.MaxConcurrentPushesPerNode)
+	}
+	out.standby.Store(features.StandbyMode)
+	if features.ProxyErrorHistory > 0 {
+		out.proxyErrors = newProxyErrorHistory(features.ProxyErrorHistory)
+	}
+	meshOverrides, err := loadMeshConfigOverrides(features.MeshConfigOverridesFile)
+	if err != nil {
+		log.Errorf("ignoring invalid mesh config overrides in %v: %v", features.MeshConfigOverridesFile, err)
+	}
+	out.meshOverrides = meshOverrides
 
 	out.initJwksResolver()
 
@@ -201,6 +318,13 @@ func NewDiscoveryServer(env *model.Environment, plugins []string, instanceID str
 	return out
 }
 
+// SetCacheRevision isolates the XDS cache entries generated by this server within revision, for
+// features.PerRevisionCache. It must be called before Start.
+func (s *DiscoveryServer) SetCacheRevision(revision string) {
+	s.Cache = model.NewRevisionXdsCache(s.Cache, revision)
+	s.ConfigGenerator = core.NewConfigGenerator(s.plugins, s.Cache)
+}
+
 // initJwkResolver initializes the JWT key resolver to be used.
 func (s *DiscoveryServer) initJwksResolver() {
 	if s.JwtKeyResolver != nil {
@@ -230,6 +354,69 @@ func (s *DiscoveryServer) Register(rpcs *grpc.Server) {
 	discovery.RegisterAggregatedDiscoveryServiceServer(rpcs, s)
 }
 
+// RegisterServiceName adds the ADS handler to the grpc server under an additional gRPC service name, for clients
+// that do not use the standard envoy.service.discovery.v3.AggregatedDiscoveryService name.
+func (s *DiscoveryServer) RegisterServiceName(rpcs *grpc.Server, name string) {
+	rpcs.RegisterService(&grpc.ServiceDesc{
+		ServiceName: name,
+		HandlerType: (*discovery.AggregatedDiscoveryServiceServer)(nil),
+		Methods:     []grpc.MethodDesc{},
+		Streams: []grpc.StreamDesc{
+			{
+				StreamName: "StreamAggregatedResources",
+				Handler: func(srv interface{}, stream grpc.ServerStream) error {
+					return srv.(discovery.AggregatedDiscoveryServiceServer).StreamAggregatedResources(&adsServerStream{stream})
+				},
+				ServerStreams: true,
+				ClientStreams: true,
+			},
+			{
+				StreamName: "DeltaAggregatedResources",
+				Handler: func(srv interface{}, stream grpc.ServerStream) error {
+					return srv.(discovery.AggregatedDiscoveryServiceServer).DeltaAggregatedResources(&deltaADSServerStream{stream})
+				},
+				ServerStreams: true,
+				ClientStreams: true,
+			},
+		},
+		Metadata: "envoy/service/discovery/v3/ads.proto",
+	}, s)
+}
+
+// adsServerStream is a StreamAggregatedResources stream registered under an additional service name.
+type adsServerStream struct {
+	grpc.ServerStream
+}
+
+func (x *adsServerStream) Send(m *discovery.DiscoveryResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *adsServerStream) Recv() (*discovery.DiscoveryRequest, error) {
+	m := new(discovery.DiscoveryRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// deltaADSServerStream is a DeltaAggregatedResources stream registered under an additional service name.
+type deltaADSServerStream struct {
+	grpc.ServerStream
+}
+
+func (x *deltaADSServerStream) Send(m *discovery.DeltaDiscoveryResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *deltaADSServerStream) Recv() (*discovery.DeltaDiscoveryRequest, error) {
+	m := new(discovery.DeltaDiscoveryRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 var processStartTime = time.Now()
 
 // CachesSynced is called when caches have been synced so that server can accept connections.
@@ -242,11 +429,35 @@ func (s *DiscoveryServer) IsServerReady() bool {
 	return s.serverReady.Load()
 }
 
+// IsSettling returns true if a config change requiring a full push happened within the window, and it has
+// not yet been pushed to all proxies. Once the window has passed, the server is considered settled regardless,
+// so a single slow proxy cannot hold it back.
+func (s *DiscoveryServer) IsSettling(window time.Duration) bool {
+	last := s.lastConfigChange.Load()
+	if last == 0 || time.Since(time.Unix(0, last)) > window {
+		return false
+	}
+	return s.InboundUpdates.Load() != s.CommittedUpdates.Load() || !s.pushQueue.Drained()
+}
+
 func (s *DiscoveryServer) Start(stopCh <-chan struct{}) {
 	go s.WorkloadEntryController.Run(stopCh)
+	s.admission.watchFeatures(stopCh)
 	go s.handleUpdates(stopCh)
 	go s.periodicRefreshMetrics(stopCh)
 	go s.sendPushes(stopCh)
+	if features.XDSCacheCompactionInterval > 0 {
+		go s.periodicCompactCache(stopCh)
+	}
+	if features.PushStalenessInterval > 0 {
+		go s.periodicRecordPushStaleness(stopCh)
+	}
+	if features.XDSRuntimeStatsInterval > 0 {
+		go s.periodicRecordRuntimeStats(stopCh)
+	}
+	if s.pushEvents != nil {
+		go s.pushEvents.run(stopCh)
+	}
 }
 
 func (s *DiscoveryServer) getNonK8sRegistries() []serviceregistry.Instance {
@@ -271,6 +482,99 @@ func (s *DiscoveryServer) getNonK8sRegistries() []serviceregistry.Instance {
 	return nonK8sRegistries
 }
 
+// periodicCompactCache compacts the XDS cache every XDSCacheCompactionInterval.
+func (s *DiscoveryServer) periodicCompactCache(stopCh <-chan struct{}) {
+	ticker := time.NewTicker(features.XDSCacheCompactionInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if removed := s.compactCache(s.globalPushContext()); removed > 0 {
+				log.Debugf("compacted XDS cache, removed %d entries", removed)
+			}
+		case <-stopCh:
+			return
+		}
+	}
+}
+
+func (s *DiscoveryServer) periodicRecordPushStaleness(stopCh <-chan struct{}) {
+	ticker := time.NewTicker(features.PushStalenessInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.recordPushStaleness(time.Now())
+		case <-stopCh:
+			return
+		}
+	}
+}
+
+// recordPushStaleness records the longest time any connected proxy has gone without a successful push at now,
+// and returns it.
+func (s *DiscoveryServer) recordPushStaleness(now time.Time) time.Duration {
+	var max time.Duration
+	for _, con := range s.Clients() {
+		if staleness := con.pushStaleness(now); staleness > max {
+			max = staleness
+		}
+	}
+	maxPushStaleness.Record(max.Seconds())
+	return max
+}
+
+// trackGoroutine records a goroutine serving con, until the returned function is called.
+func (s *DiscoveryServer) trackGoroutine(con *Connection) func() {
+	con.goroutines.Inc()
+	s.connectionGoroutines.Inc()
+	return func() {
+		con.goroutines.Dec()
+		s.connectionGoroutines.Dec()
+	}
+}
+
+// periodicRecordRuntimeStats records the XDS runtime stats every XDSRuntimeStatsInterval.
+func (s *DiscoveryServer) periodicRecordRuntimeStats(stopCh <-chan struct{}) {
+	ticker := time.NewTicker(features.XDSRuntimeStatsInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.recordRuntimeStats()
+		case <-stopCh:
+			return
+		}
+	}
+}
+
+// recordRuntimeStats records the goroutines serving XDS connections, and the bytes held by the XDS cache.
+func (s *DiscoveryServer) recordRuntimeStats() {
+	goroutines := s.connectionGoroutines.Load()
+	connectionGoroutines.Record(float64(goroutines))
+	if n := s.adsClientCount(); n > 0 {
+		goroutinesPerConnection.Record(float64(goroutines) / float64(n))
+	} else {
+		goroutinesPerConnection.Record(0)
+	}
+	xdsCacheBytes.Record(float64(s.Cache.SizeBytes()))
+}
+
+// compactCache removes cache entries for services that are not in the push context. Entries for other
+// kinds of config are kept, as those are not indexed by name in the push context; they are cleared
+// when the config changes.
+func (s *DiscoveryServer) compactCache(push *model.PushContext) int {
+	removed := s.Cache.Compact(func(key model.ConfigKey) bool {
+		if key.Kind != gvk.ServiceEntry {
+			return true
+		}
+		_, f := push.ServiceIndex.HostnameAndNamespace[host.Name(key.Name)][key.Namespace]
+		return f
+	})
+	xdsCacheCompactedEntries.RecordInt(int64(removed))
+	return removed
+}
+
 // Push metrics are updated periodically (10s default)
 func (s *DiscoveryServer) periodicRefreshMetrics(stopCh <-chan struct{}) {
 	ticker := time.NewTicker(periodicRefreshMetrics)
@@ -298,6 +602,13 @@ func (s *DiscoveryServer) periodicRefreshMetrics(stopCh <-chan struct{}) {
 // Push is called to push changes on config updates using ADS. This is set in DiscoveryService.Push,
 // to avoid direct dependencies.
 func (s *DiscoveryServer) Push(req *model.PushRequest) {
+	if s.inStandby() {
+		log.Debugf("Skipping push in standby mode: %v", req.PushReason())
+		return
+	}
+	if s.applyStagedEDSUpdates() {
+		req.Full = true
+	}
 	if !req.Full {
 		req.Push = s.globalPushContext()
 		s.AdsPushAll(versionInfo(), req)
@@ -350,6 +661,12 @@ func (s *DiscoveryServer) globalPushContext() *model.PushContext {
 // It replaces the 'clear cache' from v1.
 func (s *DiscoveryServer) ConfigUpdate(req *model.PushRequest) {
 	inboundConfigUpdates.Increment()
+	if req.ChangeTime.IsZero() {
+		req.ChangeTime = time.Now()
+	}
+	if req.Full {
+		s.lastConfigChange.Store(time.Now().UnixNano())
+	}
 	s.InboundUpdates.Inc()
 	s.pushChannel <- req
 }
@@ -500,6 +817,7 @@ func (s *DiscoveryServer) initPushContext(req *model.PushRequest, oldPushContext
 		pushContextErrors.Increment()
 		return nil, err
 	}
+	s.initMeshOverridePushes(push, oldPushContext, req)
 
 	if err := s.UpdateServiceShards(push); err != nil {
 		return nil, err
@@ -544,6 +862,14 @@ func (s *DiscoveryServer) initGenerators(env *model.Environment, systemNameSpace
 	s.Generators[v3.BootstrapType] = &BootstrapGenerator{Server: s}
 }
 
+// CloseConnections ends all XDS streams, once any in progress push completes, so proxies reconnect to another
+// instance. Streams opened afterwards are closed as soon as they are initialized.
+func (s *DiscoveryServer) CloseConnections() {
+	s.drainOnce.Do(func() {
+		close(s.drain)
+	})
+}
+
 // shutdown shuts down DiscoveryServer components.
 func (s *DiscoveryServer) Shutdown() {
 	s.closeJwksResolver()
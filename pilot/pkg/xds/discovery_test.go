@@ -16,18 +16,30 @@ package xds
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
 	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
 
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
 	discovery "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	structpb "github.com/golang/protobuf/ptypes/struct"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/trace"
 	uatomic "go.uber.org/atomic"
 	"google.golang.org/grpc"
 
+	"istio.io/istio/pilot/pkg/features"
 	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/networking/util"
 	v3 "istio.io/istio/pilot/pkg/xds/v3"
 	"istio.io/istio/pkg/test/util/retry"
 	"istio.io/istio/tests/util/leak"
@@ -482,3 +494,336 @@ func TestShouldRespond(t *testing.T) {
 		})
 	}
 }
+
+func TestNodeTrackerWindow(t *testing.T) {
+	tracker := newNodeTracker(2, time.Minute)
+	now := time.Now()
+	observe := func(id string, at time.Time) bool {
+		_, ok := tracker.observe(id, at)
+		return ok
+	}
+	if !observe("a", now) || !observe("b", now.Add(30*time.Second)) {
+		t.Fatalf("expected nodes within the cap to be accepted")
+	}
+	if observe("c", now.Add(45*time.Second)) {
+		t.Fatalf("expected a new node beyond the cap to be rejected")
+	}
+	if !observe("a", now.Add(50*time.Second)) {
+		t.Fatalf("expected a known node to be accepted")
+	}
+	// b has left the window, making room for c
+	if !observe("c", now.Add(2*time.Minute)) {
+		t.Fatalf("expected a new node to be accepted once others left the window")
+	}
+}
+
+func TestNodeTrackerUndo(t *testing.T) {
+	tracker := newNodeTracker(1, time.Minute)
+	now := time.Now()
+	undo, ok := tracker.observe("a", now)
+	if !ok {
+		t.Fatalf("expected a node within the cap to be accepted")
+	}
+	// Once undone, the rejected connection does not hold the only slot
+	undo()
+	if _, ok := tracker.observe("b", now.Add(time.Second)); !ok {
+		t.Fatalf("expected the slot of the undone node to be free")
+	}
+	// Undoing a known node restores its last connection time, so it leaves the window as before
+	undo, _ = tracker.observe("b", now.Add(50*time.Second))
+	undo()
+	if got := tracker.lastSeen["b"]; !got.Equal(now.Add(time.Second)) {
+		t.Fatalf("expected the previous connection time to be restored, got %v", got)
+	}
+}
+
+func TestConnectionAdmissionReconnectWindow(t *testing.T) {
+	a := newConnectionAdmission(2, nil)
+	a.reserved = 1
+	a.reconnectWindow = time.Minute
+	now := time.Now()
+	if !a.admit("", "", "a", now) {
+		t.Fatalf("expected a new node to be admitted to an unreserved slot")
+	}
+	if a.admit("", "", "b", now) {
+		t.Fatalf("expected a new node to be rejected from a reserved slot")
+	}
+	a.release("", "", "a", now)
+	if !a.admit("", "", "b", now) {
+		t.Fatalf("expected a new node to be admitted to a freed unreserved slot")
+	}
+	if !a.admit("", "", "a", now.Add(30*time.Second)) {
+		t.Fatalf("expected a reconnecting node to be admitted to a reserved slot")
+	}
+	a.release("", "", "a", now.Add(30*time.Second))
+	// a has left the reconnect window, so is treated as a new node
+	if a.admit("", "", "a", now.Add(2*time.Minute)) {
+		t.Fatalf("expected a node outside the reconnect window to be rejected from a reserved slot")
+	}
+}
+
+func TestConnectionAdmissionPriority(t *testing.T) {
+	a := newConnectionAdmission(1, nil)
+	a.reserved = 1
+	a.reconnectWindow = time.Minute
+	a.priorityNodes = []string{"router~*"}
+	a.priorityReserved = 1
+	now := time.Now()
+	if a.admit("", "", "sidecar~a", now) {
+		t.Fatalf("expected a new node to be rejected from a reserved slot")
+	}
+	if !a.admit("", "", "router~a", now) {
+		t.Fatalf("expected a priority node to be admitted regardless of the reconnect reservation")
+	}
+	if !a.admit("", "", "router~b", now) {
+		t.Fatalf("expected a priority node to be admitted beyond the limit")
+	}
+	if a.admit("", "", "router~c", now) {
+		t.Fatalf("expected a priority node to be rejected beyond the priority reservation")
+	}
+}
+
+func TestPushQueueDepthMetric(t *testing.T) {
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+
+	semaphore := make(chan struct{}, 1)
+	queue := NewPushQueue()
+	defer queue.ShutDown()
+
+	proxies := createProxies(10)
+	for _, proxy := range proxies {
+		proxy := proxy
+		// Slow consumer, so pushes are enqueued faster than they drain
+		go func() {
+			for {
+				select {
+				case p := <-proxy.pushChannel:
+					time.Sleep(20 * time.Millisecond)
+					p.done()
+				case <-stopCh:
+					return
+				}
+			}
+		}()
+	}
+	go doSendPushes(stopCh, semaphore, queue)
+
+	depth := func() float64 {
+		data, err := view.RetrieveData("pilot_xds_push_queue_depth")
+		if err != nil || len(data) == 0 {
+			t.Fatalf("failed to get pilot_xds_push_queue_depth: %v", err)
+		}
+		return data[0].Data.(*view.LastValueData).Value
+	}
+	for _, proxy := range proxies {
+		queue.Enqueue(proxy, &model.PushRequest{Push: &model.PushContext{}})
+	}
+	if d := depth(); d < 5 {
+		t.Fatalf("expected the push queue depth to rise, got %v", d)
+	}
+	retry.UntilSuccessOrFail(t, func() error {
+		if d := depth(); d != 0 {
+			return fmt.Errorf("expected the push queue to drain, got depth %v", d)
+		}
+		return nil
+	}, retry.Timeout(5*time.Second))
+}
+
+func TestNodeMetadataAllowlist(t *testing.T) {
+	original := features.AllowedNodeMetadataKeys
+	t.Cleanup(func() {
+		features.AllowedNodeMetadataKeys = original
+	})
+	features.AllowedNodeMetadataKeys = []string{"ALLOWED"}
+	s := NewFakeDiscoveryServer(t, FakeOptions{})
+	metadata := &structpb.Struct{Fields: map[string]*structpb.Value{
+		"ISTIO_VERSION": {Kind: &structpb.Value_StringValue{StringValue: "1.10.0"}},
+		"NAMESPACE":     {Kind: &structpb.Value_StringValue{StringValue: "default"}},
+		"ALLOWED":       {Kind: &structpb.Value_StringValue{StringValue: "kept"}},
+		"EXTRA":         {Kind: &structpb.Value_StringValue{StringValue: "dropped"}},
+	}}
+	s.ConnectADS().WithType(v3.ClusterType).RequestResponseAck(&discovery.DiscoveryRequest{
+		Node: &core.Node{Id: "sidecar~1.1.1.1~test.default~default.svc.cluster.local", Metadata: metadata},
+	})
+
+	clients := s.Discovery.AllClients()
+	if len(clients) != 1 {
+		t.Fatalf("expected 1 client, got %v", len(clients))
+	}
+	proxy := clients[0].proxy
+	proxy.RLock()
+	defer proxy.RUnlock()
+	// Known keys are always retained
+	if proxy.Metadata.IstioVersion != "1.10.0" || proxy.Metadata.Namespace != "default" {
+		t.Fatalf("expected known metadata to be retained, got %+v", proxy.Metadata)
+	}
+	if proxy.Metadata.Raw["ALLOWED"] != "kept" {
+		t.Fatalf("expected allowed key to be retained, got %v", proxy.Metadata.Raw)
+	}
+	if _, f := proxy.Metadata.Raw["EXTRA"]; f {
+		t.Fatalf("expected extra key to be dropped, got %v", proxy.Metadata.Raw)
+	}
+	if _, f := proxy.XdsNode.Metadata.Fields["EXTRA"]; f {
+		t.Fatalf("expected extra key to be dropped from the node, got %v", proxy.XdsNode.Metadata)
+	}
+	// The request sent by the proxy is not modified
+	if _, f := metadata.Fields["EXTRA"]; !f {
+		t.Fatalf("expected the request metadata to be unchanged")
+	}
+}
+
+func TestParsePushOrder(t *testing.T) {
+	got := parsePushOrder([]string{"LDS", " cds", "", "unknown", v3.NameTableType})
+	want := []string{v3.ListenerType, v3.ClusterType, v3.NameTableType}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+}
+
+func TestResourcesHash(t *testing.T) {
+	resources := func(values ...string) model.Resources {
+		res := model.Resources{}
+		for i, v := range values {
+			res = append(res, &discovery.Resource{
+				Name:     fmt.Sprintf("resource-%d", i),
+				Resource: util.MessageToAny(&structpb.Value{Kind: &structpb.Value_StringValue{StringValue: v}}),
+			})
+		}
+		return res
+	}
+	for _, algorithm := range []features.PushHashAlgorithmType{features.PushHashXXHash, features.PushHashSHA256} {
+		t.Run(string(algorithm), func(t *testing.T) {
+			base := resourcesHash(algorithm, resources("a", "b"))
+			if got := resourcesHash(algorithm, resources("a", "b")); got != base {
+				t.Fatalf("expected identical resources to have the same hash, got %v and %v", base, got)
+			}
+			for _, other := range []model.Resources{resources("a", "c"), resources("a"), resources("a", "b", "c"), resources("ab")} {
+				if got := resourcesHash(algorithm, other); got == base {
+					t.Fatalf("expected differing resources %v to have a different hash", other)
+				}
+			}
+		})
+	}
+	if resourcesHash(features.PushHashXXHash, resources("a")) == resourcesHash(features.PushHashSHA256, resources("a")) {
+		t.Fatalf("expected the algorithms to differ")
+	}
+}
+
+func TestConnectionBucket(t *testing.T) {
+	for _, percent := range []int{0, 10, 50, 100} {
+		t.Run(fmt.Sprint(percent), func(t *testing.T) {
+			experiment := 0
+			for i := 0; i < 10000; i++ {
+				id := fmt.Sprintf("sidecar~10.0.%d.%d~app-%d.default~default.svc.cluster.local", i/256, i%256, i)
+				bucket := connectionBucket(id, percent)
+				if again := connectionBucket(id, percent); again != bucket {
+					t.Fatalf("expected %v to always be in bucket %v, got %v", id, bucket, again)
+				}
+				if bucket == experimentBucket {
+					experiment++
+				}
+			}
+			if got := float64(experiment) / 100; math.Abs(got-float64(percent)) > 2 {
+				t.Fatalf("expected %v%% of connections in the experiment bucket, got %v%%", percent, got)
+			}
+		})
+	}
+}
+
+type tracedStream struct {
+	fakeStream
+	ctx context.Context
+}
+
+func (h *tracedStream) Context() context.Context {
+	return h.ctx
+}
+
+func TestPushTimeExemplars(t *testing.T) {
+	old := features.PushLatencyExemplars
+	features.PushLatencyExemplars = true
+	t.Cleanup(func() {
+		features.PushLatencyExemplars = old
+	})
+
+	ctx, span := trace.StartSpan(context.Background(), "push", trace.WithSampler(trace.AlwaysSample()))
+	defer span.End()
+	con := newConnection("", &tracedStream{ctx: ctx})
+	con.proxy = &model.Proxy{ID: "app.default"}
+
+	recordPushTime(v3.ListenerType, 2*time.Second, con)
+
+	m := &dto.Metric{}
+	if err := pushTimeExemplars.WithLabelValues(v3.GetMetricType(v3.ListenerType)).(prometheus.Metric).Write(m); err != nil {
+		t.Fatal(err)
+	}
+	var exemplar *dto.Exemplar
+	for _, b := range m.GetHistogram().GetBucket() {
+		if b.GetExemplar() != nil {
+			exemplar = b.GetExemplar()
+		}
+	}
+	if exemplar == nil {
+		t.Fatalf("expected an exemplar to be recorded, got %v", m)
+	}
+	if exemplar.GetValue() != 2 {
+		t.Fatalf("expected exemplar of the recorded sample, got %v", exemplar.GetValue())
+	}
+	labels := map[string]string{}
+	for _, l := range exemplar.GetLabel() {
+		labels[l.GetName()] = l.GetValue()
+	}
+	expected := map[string]string{
+		exemplarTraceID: span.SpanContext().TraceID.String(),
+		exemplarProxyID: "app.default",
+	}
+	if !reflect.DeepEqual(labels, expected) {
+		t.Fatalf("expected exemplar labels %v, got %v", expected, labels)
+	}
+}
+
+func TestPushEventsDropped(t *testing.T) {
+	p := newPushEventPublisher(nil, 1)
+	p.publish(PushEvent{Node: "a"})
+	p.publish(PushEvent{Node: "b"})
+	if len(p.events) != 1 {
+		t.Fatalf("expected a single buffered event, got %d", len(p.events))
+	}
+	data, err := view.RetrieveData("pilot_xds_push_events_dropped")
+	if err != nil || len(data) == 0 {
+		t.Fatalf("failed to get pilot_xds_push_events_dropped: %v", err)
+	}
+	if v := data[0].Data.(*view.SumData).Value; v < 1 {
+		t.Fatalf("expected the dropped event to be recorded, got %v", v)
+	}
+}
+
+func TestKafkaRESTSink(t *testing.T) {
+	var got kafkaRecords
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ct := r.Header.Get("Content-Type"); ct != kafkaJSONContentType {
+			t.Errorf("unexpected content type %q", ct)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("failed to decode records: %v", err)
+		}
+	}))
+	defer srv.Close()
+
+	sink := NewKafkaRESTSink(srv.URL + "/topics/pushes")
+	if err := sink.Publish([]PushEvent{{Node: "a", Type: v3.ClusterType, Size: 10}}); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Records) != 1 || got.Records[0].Key != "a" || got.Records[0].Value.Size != 10 {
+		t.Fatalf("unexpected records: %+v", got)
+	}
+
+	failing := NewKafkaRESTSink(srv.URL)
+	srv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	if err := failing.Publish([]PushEvent{{Node: "a"}}); err == nil {
+		t.Fatal("expected an error for a failed publish")
+	}
+}
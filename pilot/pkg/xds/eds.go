@@ -66,7 +66,8 @@ func (s *DiscoveryServer) UpdateServiceShards(push *model.PushContext) error {
 				}
 			}
 
-			s.edsCacheUpdate(registry.Cluster(), string(svc.Hostname), svc.Attributes.Namespace, endpoints)
+			// Applied directly, as the push context is already being computed.
+			s.applyEDSUpdate(registry.Cluster(), string(svc.Hostname), svc.Attributes.Namespace, endpoints)
 		}
 	}
 
@@ -79,6 +80,9 @@ func (s *DiscoveryServer) SvcUpdate(cluster, hostname string, namespace string,
 	// prevent memory leaks.
 	if event == model.EventDelete {
 		inboundServiceDeletes.Increment()
+		s.stagedEDSMutex.Lock()
+		delete(s.stagedEDS, endpointShardKey{cluster: cluster, hostname: hostname, namespace: namespace})
+		s.stagedEDSMutex.Unlock()
 		s.deleteService(cluster, hostname, namespace)
 	} else {
 		inboundServiceUpdates.Increment()
@@ -123,8 +127,62 @@ func (s *DiscoveryServer) EDSCacheUpdate(clusterID, serviceName string, namespac
 
 // edsCacheUpdate updates EndpointShards data by clusterID, hostname, IstioEndpoints.
 // It also tracks the changes to ServiceAccounts. It returns whether a full push
-// is needed or incremental push is sufficient.
+// is needed or incremental push is sufficient. If AtomicEDSSwap is set, updates of
+// known services are staged until the next push.
 func (s *DiscoveryServer) edsCacheUpdate(clusterID, hostname string, namespace string,
+	istioEndpoints []*model.IstioEndpoint) bool {
+	if features.AtomicEDSSwap && s.stageEDSUpdate(clusterID, hostname, namespace, istioEndpoints) {
+		return false
+	}
+	return s.applyEDSUpdate(clusterID, hostname, namespace, istioEndpoints)
+}
+
+// endpointShardKey identifies the endpoints of a service in a shard.
+type endpointShardKey struct {
+	cluster   string
+	hostname  string
+	namespace string
+}
+
+// stageEDSUpdate stages an endpoint update of a known service, so its previous endpoints are served until the
+// update is applied by applyStagedEDSUpdates. It returns false if the service is not known yet, as there are no
+// previous endpoints to serve.
+func (s *DiscoveryServer) stageEDSUpdate(clusterID, hostname string, namespace string,
+	istioEndpoints []*model.IstioEndpoint) bool {
+	s.mutex.RLock()
+	_, known := s.EndpointShardsByService[hostname][namespace]
+	s.mutex.RUnlock()
+	if !known {
+		return false
+	}
+	s.stagedEDSMutex.Lock()
+	defer s.stagedEDSMutex.Unlock()
+	if s.stagedEDS == nil {
+		s.stagedEDS = map[endpointShardKey][]*model.IstioEndpoint{}
+	}
+	s.stagedEDS[endpointShardKey{cluster: clusterID, hostname: hostname, namespace: namespace}] = istioEndpoints
+	return true
+}
+
+// applyStagedEDSUpdates applies all staged endpoint updates. It returns whether a full push is needed.
+func (s *DiscoveryServer) applyStagedEDSUpdates() bool {
+	s.stagedEDSMutex.Lock()
+	staged := s.stagedEDS
+	s.stagedEDS = nil
+	s.stagedEDSMutex.Unlock()
+
+	fullPush := false
+	for k, eps := range staged {
+		if s.applyEDSUpdate(k.cluster, k.hostname, k.namespace, eps) {
+			fullPush = true
+		}
+	}
+	return fullPush
+}
+
+// applyEDSUpdate updates EndpointShards data by clusterID, hostname, IstioEndpoints, returning whether a
+// full push is needed.
+func (s *DiscoveryServer) applyEDSUpdate(clusterID, hostname string, namespace string,
 	istioEndpoints []*model.IstioEndpoint) bool {
 	if len(istioEndpoints) == 0 {
 		// Should delete the service EndpointShards when endpoints become zero to prevent memory leak,
@@ -407,6 +465,10 @@ func (eds *EdsGenerator) Generate(proxy *model.Proxy, push *model.PushContext, w
 
 			if len(l.Endpoints) == 0 {
 				empty++
+				if features.EmptyEDSPolicy == features.EmptyEDSOmit {
+					// Omitted assignments are not cached, so cached assignments are never empty.
+					continue
+				}
 			}
 			resource := &discovery.Resource{
 				Name:     l.ClusterName,
@@ -416,6 +478,10 @@ func (eds *EdsGenerator) Generate(proxy *model.Proxy, push *model.PushContext, w
 			eds.Server.Cache.Add(builder, token, resource)
 		}
 	}
+	if len(resources) == 0 && empty > 0 && features.EmptyEDSPolicy == features.EmptyEDSOmit {
+		// Every requested cluster was omitted, do not respond at all.
+		return nil, model.DefaultXdsLogDetails, nil
+	}
 	return resources, model.XdsLogDetails{
 		Incremental:    len(edsUpdatedServices) != 0,
 		AdditionalInfo: fmt.Sprintf("empty:%v cached:%v/%v", empty, cached, cached+regenerated),
@@ -24,6 +24,7 @@ import (
 	"path/filepath"
 	"reflect"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -31,8 +32,10 @@ import (
 	"time"
 
 	endpoint "github.com/envoyproxy/go-control-plane/envoy/config/endpoint/v3"
+	discovery "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
 	uatomic "go.uber.org/atomic"
 
+	"istio.io/istio/pilot/pkg/features"
 	"istio.io/istio/pilot/pkg/model"
 	"istio.io/istio/pilot/pkg/networking"
 	"istio.io/istio/pilot/pkg/xds"
@@ -42,6 +45,7 @@ import (
 	"istio.io/istio/pkg/config/protocol"
 	"istio.io/istio/pkg/config/schema/gvk"
 	"istio.io/istio/pkg/test/env"
+	"istio.io/istio/pkg/test/util/retry"
 )
 
 // The connect and reconnect tests are removed - ADS already has coverage, and the
@@ -437,6 +441,51 @@ func TestDeleteService(t *testing.T) {
 	}
 }
 
+func TestEmptyEDSPolicy(t *testing.T) {
+	t.Run(string(features.EmptyEDSSendEmpty), func(t *testing.T) {
+		s := xds.NewFakeDiscoveryServer(t, xds.FakeOptions{})
+		ads := s.ConnectADS().WithType(v3.EndpointType)
+		res := ads.RequestResponseAck(&discovery.DiscoveryRequest{ResourceNames: []string{"fake-cluster"}})
+		if len(res.Resources) != 1 {
+			t.Fatalf("expected 1 resource, got %d", len(res.Resources))
+		}
+		cla := &endpoint.ClusterLoadAssignment{}
+		if err := res.Resources[0].UnmarshalTo(cla); err != nil {
+			t.Fatal(err)
+		}
+		if cla.ClusterName != "fake-cluster" || len(cla.Endpoints) != 0 {
+			t.Fatalf("expected empty assignment for fake-cluster, got %v", cla)
+		}
+	})
+	t.Run(string(features.EmptyEDSOmit), func(t *testing.T) {
+		old := features.EmptyEDSPolicy
+		features.EmptyEDSPolicy = features.EmptyEDSOmit
+		t.Cleanup(func() { features.EmptyEDSPolicy = old })
+
+		s := xds.NewFakeDiscoveryServer(t, xds.FakeOptions{})
+		addEdsCluster(s, "omit.example.com", "http", "10.0.0.54", 8080)
+		ads := s.ConnectADS().WithType(v3.EndpointType)
+
+		// A cluster without endpoints gets no response
+		ads.Request(&discovery.DiscoveryRequest{ResourceNames: []string{"fake-cluster"}})
+		ads.ExpectNoResponse()
+
+		// Only clusters with endpoints are included
+		cluster := "outbound|8080||omit.example.com"
+		res := ads.RequestResponseAck(&discovery.DiscoveryRequest{ResourceNames: []string{"fake-cluster", cluster}})
+		if len(res.Resources) != 1 {
+			t.Fatalf("expected 1 resource, got %d", len(res.Resources))
+		}
+		cla := &endpoint.ClusterLoadAssignment{}
+		if err := res.Resources[0].UnmarshalTo(cla); err != nil {
+			t.Fatal(err)
+		}
+		if cla.ClusterName != cluster || len(cla.Endpoints) == 0 {
+			t.Fatalf("expected endpoints for %v, got %v", cluster, cla)
+		}
+	})
+}
+
 func TestUpdateServiceAccount(t *testing.T) {
 	cluster1Endppoints := []*model.IstioEndpoint{
 		{Address: "10.172.0.1", ServiceAccount: "sa1"},
@@ -1125,3 +1174,71 @@ func contains(s []string, e string) bool {
 	}
 	return false
 }
+
+func TestAtomicEDSSwap(t *testing.T) {
+	original := features.AtomicEDSSwap
+	t.Cleanup(func() {
+		features.AtomicEDSSwap = original
+	})
+	features.AtomicEDSSwap = true
+	s := xds.NewFakeDiscoveryServer(t, xds.FakeOptions{DebounceTime: 200 * time.Millisecond})
+	addEdsCluster(s, "atomic.com", "http", "10.0.0.1", 8080)
+	cluster := "outbound|8080||atomic.com"
+	setEndpoints := func(addresses ...string) {
+		eps := []*model.IstioEndpoint{}
+		for _, addr := range addresses {
+			eps = append(eps, &model.IstioEndpoint{Address: addr, ServicePortName: "http", EndpointPort: 8080})
+		}
+		s.Discovery.MemRegistry.SetEndpoints("atomic.com", "", eps)
+	}
+	addresses := func(res *discovery.DiscoveryResponse) []string {
+		got := []string{}
+		for _, r := range res.Resources {
+			cla := &endpoint.ClusterLoadAssignment{}
+			if err := r.UnmarshalTo(cla); err != nil {
+				t.Fatal(err)
+			}
+			for _, llb := range cla.Endpoints {
+				for _, lb := range llb.LbEndpoints {
+					got = append(got, lb.GetEndpoint().Address.GetSocketAddress().Address)
+				}
+			}
+		}
+		sort.Strings(got)
+		return got
+	}
+	request := func() []string {
+		ads := s.ConnectADS().WithType(v3.EndpointType)
+		return addresses(ads.RequestResponseAck(&discovery.DiscoveryRequest{ResourceNames: []string{cluster}}))
+	}
+	before := []string{"10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.4"}
+	after := []string{"10.0.0.1", "10.0.0.2", "10.0.0.5", "10.0.0.6"}
+	setEndpoints(before...)
+	retry.UntilSuccessOrFail(t, func() error {
+		if got := request(); !reflect.DeepEqual(got, before) {
+			return fmt.Errorf("got endpoints %v, want %v", got, before)
+		}
+		return nil
+	})
+
+	watcher := s.ConnectADS().WithType(v3.EndpointType)
+	watcher.RequestResponseAck(&discovery.DiscoveryRequest{ResourceNames: []string{cluster}})
+
+	// The change is made of two updates; the intermediate set is never served
+	setEndpoints("10.0.0.1", "10.0.0.2")
+	if got := request(); !reflect.DeepEqual(got, before) {
+		t.Fatalf("expected the previous endpoints %v while the update is staged, got %v", before, got)
+	}
+	setEndpoints(after...)
+	if got := request(); !reflect.DeepEqual(got, before) {
+		t.Fatalf("expected the previous endpoints %v while the update is staged, got %v", before, got)
+	}
+
+	// Once pushed, the final set is served
+	if got := addresses(watcher.ExpectResponse()); !reflect.DeepEqual(got, after) {
+		t.Fatalf("expected the final endpoints %v to be pushed, got %v", after, got)
+	}
+	if got := request(); !reflect.DeepEqual(got, after) {
+		t.Fatalf("expected the final endpoints %v, got %v", after, got)
+	}
+}
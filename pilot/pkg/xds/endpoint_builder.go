@@ -115,6 +115,10 @@ func (b EndpointBuilder) Key() string {
 	if b.push != nil && b.push.AuthnPolicies != nil {
 		params = append(params, b.push.AuthnPolicies.AggregateVersion)
 	}
+	// Endpoints depend on the mesh config, so those generated with an override are cached separately.
+	if b.push != nil && b.push.MeshOverride != "" {
+		params = append(params, "mesh:"+b.push.MeshOverride)
+	}
 	if b.destinationRule != nil {
 		params = append(params, b.destinationRule.Name+"/"+b.destinationRule.Namespace)
 	}
@@ -0,0 +1,68 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package xds
+
+import (
+	"unicode/utf8"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opencensus.io/trace"
+)
+
+const (
+	exemplarProxyID = "proxy_id"
+	exemplarTraceID = "trace_id"
+)
+
+// pushTimeExemplars replaces pushTime when push latency exemplars are enabled. OpenCensus views cannot carry
+// exemplars to Prometheus, so it is a native Prometheus histogram.
+var pushTimeExemplars = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "pilot_xds_push_time",
+	Help:    "Total time in seconds Pilot takes to push lds, rds, cds and eds.",
+	Buckets: []float64{.01, .1, 1, 3, 5, 10, 20, 30},
+}, []string{"type"})
+
+// pushExemplar returns the exemplar labels of a push to con. The trace ID is only included if the stream has a
+// sampled span. The proxy ID is dropped if both would not fit in an exemplar.
+func pushExemplar(con *Connection) prometheus.Labels {
+	labels := prometheus.Labels{}
+	if span := trace.FromContext(con.streamContext()); span != nil && span.SpanContext().IsSampled() {
+		labels[exemplarTraceID] = span.SpanContext().TraceID.String()
+	}
+	if con.proxy != nil {
+		labels[exemplarProxyID] = con.proxy.ID
+		if exemplarRunes(labels) > prometheus.ExemplarMaxRunes {
+			delete(labels, exemplarProxyID)
+		}
+	}
+	return labels
+}
+
+func exemplarRunes(labels prometheus.Labels) int {
+	n := 0
+	for k, v := range labels {
+		n += utf8.RuneCountInString(k) + utf8.RuneCountInString(v)
+	}
+	return n
+}
+
+// observeWithExemplar records v on o, with labels as exemplar if there are any.
+func observeWithExemplar(o prometheus.Observer, v float64, labels prometheus.Labels) {
+	if eo, ok := o.(prometheus.ExemplarObserver); ok && len(labels) > 0 && exemplarRunes(labels) <= prometheus.ExemplarMaxRunes {
+		eo.ObserveWithExemplar(v, labels)
+		return
+	}
+	o.Observe(v)
+}
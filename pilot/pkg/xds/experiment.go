@@ -0,0 +1,38 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package xds
+
+import (
+	"hash/fnv"
+)
+
+const (
+	controlBucket    = "control"
+	experimentBucket = "experiment"
+)
+
+// connectionBucket returns the experiment bucket of a connection. The node ID is hashed, so a proxy is always
+// tagged into the same bucket, and percent of the node IDs are in the experiment bucket.
+func connectionBucket(nodeID string, percent int) string {
+	if percent <= 0 {
+		return controlBucket
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(nodeID))
+	if int(h.Sum32()%100) < percent {
+		return experimentBucket
+	}
+	return controlBucket
+}
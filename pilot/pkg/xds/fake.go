@@ -243,6 +243,12 @@ func NewFakeDiscoveryServer(t test.Failer, opts FakeOptions) *FakeDiscoveryServe
 	}()
 	t.Cleanup(func() {
 		grpcServer.Stop()
+		// Stopping cancels the streams, but does not wait for them. Wait for their goroutines to exit, so they
+		// do not outlive the test, e.g. reading features overridden by the next one.
+		deadline := time.Now().Add(10 * time.Second)
+		for s.connectionGoroutines.Load() > 0 && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
 	})
 	// Start the discovery server
 	s.Start(stop)
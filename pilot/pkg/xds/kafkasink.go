@@ -0,0 +1,74 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package xds
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+const kafkaJSONContentType = "application/vnd.kafka.json.v2+json"
+
+// KafkaRESTSink publishes push events to a Kafka topic through a Kafka REST proxy, as JSON records keyed by
+// the node ID, so the events of a proxy land on the same partition.
+type KafkaRESTSink struct {
+	// URL is the URL of the topic on the REST proxy, such as http://kafka-rest:8082/topics/istio-pushes.
+	URL    string
+	Client *http.Client
+}
+
+// NewKafkaRESTSink returns a sink publishing to the topic at url on a Kafka REST proxy.
+func NewKafkaRESTSink(url string) *KafkaRESTSink {
+	return &KafkaRESTSink{
+		URL:    url,
+		Client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+type kafkaRecord struct {
+	Key   string    `json:"key"`
+	Value PushEvent `json:"value"`
+}
+
+type kafkaRecords struct {
+	Records []kafkaRecord `json:"records"`
+}
+
+// Publish implements PushEventSink.
+func (k *KafkaRESTSink) Publish(events []PushEvent) error {
+	records := kafkaRecords{Records: make([]kafkaRecord, 0, len(events))}
+	for _, ev := range events {
+		records.Records = append(records.Records, kafkaRecord{Key: ev.Node, Value: ev})
+	}
+	b, err := json.Marshal(records)
+	if err != nil {
+		return err
+	}
+	resp, err := k.Client.Post(k.URL, kafkaJSONContentType, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("kafka REST proxy returned %v: %s", resp.Status, body)
+	}
+	return nil
+}
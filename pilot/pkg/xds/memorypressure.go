@@ -0,0 +1,95 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package xds
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"istio.io/istio/pilot/pkg/features"
+)
+
+// cgroupMemoryFiles are the usage and limit files of the cgroup v2 and v1 memory controllers.
+var cgroupMemoryFiles = [][2]string{
+	{"/sys/fs/cgroup/memory.current", "/sys/fs/cgroup/memory.max"},
+	{"/sys/fs/cgroup/memory/memory.usage_in_bytes", "/sys/fs/cgroup/memory/memory.limit_in_bytes"},
+}
+
+// newCgroupMemoryPressure returns a function reading the cgroup memory usage as a fraction of the limit.
+// Readings are cached for ttl, as they are taken for every new connection.
+func newCgroupMemoryPressure(ttl time.Duration) func() (float64, error) {
+	var mu sync.Mutex
+	var last time.Time
+	var pressure float64
+	var err error
+	return func() (float64, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if now := time.Now(); now.Sub(last) > ttl {
+			pressure, err = readCgroupMemoryPressure()
+			last = now
+		}
+		return pressure, err
+	}
+}
+
+func readCgroupMemoryPressure() (float64, error) {
+	for _, files := range cgroupMemoryFiles {
+		usage, err := readCgroupValue(files[0])
+		if err != nil {
+			continue
+		}
+		limit, err := readCgroupValue(files[1])
+		if err != nil {
+			return 0, err
+		}
+		if limit <= 0 {
+			return 0, nil
+		}
+		return float64(usage) / float64(limit), nil
+	}
+	return 0, fmt.Errorf("no cgroup memory controller found")
+}
+
+// readCgroupValue reads a cgroup memory value in bytes. An unlimited value is returned as 0.
+func readCgroupValue(file string) (int64, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return 0, err
+	}
+	v := strings.TrimSpace(string(b))
+	if v == "max" {
+		return 0, nil
+	}
+	return strconv.ParseInt(v, 10, 64)
+}
+
+// underMemoryPressure returns true if new connections should be rejected, as memory usage is above
+// MemoryPressureRejectThreshold. If the memory usage cannot be read, connections are not rejected.
+func (s *DiscoveryServer) underMemoryPressure() bool {
+	if features.MemoryPressureRejectThreshold <= 0 || s.MemoryPressure == nil {
+		return false
+	}
+	pressure, err := s.MemoryPressure()
+	if err != nil {
+		log.Debugf("failed to read memory pressure: %v", err)
+		return false
+	}
+	return pressure >= features.MemoryPressureRejectThreshold
+}
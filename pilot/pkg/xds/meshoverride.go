@@ -0,0 +1,117 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package xds
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"sigs.k8s.io/yaml"
+
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pkg/config/labels"
+	"istio.io/istio/pkg/config/mesh"
+)
+
+// meshConfigOverride is a mesh config override for the proxies matching a selector.
+type meshConfigOverride struct {
+	Name string `json:"name"`
+	// Selector selects the proxies by their node metadata labels.
+	Selector labels.Instance `json:"selector"`
+	// MeshConfig is merged over the mesh config, as YAML.
+	MeshConfig string `json:"meshConfig"`
+}
+
+// loadMeshConfigOverrides reads the mesh config overrides in file. There are none if file is empty.
+func loadMeshConfigOverrides(file string) ([]meshConfigOverride, error) {
+	if file == "" {
+		return nil, nil
+	}
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var overrides []meshConfigOverride
+	if err := yaml.UnmarshalStrict(b, &overrides); err != nil {
+		return nil, err
+	}
+	names := map[string]struct{}{}
+	for _, o := range overrides {
+		if o.Name == "" {
+			return nil, fmt.Errorf("mesh config override without a name")
+		}
+		if _, f := names[o.Name]; f {
+			return nil, fmt.Errorf("duplicate mesh config override %v", o.Name)
+		}
+		names[o.Name] = struct{}{}
+		if len(o.Selector) == 0 {
+			return nil, fmt.Errorf("mesh config override %v has no selector", o.Name)
+		}
+		if _, err := mesh.ApplyMeshConfig(o.MeshConfig, mesh.DefaultMeshConfig()); err != nil {
+			return nil, fmt.Errorf("invalid mesh config override %v: %v", o.Name, err)
+		}
+	}
+	return overrides, nil
+}
+
+// initMeshOverridePushes computes a push context for each mesh config override, with the mesh config of the
+// environment merged with the override, and attaches them to push. An override that cannot be computed is
+// skipped, so the matching proxies get config from push.
+func (s *DiscoveryServer) initMeshOverridePushes(push, oldPushContext *model.PushContext, req *model.PushRequest) {
+	if len(s.meshOverrides) == 0 {
+		return
+	}
+	push.MeshOverrides = make(map[string]*model.PushContext, len(s.meshOverrides))
+	for _, o := range s.meshOverrides {
+		mc, err := mesh.ApplyMeshConfig(o.MeshConfig, *s.Env.Mesh())
+		if err != nil {
+			log.Errorf("XDS: invalid mesh config override %v, ignoring it: %v", o.Name, err)
+			continue
+		}
+		env := *s.Env
+		env.Watcher = mesh.NewFixedWatcher(mc)
+		var old *model.PushContext
+		if oldPushContext != nil {
+			old = oldPushContext.MeshOverrides[o.Name]
+		}
+		override := model.NewPushContext()
+		override.PushVersion = push.PushVersion
+		override.JwtKeyResolver = push.JwtKeyResolver
+		override.MeshOverride = o.Name
+		if err := override.InitContext(&env, old, req); err != nil {
+			log.Errorf("XDS: failed to compute push context for mesh config override %v: %v", o.Name, err)
+			pushContextErrors.Increment()
+			continue
+		}
+		push.MeshOverrides[o.Name] = override
+	}
+}
+
+// meshOverridePush returns the push context to generate config for proxy with, that of the first mesh config
+// override selecting the proxy, or push if none does.
+func (s *DiscoveryServer) meshOverridePush(proxy *model.Proxy, push *model.PushContext) *model.PushContext {
+	if len(push.MeshOverrides) == 0 || proxy.Metadata == nil {
+		return push
+	}
+	for _, o := range s.meshOverrides {
+		if o.Selector.SubsetOf(proxy.Metadata.Labels) {
+			if override, f := push.MeshOverrides[o.Name]; f {
+				return override
+			}
+			return push
+		}
+	}
+	return push
+}
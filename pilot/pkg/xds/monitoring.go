@@ -17,8 +17,10 @@ import (
 	"sync"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"google.golang.org/grpc/codes"
 
+	"istio.io/istio/pilot/pkg/features"
 	"istio.io/istio/pilot/pkg/model"
 	v3 "istio.io/istio/pilot/pkg/xds/v3"
 	"istio.io/istio/pkg/mcp/status"
@@ -80,12 +82,140 @@ var (
 		monitoring.WithLabels(typeTag),
 	)
 
+	xdsGenerationTimeouts = monitoring.NewSum(
+		"pilot_xds_generation_timeouts",
+		"Total number of XDS generations that exceeded the generation timeout.",
+		monitoring.WithLabels(typeTag),
+	)
+
+	noOpPushesSuppressed = monitoring.NewSum(
+		"pilot_xds_noop_pushes_suppressed",
+		"Total number of XDS pushes skipped because the resources were identical to those last pushed.",
+		monitoring.WithLabels(typeTag),
+	)
+
+	expensiveGenerations = monitoring.NewSum(
+		"pilot_xds_expensive_generations",
+		"Total number of config generations using more CPU time than PILOT_GENERATION_CPU_WARN_THRESHOLD.",
+		monitoring.WithLabels(typeTag),
+	)
+
+	xdsInvalidResourceNames = monitoring.NewSum(
+		"pilot_xds_invalid_resource_names",
+		"Total number of XDS requests rejected for naming an invalid resource.",
+		monitoring.WithLabels(typeTag),
+	)
+
+	xdsOversizedRequests = monitoring.NewSum(
+		"pilot_xds_oversized_requests",
+		"Total number of XDS requests rejected for requesting more resources than allowed.",
+		monitoring.WithLabels(typeTag),
+	)
+
+	pushQueueDepth = monitoring.NewGauge(
+		"pilot_xds_push_queue_depth",
+		"Number of proxies waiting in the push queue for a push to start.",
+	)
+
+	connectionGoroutines = monitoring.NewGauge(
+		"pilot_xds_connection_goroutines",
+		"Number of goroutines serving XDS connections.",
+	)
+
+	goroutinesPerConnection = monitoring.NewGauge(
+		"pilot_xds_goroutines_per_connection",
+		"Average number of goroutines serving each XDS connection.",
+	)
+
+	xdsCacheBytes = monitoring.NewGauge(
+		"pilot_xds_cache_bytes",
+		"Approximate number of bytes held by the resources in the XDS cache.",
+	)
+
+	maxPushStaleness = monitoring.NewGauge(
+		"pilot_xds_max_push_staleness_seconds",
+		"The longest time any connected proxy has gone without a successful push.",
+	)
+
+	distinctNodes = monitoring.NewGauge(
+		"pilot_xds_distinct_nodes",
+		"Number of distinct node IDs that connected to this pilot within the PILOT_DISTINCT_NODES_WINDOW.",
+	)
+
+	xdsRejectedNodes = monitoring.NewSum(
+		"pilot_xds_rejected_nodes",
+		"Total number of XDS connections rejected for exceeding PILOT_MAX_DISTINCT_NODES.",
+	)
+
+	pushEventsDropped = monitoring.NewSum(
+		"pilot_xds_push_events_dropped",
+		"Total number of push events dropped, as the buffer of the push event sink was full.",
+	)
+
+	pushEventsFailed = monitoring.NewSum(
+		"pilot_xds_push_events_publish_failures",
+		"Total number of batches of push events the push event sink failed to publish.",
+	)
+
+	xdsInitialRequestTimeouts = monitoring.NewSum(
+		"pilot_xds_initial_request_timeouts",
+		"Total number of XDS connections closed for not sending a request within PILOT_INITIAL_REQUEST_TIMEOUT.",
+	)
+
+	xdsOversizedNodeMetadata = monitoring.NewSum(
+		"pilot_xds_oversized_node_metadata",
+		"Total number of XDS connections rejected for node metadata larger than PILOT_MAX_NODE_METADATA_BYTES.",
+	)
+
+	xdsMemoryPressureRejections = monitoring.NewSum(
+		"pilot_xds_memory_pressure_rejections",
+		"Total number of XDS connections rejected for exceeding PILOT_MEMORY_PRESSURE_REJECT_THRESHOLD.",
+	)
+
+	unauthorizedResources = monitoring.NewSum(
+		"pilot_xds_unauthorized_resources",
+		"Total number of requested resources proxies were not authorized for, if PILOT_UNAUTHORIZED_RESOURCE_POLICY "+
+			"is log-and-filter or deny.",
+		monitoring.WithLabels(typeTag),
+	)
+
+	xdsConnectionsTotal = monitoring.NewSum(
+		"pilot_xds_connections_total",
+		"Total number of XDS connections accepted by this pilot.",
+	)
+
+	xdsDisconnectionsTotal = monitoring.NewSum(
+		"pilot_xds_disconnections_total",
+		"Total number of accepted XDS connections that were closed.",
+	)
+
+	xdsConnectionLimitRejections = monitoring.NewSum(
+		"pilot_xds_connection_limit_rejections_total",
+		"Total number of XDS connections rejected for exceeding the global or region connection limits.",
+	)
+
+	xdsCacheCompactedEntries = monitoring.NewSum(
+		"pilot_xds_cache_compacted_entries",
+		"Total number of XDS cache entries removed by compaction.",
+	)
+
+	degradedSkippedPushes = monitoring.NewSum(
+		"pilot_xds_degraded_skipped_pushes",
+		"Total number of pushes skipped as pushes are frozen while istiod is degraded.",
+	)
+
 	xdsExpiredNonce = monitoring.NewSum(
 		"pilot_xds_expired_nonce",
 		"Total number of XDS requests with an expired nonce.",
 		monitoring.WithLabels(typeTag),
 	)
 
+	xdsStaleNonceRejections = monitoring.NewSum(
+		"pilot_xds_stale_nonce_rejections",
+		"Total number of XDS requests rejected for a stale nonce, with PILOT_STRICT_NONCE_VALIDATION.",
+		monitoring.WithLabels(typeTag),
+	)
+
 	monServices = monitoring.NewGauge(
 		"pilot_services",
 		"Total services known to pilot.",
@@ -151,6 +281,13 @@ var (
 		[]float64{.1, .5, 1, 3, 5, 10, 20, 30},
 	)
 
+	proxyConvergence = monitoring.NewDistribution(
+		"pilot_proxy_convergence_seconds",
+		"Delay in seconds between a config change and a proxy acking the resulting push.",
+		[]float64{.05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60},
+		monitoring.WithLabels(typeTag),
+	)
+
 	pushContextErrors = monitoring.NewSum(
 		"pilot_xds_push_context_errors",
 		"Number of errors (timeouts) initiating push context.",
@@ -196,6 +333,10 @@ func recordXDSClients(version string, delta float64) {
 	xdsClients.With(versionTag.Value(version)).Record(xdsClientTracker[version])
 }
 
+func recordPushQueueDepth(depth int) {
+	pushQueueDepth.Record(float64(depth))
+}
+
 func recordPushTriggers(reasons ...model.TriggerReason) {
 	for _, r := range reasons {
 		pushTriggers.With(typeTag.Value(string(r))).Increment()
@@ -245,8 +386,14 @@ func recordSendTime(duration time.Duration) {
 	sendTime.Record(duration.Seconds())
 }
 
-func recordPushTime(xdsType string, duration time.Duration) {
-	pushTime.With(typeTag.Value(v3.GetMetricType(xdsType))).Record(duration.Seconds())
+// recordPushTime records the push latency of xdsType. If push latency exemplars are enabled, the sample is recorded
+// with the exemplar labels of con instead.
+func recordPushTime(xdsType string, duration time.Duration, con *Connection) {
+	if features.PushLatencyExemplars {
+		observeWithExemplar(pushTimeExemplars.WithLabelValues(v3.GetMetricType(xdsType)), duration.Seconds(), pushExemplar(con))
+	} else {
+		pushTime.With(typeTag.Value(v3.GetMetricType(xdsType))).Record(duration.Seconds())
+	}
 	pushes.With(typeTag.Value(v3.GetMetricType(xdsType))).Increment()
 }
 
@@ -257,16 +404,40 @@ func init() {
 		ldsReject,
 		rdsReject,
 		xdsExpiredNonce,
+		xdsStaleNonceRejections,
 		totalXDSRejects,
 		monServices,
 		xdsClients,
 		xdsResponseWriteTimeouts,
 		pushes,
-		pushTime,
 		proxiesConvergeDelay,
+		proxyConvergence,
 		proxiesQueueTime,
 		pushContextErrors,
 		totalXDSInternalErrors,
+		xdsGenerationTimeouts,
+		noOpPushesSuppressed,
+		expensiveGenerations,
+		xdsOversizedRequests,
+		xdsInvalidResourceNames,
+		pushQueueDepth,
+		distinctNodes,
+		maxPushStaleness,
+		xdsRejectedNodes,
+		xdsOversizedNodeMetadata,
+		xdsInitialRequestTimeouts,
+		pushEventsDropped,
+		connectionGoroutines,
+		goroutinesPerConnection,
+		xdsCacheBytes,
+		pushEventsFailed,
+		xdsMemoryPressureRejections,
+		unauthorizedResources,
+		xdsConnectionsTotal,
+		xdsDisconnectionsTotal,
+		xdsConnectionLimitRejections,
+		degradedSkippedPushes,
+		xdsCacheCompactedEntries,
 		inboundUpdates,
 		pushTriggers,
 		sendTime,
@@ -275,4 +446,10 @@ func init() {
 		pilotSDSCertificateErrors,
 		configSizeBytes,
 	)
+	// The histogram with exemplars is exported under the same name, so only one of them may be registered.
+	if features.PushLatencyExemplars {
+		prometheus.MustRegister(pushTimeExemplars)
+	} else {
+		monitoring.MustRegister(pushTime)
+	}
 }
@@ -0,0 +1,72 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package xds
+
+import (
+	"context"
+	"sync"
+)
+
+// nodeGenerationLimit bounds the number of generations run concurrently for the same node ID, across all of its
+// connections, so a proxy reconnecting repeatedly cannot cause redundant parallel work.
+type nodeGenerationLimit struct {
+	max int
+
+	mu    sync.Mutex
+	nodes map[string]*nodeSlots
+}
+
+// nodeSlots are the generation slots of a node, shared by its connections while any holds or waits for one.
+type nodeSlots struct {
+	slots chan struct{}
+	refs  int
+}
+
+func newNodeGenerationLimit(max int) *nodeGenerationLimit {
+	return &nodeGenerationLimit{max: max, nodes: map[string]*nodeSlots{}}
+}
+
+// acquire waits for a generation slot of node, until ctx is done. On success, the returned function releases the
+// slot.
+func (l *nodeGenerationLimit) acquire(ctx context.Context, node string) (func(), error) {
+	l.mu.Lock()
+	n, f := l.nodes[node]
+	if !f {
+		n = &nodeSlots{slots: make(chan struct{}, l.max)}
+		l.nodes[node] = n
+	}
+	n.refs++
+	l.mu.Unlock()
+
+	select {
+	case n.slots <- struct{}{}:
+		return func() {
+			<-n.slots
+			l.unref(node, n)
+		}, nil
+	case <-ctx.Done():
+		l.unref(node, n)
+		return nil, ctx.Err()
+	}
+}
+
+func (l *nodeGenerationLimit) unref(node string, n *nodeSlots) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	n.refs--
+	if n.refs == 0 {
+		delete(l.nodes, node)
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package xds
+
+import (
+	"reflect"
+	"strings"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	"github.com/golang/protobuf/proto"
+
+	"istio.io/istio/pilot/pkg/features"
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/util/sets"
+)
+
+// knownNodeMetadataKeys are the node metadata keys parsed into model.BootstrapNodeMetadata. These are always retained.
+var knownNodeMetadataKeys = metadataKeys(reflect.TypeOf(model.BootstrapNodeMetadata{}), sets.NewSet())
+
+func metadataKeys(t reflect.Type, keys sets.Set) sets.Set {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Anonymous {
+			metadataKeys(f.Type, keys)
+			continue
+		}
+		if name := strings.Split(f.Tag.Get("json"), ",")[0]; name != "" && name != "-" {
+			keys.Insert(name)
+		}
+	}
+	return keys
+}
+
+// filterNodeMetadata drops the node metadata keys that are neither known nor in AllowedNodeMetadataKeys. If
+// AllowedNodeMetadataKeys is not set, the node is returned as is.
+func filterNodeMetadata(node *core.Node) *core.Node {
+	if len(features.AllowedNodeMetadataKeys) == 0 || node.GetMetadata() == nil {
+		return node
+	}
+	allowed := sets.NewSet(features.AllowedNodeMetadataKeys...)
+	var dropped []string
+	for k := range node.Metadata.Fields {
+		if !knownNodeMetadataKeys.Contains(k) && !allowed.Contains(k) {
+			dropped = append(dropped, k)
+		}
+	}
+	if len(dropped) == 0 {
+		return node
+	}
+	log.Debugf("dropping node metadata keys %v of %v", dropped, node.Id)
+	out := proto.Clone(node).(*core.Node)
+	for _, k := range dropped {
+		delete(out.Metadata.Fields, k)
+	}
+	return out
+}
@@ -0,0 +1,93 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package xds
+
+import (
+	"sync"
+	"time"
+
+	"istio.io/istio/pilot/pkg/features"
+)
+
+// nodeTracker tracks the distinct node IDs that connected within a rolling window, optionally rejecting new
+// node IDs beyond a cap. Unlike the connection limit, this bounds the per-node state accumulated by ID churn.
+type nodeTracker struct {
+	mu sync.Mutex
+	// limit is the maximum number of distinct node IDs in the window. 0 means unlimited.
+	limit  int
+	window time.Duration
+	// lastSeen is the last time each node ID connected.
+	lastSeen  map[string]time.Time
+	lastPrune time.Time
+}
+
+func newNodeTracker(limit int, window time.Duration) *nodeTracker {
+	return &nodeTracker{
+		limit:    limit,
+		window:   window,
+		lastSeen: map[string]time.Time{},
+	}
+}
+
+// newNodeTrackerFromFeatures builds a nodeTracker from the configured feature flags.
+func newNodeTrackerFromFeatures() *nodeTracker {
+	return newNodeTracker(features.MaxDistinctNodes, features.DistinctNodesWindow)
+}
+
+// observe records a connection from the node ID. It returns false, without recording it, if the node ID was
+// not seen within the window and the cap has been reached. Otherwise, it returns a function undoing the record,
+// for a connection rejected afterwards.
+func (t *nodeTracker) observe(id string, now time.Time) (func(), bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_, seen := t.lastSeen[id]
+	// Pruning is linear in the number of nodes, so only do it periodically or when it may avoid a rejection.
+	full := !seen && t.limit > 0 && len(t.lastSeen) >= t.limit
+	if full || now.Sub(t.lastPrune) > t.window/10 {
+		t.prune(now)
+		_, seen = t.lastSeen[id]
+	}
+	if !seen && t.limit > 0 && len(t.lastSeen) >= t.limit {
+		return nil, false
+	}
+	prev := t.lastSeen[id]
+	t.lastSeen[id] = now
+	distinctNodes.Record(float64(len(t.lastSeen)))
+	return func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		if last, f := t.lastSeen[id]; !f || !last.Equal(now) {
+			// Recorded again since, or pruned.
+			return
+		}
+		if seen {
+			t.lastSeen[id] = prev
+		} else {
+			delete(t.lastSeen, id)
+		}
+		distinctNodes.Record(float64(len(t.lastSeen)))
+	}, true
+}
+
+// prune forgets node IDs not seen within the window.
+func (t *nodeTracker) prune(now time.Time) {
+	for id, last := range t.lastSeen {
+		if now.Sub(last) > t.window {
+			delete(t.lastSeen, id)
+		}
+	}
+	t.lastPrune = now
+	distinctNodes.Record(float64(len(t.lastSeen)))
+}
@@ -0,0 +1,122 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package xds
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// proxyErrorRetention is how long the errors of a node ID are kept after its last error.
+const proxyErrorRetention = time.Hour
+
+// ProxyError is a generation or push error of a connection.
+type ProxyError struct {
+	Time         time.Time `json:"time"`
+	ConnectionID string    `json:"connectionId"`
+	TypeURL      string    `json:"typeUrl"`
+	Error        string    `json:"error"`
+}
+
+// proxyErrorHistory records the most recent errors of each node ID. The errors are kept by node ID rather than by
+// connection, since a failing push closes the connection.
+type proxyErrorHistory struct {
+	max int
+
+	mu    sync.Mutex
+	nodes map[string][]ProxyError
+}
+
+func newProxyErrorHistory(max int) *proxyErrorHistory {
+	return &proxyErrorHistory{max: max, nodes: map[string][]ProxyError{}}
+}
+
+func (h *proxyErrorHistory) record(node string, e ProxyError) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.prune(e.Time)
+	errs := append(h.nodes[node], e)
+	if len(errs) > h.max {
+		errs = errs[len(errs)-h.max:]
+	}
+	h.nodes[node] = errs
+}
+
+// get returns the recent errors of node, oldest first.
+func (h *proxyErrorHistory) get(node string, now time.Time) ([]ProxyError, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.prune(now)
+	errs, f := h.nodes[node]
+	return append([]ProxyError(nil), errs...), f
+}
+
+// prune forgets the errors of nodes without an error within proxyErrorRetention.
+func (h *proxyErrorHistory) prune(now time.Time) {
+	for node, errs := range h.nodes {
+		if now.Sub(errs[len(errs)-1].Time) > proxyErrorRetention {
+			delete(h.nodes, node)
+		}
+	}
+}
+
+// recordProxyError records an error generating or pushing typeURL to con.
+func (s *DiscoveryServer) recordProxyError(con *Connection, typeURL string, err error) {
+	if s.proxyErrors == nil {
+		return
+	}
+	s.proxyErrors.record(con.node.GetId(), ProxyError{
+		Time:         time.Now(),
+		ConnectionID: con.ConID,
+		TypeURL:      typeURL,
+		Error:        err.Error(),
+	})
+}
+
+// ConnectionErrorsHandler serves the recent generation and push errors of a proxy.
+// It is mapped to /debug/connections/{id}/errors, where id is a node ID or a connection ID.
+func (s *DiscoveryServer) ConnectionErrorsHandler(w http.ResponseWriter, req *http.Request) {
+	id := strings.TrimPrefix(req.URL.Path, "/debug/connections/")
+	if !strings.HasSuffix(id, "/errors") {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	id = strings.TrimSuffix(id, "/errors")
+
+	node, found := "", false
+	for _, con := range s.Clients() {
+		if con.node.GetId() == id || con.ConID == id {
+			node, found = con.node.GetId(), true
+			break
+		}
+	}
+	if node == "" {
+		node = id
+	}
+	errs := []ProxyError{}
+	if s.proxyErrors != nil {
+		if recorded, f := s.proxyErrors.get(node, time.Now()); f {
+			errs, found = recorded, true
+		}
+	}
+	if !found {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte("Proxy not connected to this Pilot instance, and no errors recorded for it.\n"))
+		return
+	}
+	writeJSON(w, errs)
+}
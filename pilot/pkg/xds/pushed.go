@@ -0,0 +1,89 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package xds
+
+import (
+	"sort"
+	"sync"
+
+	discovery "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+
+	"istio.io/istio/pilot/pkg/features"
+	"istio.io/istio/pilot/pkg/model"
+)
+
+// pushedResources records the resources last pushed to a connection, keyed by type and resource name.
+// This is used by the debug config dump to show exactly what a proxy was sent.
+// A nil pushedResources records nothing.
+type pushedResources struct {
+	mu     sync.RWMutex
+	byType map[string]map[string]*discovery.Resource
+}
+
+// newPushedResources returns a pushedResources if EnablePushedConfigDump is set, or nil otherwise.
+func newPushedResources() *pushedResources {
+	if !features.EnablePushedConfigDump {
+		return nil
+	}
+	return &pushedResources{byType: map[string]map[string]*discovery.Resource{}}
+}
+
+// record stores the resources sent for a type. If replace is set, the resources are the full set for
+// the type and previously recorded resources are dropped; otherwise they are merged in.
+func (p *pushedResources) record(typeURL string, res model.Resources, replace bool) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	cur := p.byType[typeURL]
+	if cur == nil || replace {
+		cur = make(map[string]*discovery.Resource, len(res))
+		p.byType[typeURL] = cur
+	}
+	for _, r := range res {
+		cur[r.Name] = r
+	}
+}
+
+// remove drops the given resources of a type.
+func (p *pushedResources) remove(typeURL string, names []string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	cur := p.byType[typeURL]
+	for _, name := range names {
+		delete(cur, name)
+	}
+}
+
+// get returns the resources last pushed for a type, sorted by name.
+func (p *pushedResources) get(typeURL string) model.Resources {
+	if p == nil {
+		return nil
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	res := make(model.Resources, 0, len(p.byType[typeURL]))
+	for _, r := range p.byType[typeURL] {
+		res = append(res, r)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Name < res[j].Name
+	})
+	return res
+}
@@ -0,0 +1,121 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package xds
+
+import (
+	"time"
+
+	"istio.io/istio/pilot/pkg/features"
+)
+
+// maxPushEventBatch bounds the number of push events published to a sink at once.
+const maxPushEventBatch = 100
+
+// PushEvent describes a push of a type of config to a proxy.
+type PushEvent struct {
+	// Node is the ID of the proxy.
+	Node string `json:"node"`
+	// Type is the type URL of the pushed config.
+	Type string `json:"type"`
+	// Size is the size of the pushed resources, in bytes.
+	Size int `json:"size"`
+	// Duration is the time taken to generate and send the push.
+	Duration time.Duration `json:"duration"`
+	// Time is the time the push completed.
+	Time time.Time `json:"time"`
+}
+
+// PushEventSink receives push events, such as a message bus. Publish is called from a single goroutine, with
+// batches of events.
+type PushEventSink interface {
+	Publish(events []PushEvent) error
+}
+
+// pushEventPublisher publishes push events to a sink asynchronously. Events are buffered up to a bound, and
+// dropped if the sink does not keep up, so pushes never block on the sink.
+type pushEventPublisher struct {
+	sink   PushEventSink
+	events chan PushEvent
+}
+
+func newPushEventPublisher(sink PushEventSink, size int) *pushEventPublisher {
+	return &pushEventPublisher{
+		sink:   sink,
+		events: make(chan PushEvent, size),
+	}
+}
+
+// publish queues the event, or drops it if the buffer is full.
+func (p *pushEventPublisher) publish(ev PushEvent) {
+	select {
+	case p.events <- ev:
+	default:
+		pushEventsDropped.Increment()
+	}
+}
+
+// run publishes the queued events to the sink until stop is closed.
+func (p *pushEventPublisher) run(stop <-chan struct{}) {
+	for {
+		select {
+		case ev := <-p.events:
+			p.publishBatch(ev)
+		case <-stop:
+			return
+		}
+	}
+}
+
+// publishBatch publishes ev, along with the events queued after it, up to maxPushEventBatch.
+func (p *pushEventPublisher) publishBatch(ev PushEvent) {
+	batch := []PushEvent{ev}
+collect:
+	for len(batch) < maxPushEventBatch {
+		select {
+		case ev := <-p.events:
+			batch = append(batch, ev)
+		default:
+			break collect
+		}
+	}
+	if err := p.sink.Publish(batch); err != nil {
+		log.Warnf("failed to publish %d push events: %v", len(batch), err)
+		pushEventsFailed.Increment()
+	}
+}
+
+// SetPushEventSink sets the sink push events are published to. It must be called before Start. If it is not
+// called, push events are not published.
+func (s *DiscoveryServer) SetPushEventSink(sink PushEventSink) {
+	if sink == nil {
+		s.pushEvents = nil
+		return
+	}
+	s.pushEvents = newPushEventPublisher(sink, features.PushEventsBufferSize)
+}
+
+// publishPushEvent publishes the statistics of a push of size bytes of typeURL to con, started at start.
+func (s *DiscoveryServer) publishPushEvent(con *Connection, typeURL string, size int, start time.Time) {
+	if s.pushEvents == nil {
+		return
+	}
+	s.pushEvents.publish(PushEvent{
+		Node:     con.proxy.ID,
+		Type:     typeURL,
+		Size:     size,
+		Duration: time.Since(start),
+		Time:     time.Now(),
+	})
+}
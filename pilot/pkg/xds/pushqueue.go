@@ -15,8 +15,11 @@
 package xds
 
 import (
+	"sort"
 	"sync"
+	"time"
 
+	"istio.io/istio/pilot/pkg/features"
 	"istio.io/istio/pilot/pkg/model"
 )
 
@@ -36,6 +39,21 @@ type PushQueue struct {
 	processing map[*Connection]*model.PushRequest
 
 	shuttingDown bool
+
+	// fair orders the queue by the push time consumed by each connection, rather than first in first out.
+	fair bool
+	// virtualTime is the start tag of the last dequeued connection, if fair is set.
+	virtualTime time.Duration
+}
+
+// pushFairness is the scheduling state of a connection in a fair PushQueue, using start-time fair queueing:
+// each connection is tagged with the virtual time at which it may start, which advances by the push time it
+// consumes. Connections are pushed in order of their start tag.
+type pushFairness struct {
+	start  time.Duration
+	finish time.Duration
+	// dequeued is when the connection was last dequeued, to measure the push time consumed.
+	dequeued time.Time
 }
 
 func NewPushQueue() *PushQueue {
@@ -43,7 +61,27 @@ func NewPushQueue() *PushQueue {
 		pending:    make(map[*Connection]*model.PushRequest),
 		processing: make(map[*Connection]*model.PushRequest),
 		cond:       sync.NewCond(&sync.Mutex{}),
+		fair:       features.PushFairness == features.PushFairnessFair,
+	}
+}
+
+// push adds a connection to the queue, which must not already be queued.
+func (p *PushQueue) push(con *Connection) {
+	if !p.fair {
+		p.queue = append(p.queue, con)
+		return
 	}
+	con.fairness.start = p.virtualTime
+	if con.fairness.finish > con.fairness.start {
+		con.fairness.start = con.fairness.finish
+	}
+	// Insert after any connection with the same start tag, so ties are first in first out.
+	i := sort.Search(len(p.queue), func(i int) bool {
+		return p.queue[i].fairness.start > con.fairness.start
+	})
+	p.queue = append(p.queue, nil)
+	copy(p.queue[i+1:], p.queue[i:])
+	p.queue[i] = con
 }
 
 // Enqueue will mark a proxy as pending a push. If it is already pending, pushInfo will be merged.
@@ -68,7 +106,8 @@ func (p *PushQueue) Enqueue(con *Connection, pushRequest *model.PushRequest) {
 	}
 
 	p.pending[con] = pushRequest
-	p.queue = append(p.queue, con)
+	p.push(con)
+	recordPushQueueDepth(len(p.queue))
 	// Signal waiters on Dequeue that a new item is available
 	p.cond.Signal()
 }
@@ -89,6 +128,11 @@ func (p *PushQueue) Dequeue() (con *Connection, request *model.PushRequest, shut
 	}
 
 	con, p.queue = p.queue[0], p.queue[1:]
+	recordPushQueueDepth(len(p.queue))
+	if p.fair {
+		p.virtualTime = con.fairness.start
+		con.fairness.dequeued = time.Now()
+	}
 
 	request = p.pending[con]
 	delete(p.pending, con)
@@ -104,12 +148,16 @@ func (p *PushQueue) MarkDone(con *Connection) {
 	defer p.cond.L.Unlock()
 	request := p.processing[con]
 	delete(p.processing, con)
+	if p.fair {
+		con.fairness.finish = con.fairness.start + time.Since(con.fairness.dequeued)
+	}
 
 	// If the info is present, that means Enqueue was called while connection was not yet marked done.
 	// This means we need to add it back to the queue.
 	if request != nil {
 		p.pending[con] = request
-		p.queue = append(p.queue, con)
+		p.push(con)
+		recordPushQueueDepth(len(p.queue))
 		p.cond.Signal()
 	}
 }
@@ -121,6 +169,13 @@ func (p *PushQueue) Pending() int {
 	return len(p.queue)
 }
 
+// Drained returns true if there are no pending or in progress pushes.
+func (p *PushQueue) Drained() bool {
+	p.cond.L.Lock()
+	defer p.cond.L.Unlock()
+	return len(p.queue) == 0 && len(p.processing) == 0
+}
+
 // ShutDown will cause queue to ignore all new items added to it. As soon as the
 // worker goroutines have drained the existing items in the queue, they will be
 // instructed to exit.
@@ -23,6 +23,7 @@ import (
 	"testing"
 	"time"
 
+	"istio.io/istio/pilot/pkg/features"
 	"istio.io/istio/pilot/pkg/model"
 	"istio.io/istio/pkg/config"
 	"istio.io/istio/pkg/config/schema/gvk"
@@ -371,3 +372,46 @@ func TestProxyQueue(t *testing.T) {
 		}
 	})
 }
+
+func TestPushQueueFairness(t *testing.T) {
+	// dequeuesBeforeLarge returns the number of pushes to small proxies, out of at most limit, before a proxy
+	// with an expensive push is pushed again.
+	dequeuesBeforeLarge := func(t *testing.T, fairness features.PushFairnessType, limit int) int {
+		original := features.PushFairness
+		features.PushFairness = fairness
+		p := NewPushQueue()
+		features.PushFairness = original
+		defer p.ShutDown()
+
+		large := &Connection{ConID: "large"}
+		smalls := []*Connection{{ConID: "small-1"}, {ConID: "small-2"}, {ConID: "small-3"}}
+
+		p.Enqueue(large, &model.PushRequest{})
+		ExpectDequeue(t, p, large)
+		// While the expensive push is in progress, all proxies are queued again
+		for _, con := range smalls {
+			p.Enqueue(con, &model.PushRequest{})
+		}
+		p.Enqueue(large, &model.PushRequest{})
+		time.Sleep(50 * time.Millisecond)
+		p.MarkDone(large)
+
+		// Small proxies keep being updated, with cheap pushes
+		for i := 0; i < limit; i++ {
+			con := getWithTimeout(p)
+			if con == large {
+				return i
+			}
+			p.MarkDone(con)
+			p.Enqueue(con, &model.PushRequest{})
+		}
+		return limit
+	}
+
+	if n := dequeuesBeforeLarge(t, features.PushFairnessFIFO, 30); n != 3 {
+		t.Fatalf("fifo: expected the large proxy to be pushed after the 3 small proxies, got %d", n)
+	}
+	if n := dequeuesBeforeLarge(t, features.PushFairnessFair, 30); n != 30 {
+		t.Fatalf("fair: expected small proxies to be pushed ahead of the large proxy, got %d", n)
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package xds
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	v3 "istio.io/istio/pilot/pkg/xds/v3"
+)
+
+// maxResourceNameLength bounds the length of a requested resource name, well above any name istiod generates.
+const maxResourceNameLength = 1024
+
+// resourceNameValidators hold the validation specific to a type, on top of validateResourceName.
+var resourceNameValidators = map[string]func(name string) error{
+	v3.ClusterType:  validateClusterName,
+	v3.EndpointType: validateClusterName,
+	v3.RouteType:    validateRouteName,
+}
+
+// checkResourceNames returns an error if a request names a clearly invalid resource, for ValidateResourceNames.
+func checkResourceNames(con *Connection, typeURL string, names []string) error {
+	validate := resourceNameValidators[typeURL]
+	for _, name := range names {
+		err := validateResourceName(name)
+		if err == nil && validate != nil {
+			err = validate(name)
+		}
+		if err != nil {
+			xdsInvalidResourceNames.With(typeTag.Value(v3.GetMetricType(typeURL))).Increment()
+			log.Warnf("ADS:%s: rejecting request from %s for invalid resource name %q: %v",
+				v3.GetShortType(typeURL), con.ConID, name, err)
+			return status.Errorf(codes.InvalidArgument, "invalid %s resource name %q: %v", v3.GetShortType(typeURL), name, err)
+		}
+	}
+	return nil
+}
+
+// validateResourceName validates a resource name of any type.
+func validateResourceName(name string) error {
+	if name == "" {
+		return fmt.Errorf("empty name")
+	}
+	if len(name) > maxResourceNameLength {
+		return fmt.Errorf("name longer than %d characters", maxResourceNameLength)
+	}
+	for _, r := range name {
+		if unicode.IsSpace(r) || !unicode.IsPrint(r) {
+			return fmt.Errorf("invalid character %q", r)
+		}
+	}
+	return nil
+}
+
+// validateClusterName validates the names of clusters istiod generates for services, in the
+// direction|port|subset|hostname form. Other names, such as static clusters, are accepted.
+func validateClusterName(name string) error {
+	if !strings.HasPrefix(name, "outbound|") && !strings.HasPrefix(name, "inbound|") {
+		return nil
+	}
+	parts := strings.Split(name, "|")
+	if len(parts) != 4 {
+		return fmt.Errorf("expected direction|port|subset|hostname")
+	}
+	// Services listening on a unix domain socket have port 0.
+	if port, err := strconv.Atoi(parts[1]); err != nil || port < 0 || port > 65535 {
+		return fmt.Errorf("invalid port %q", parts[1])
+	}
+	if parts[3] == "" {
+		return fmt.Errorf("empty hostname")
+	}
+	return nil
+}
+
+// validateRouteName validates route names, a port optionally preceded by a hostname, or any other name for
+// static routes. A name ending in a port separator must have a valid port.
+func validateRouteName(name string) error {
+	i := strings.LastIndex(name, ":")
+	if i < 0 {
+		return nil
+	}
+	if port, err := strconv.Atoi(name[i+1:]); err != nil || port <= 0 || port > 65535 {
+		return fmt.Errorf("invalid port %q", name[i+1:])
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package xds
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+
+	discovery "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	"github.com/golang/protobuf/jsonpb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"istio.io/istio/pilot/pkg/model"
+	v3 "istio.io/istio/pilot/pkg/xds/v3"
+)
+
+// restTypes maps the paths of the REST-JSON variant of the xDS protocol to the type served.
+var restTypes = map[string]string{
+	"/v3/discovery:clusters":  v3.ClusterType,
+	"/v3/discovery:endpoints": v3.EndpointType,
+	"/v3/discovery:listeners": v3.ListenerType,
+	"/v3/discovery:routes":    v3.RouteType,
+}
+
+// AddRESTHandlers registers the handlers of the REST-JSON variant of the xDS protocol on mux. Each request is
+// answered with the resources generated for the node of the request, as they would be pushed over gRPC. Requests
+// are authenticated, and go through the same checks as a new gRPC connection.
+func (s *DiscoveryServer) AddRESTHandlers(mux *http.ServeMux) {
+	for path, typeURL := range restTypes {
+		mux.Handle(path, s.restHandler(typeURL))
+	}
+}
+
+func (s *DiscoveryServer) restHandler(typeURL string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		ids, err := s.authenticateRequest(r)
+		if err != nil {
+			restError(w, http.StatusUnauthorized, err)
+			return
+		}
+		req := &discovery.DiscoveryRequest{}
+		if err := (&jsonpb.Unmarshaler{AllowUnknownFields: true}).Unmarshal(r.Body, req); err != nil {
+			restError(w, http.StatusBadRequest, fmt.Errorf("invalid discovery request: %v", err))
+			return
+		}
+		if req.Node.GetId() == "" {
+			restError(w, http.StatusBadRequest, fmt.Errorf("missing node ID"))
+			return
+		}
+		con := newConnection(r.RemoteAddr, restStream{ctx: r.Context()})
+		con.Identities = ids
+		resp, err := s.restResponse(con, typeURL, req)
+		if err != nil {
+			restError(w, restStatusCode(err), err)
+			return
+		}
+		buf := &bytes.Buffer{}
+		if err := (&jsonpb.Marshaler{}).Marshal(buf, resp); err != nil {
+			restError(w, http.StatusInternalServerError, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(buf.Bytes())
+	}
+}
+
+// restStream is the stream of the connection serving a REST request, only providing the context of the request.
+type restStream struct {
+	DiscoveryStream
+	ctx context.Context
+}
+
+func (r restStream) Context() context.Context {
+	return r.ctx
+}
+
+// restResponse generates the response to a REST request of the type, using the same generators as gRPC streams.
+// The connection is admitted as a gRPC connection would be, and released once the response is generated.
+func (s *DiscoveryServer) restResponse(con *Connection, typeURL string,
+	req *discovery.DiscoveryRequest) (*discovery.DiscoveryResponse, error) {
+	if err := s.admitConnection(req.Node, con); err != nil {
+		return nil, err
+	}
+	defer s.releaseConnection(con)
+	if err := s.configureConnection(req.Node, con); err != nil {
+		return nil, err
+	}
+	s.initializeProxyState(req.Node, con.proxy)
+	w := &model.WatchedResource{TypeUrl: typeURL, ResourceNames: req.ResourceNames, LastRequest: req}
+	con.proxy.WatchedResources[typeURL] = w
+
+	gen := s.findGenerator(typeURL, con)
+	if gen == nil {
+		return nil, fmt.Errorf("no generator for %s", typeURL)
+	}
+	push := s.meshOverridePush(con.proxy, s.globalPushContext())
+	res, _, err := s.generate(con, gen, push, w, &model.PushRequest{Full: true, Push: push})
+	if err != nil {
+		return nil, err
+	}
+	return &discovery.DiscoveryResponse{
+		ControlPlane: ControlPlane(),
+		TypeUrl:      typeURL,
+		VersionInfo:  versionInfo(),
+		Nonce:        nonce(push.LedgerVersion),
+		Resources:    model.ResourcesToAny(res),
+	}, nil
+}
+
+// restStatusCode maps the gRPC status of an error to the HTTP status code of the REST response.
+func restStatusCode(err error) int {
+	switch status.Code(err) {
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.InvalidArgument:
+		return http.StatusBadRequest
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func restError(w http.ResponseWriter, code int, err error) {
+	w.WriteHeader(code)
+	_, _ = w.Write([]byte(err.Error()))
+}
@@ -21,12 +21,15 @@ import (
 	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
 	tls "github.com/envoyproxy/go-control-plane/envoy/extensions/transport_sockets/tls/v3"
 	discovery "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
 	"istio.io/istio/pilot/pkg/features"
 	"istio.io/istio/pilot/pkg/model"
 	"istio.io/istio/pilot/pkg/networking/util"
 	"istio.io/istio/pilot/pkg/secrets"
 	authnmodel "istio.io/istio/pilot/pkg/security/model"
+	v3 "istio.io/istio/pilot/pkg/xds/v3"
 	"istio.io/istio/pkg/config"
 	"istio.io/istio/pkg/config/schema/gvk"
 )
@@ -101,11 +104,34 @@ func (s *SecretGen) proxyAuthorizedForSecret(proxy *model.Proxy, sr SecretResour
 	return nil
 }
 
+// unauthorizedResourcesDetails applies the UnauthorizedResourcePolicy to resources the proxy requested, but is not
+// authorized for. It returns the push log details reporting them, or an error if the request is denied.
+func unauthorizedResourcesDetails(proxy *model.Proxy, typeURL string, resources []string, reason string) (model.XdsLogDetails, error) {
+	if len(resources) == 0 {
+		return model.DefaultXdsLogDetails, nil
+	}
+	switch features.UnauthorizedResourcePolicy {
+	case features.UnauthorizedResourceDeny:
+		unauthorizedResources.With(typeTag.Value(typeURL)).RecordInt(int64(len(resources)))
+		return model.DefaultXdsLogDetails, status.Errorf(codes.PermissionDenied,
+			"proxy %v is not authorized for %v: %v", proxy.ID, resources, reason)
+	case features.UnauthorizedResourceLogAndFilter:
+		unauthorizedResources.With(typeTag.Value(typeURL)).RecordInt(int64(len(resources)))
+		return model.XdsLogDetails{AdditionalInfo: fmt.Sprintf("unauthorized:%v", resources)}, nil
+	default:
+		return model.DefaultXdsLogDetails, nil
+	}
+}
+
 func (s *SecretGen) Generate(proxy *model.Proxy, push *model.PushContext, w *model.WatchedResource,
 	req *model.PushRequest) (model.Resources, model.XdsLogDetails, error) {
 	if proxy.VerifiedIdentity == nil {
 		log.Warnf("proxy %v is not authorized to receive secrets. Ensure you are connecting over TLS port and are authenticated.", proxy.ID)
-		return nil, model.DefaultXdsLogDetails, nil
+		if w == nil {
+			return nil, model.DefaultXdsLogDetails, nil
+		}
+		details, err := unauthorizedResourcesDetails(proxy, v3.SecretType, w.ResourceNames, "proxy is not authenticated")
+		return nil, details, err
 	}
 	secrets, err := s.secrets.ForCluster(proxy.Metadata.ClusterID)
 	if err != nil {
@@ -114,7 +140,11 @@ func (s *SecretGen) Generate(proxy *model.Proxy, push *model.PushContext, w *mod
 	}
 	if err := secrets.Authorize(proxy.VerifiedIdentity.ServiceAccount, proxy.VerifiedIdentity.Namespace); err != nil {
 		log.Warnf("proxy %v is not authorized to receive secrets: %v", proxy.ID, err)
-		return nil, model.DefaultXdsLogDetails, nil
+		if w == nil {
+			return nil, model.DefaultXdsLogDetails, nil
+		}
+		details, err := unauthorizedResourcesDetails(proxy, v3.SecretType, w.ResourceNames, err.Error())
+		return nil, details, err
 	}
 	if req == nil || !needsUpdate(proxy, req.ConfigsUpdated) {
 		return nil, model.DefaultXdsLogDetails, nil
@@ -125,6 +155,8 @@ func (s *SecretGen) Generate(proxy *model.Proxy, push *model.PushContext, w *mod
 	}
 	results := model.Resources{}
 	cached, regenerated := 0, 0
+	var unauthorized []string
+	var unauthorizedReason string
 	for _, resource := range w.ResourceNames {
 		sr, err := parseResourceName(resource, proxy.ConfigNamespace)
 		if err != nil {
@@ -143,6 +175,8 @@ func (s *SecretGen) Generate(proxy *model.Proxy, push *model.PushContext, w *mod
 		if err := s.proxyAuthorizedForSecret(proxy, sr); err != nil {
 			pilotSDSCertificateErrors.Increment()
 			log.Warnf("requested secret %v not accessible for proxy %v: %v", sr.ResourceName, proxy.ID, err)
+			unauthorized = append(unauthorized, sr.ResourceName)
+			unauthorizedReason = err.Error()
 			continue
 		}
 		cachedItem, token, f := s.cache.Get(sr)
@@ -178,7 +212,15 @@ func (s *SecretGen) Generate(proxy *model.Proxy, push *model.PushContext, w *mod
 			}
 		}
 	}
-	return results, model.XdsLogDetails{AdditionalInfo: fmt.Sprintf("cached:%v/%v", cached, cached+regenerated)}, nil
+	details, err := unauthorizedResourcesDetails(proxy, v3.SecretType, unauthorized, unauthorizedReason)
+	if err != nil {
+		return nil, details, err
+	}
+	info := fmt.Sprintf("cached:%v/%v", cached, cached+regenerated)
+	if details.AdditionalInfo != "" {
+		info += " " + details.AdditionalInfo
+	}
+	return results, model.XdsLogDetails{AdditionalInfo: info}, nil
 }
 
 func toEnvoyCaSecret(name string, cert []byte) *discovery.Resource {
@@ -19,12 +19,15 @@ import (
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
+	"google.golang.org/grpc/codes"
+	grpcstatus "google.golang.org/grpc/status"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/kubernetes/fake"
 	k8stesting "k8s.io/client-go/testing"
 
+	"istio.io/istio/pilot/pkg/features"
 	"istio.io/istio/pilot/pkg/model"
 	kubesecrets "istio.io/istio/pilot/pkg/secrets/kube"
 	authnmodel "istio.io/istio/pilot/pkg/security/model"
@@ -343,3 +346,52 @@ func TestGenerate(t *testing.T) {
 		})
 	}
 }
+
+func TestUnauthorizedResourcePolicy(t *testing.T) {
+	original := features.UnauthorizedResourcePolicy
+	t.Cleanup(func() {
+		features.UnauthorizedResourcePolicy = original
+	})
+	cases := []struct {
+		policy       features.UnauthorizedResourcePolicyType
+		expectSecret bool
+		expectInfo   string
+		expectCode   codes.Code
+	}{
+		{policy: features.UnauthorizedResourceFilterSilent, expectSecret: true, expectInfo: "cached:0/1"},
+		{policy: features.UnauthorizedResourceLogAndFilter, expectSecret: true, expectInfo: "cached:0/1 unauthorized:[kubernetes://other/generic]"},
+		{policy: features.UnauthorizedResourceDeny, expectCode: codes.PermissionDenied},
+	}
+	for _, tt := range cases {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			features.UnauthorizedResourcePolicy = tt.policy
+			s := NewFakeDiscoveryServer(t, FakeOptions{
+				KubernetesObjects: []runtime.Object{genericCert},
+			})
+			cc := s.KubeClient().Kube().(*fake.Clientset)
+			cc.Fake.Lock()
+			kubesecrets.DisableAuthorizationForTest(cc)
+			cc.Fake.Unlock()
+
+			gen := s.Discovery.Generators[v3.SecretType]
+			proxy := &model.Proxy{VerifiedIdentity: &spiffe.Identity{Namespace: "istio-system"}, Type: model.Router, ConfigNamespace: "istio-system"}
+			// The secret of another namespace is out of scope
+			secrets, details, err := gen.Generate(s.SetupProxy(proxy), s.PushContext(),
+				&model.WatchedResource{ResourceNames: []string{"kubernetes://generic", "kubernetes://other/generic"}},
+				&model.PushRequest{Full: true})
+			if code := grpcstatus.Code(err); code != tt.expectCode {
+				t.Fatalf("expected code %v, got %v", tt.expectCode, err)
+			}
+			if err != nil {
+				return
+			}
+			raw := xdstest.ExtractTLSSecrets(t, model.ResourcesToAny(secrets))
+			if tt.expectSecret && (len(raw) != 1 || raw["kubernetes://generic"] == nil) {
+				t.Fatalf("expected only the authorized secret, got %v", raw)
+			}
+			if details.AdditionalInfo != tt.expectInfo {
+				t.Fatalf("expected push details %q, got %q", tt.expectInfo, details.AdditionalInfo)
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package xds
+
+import (
+	"net/http"
+
+	"istio.io/istio/pilot/pkg/model"
+)
+
+// inStandby returns true if config changes are not recomputed nor pushed, as the server is a warm standby. Until
+// caches are synced, push contexts are computed as usual, so the standby serves the initial state of the world.
+func (s *DiscoveryServer) inStandby() bool {
+	return s.standby.Load() && s.IsServerReady()
+}
+
+// Promote ends standby mode. A full push is triggered, so connected proxies receive config computed from the
+// current state.
+func (s *DiscoveryServer) Promote() {
+	if !s.standby.CAS(true, false) {
+		return
+	}
+	log.Infof("Promoted from standby, resuming config pushes")
+	s.ConfigUpdate(&model.PushRequest{Full: true, Reason: []model.TriggerReason{model.GlobalUpdate}})
+}
+
+// PromoteHandler promotes a standby server to full operation. It is mapped to /debug/promote.
+func (s *DiscoveryServer) PromoteHandler(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	s.Promote()
+	_, _ = w.Write([]byte("OK"))
+}
@@ -0,0 +1,58 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package xds
+
+import (
+	"istio.io/istio/pilot/pkg/features"
+	v3 "istio.io/istio/pilot/pkg/xds/v3"
+)
+
+const legacyTypePrefix = "type.googleapis.com/envoy.api.v2."
+
+// legacyTypeURLs maps the legacy v2 type URLs to their v3 equivalents.
+var legacyTypeURLs = map[string]string{
+	legacyTypePrefix + "Cluster":               v3.ClusterType,
+	legacyTypePrefix + "ClusterLoadAssignment": v3.EndpointType,
+	legacyTypePrefix + "Listener":              v3.ListenerType,
+	legacyTypePrefix + "RouteConfiguration":    v3.RouteType,
+	legacyTypePrefix + "auth.Secret":           v3.SecretType,
+}
+
+// v2CompatTypeURLs returns the legacy type URLs translated when features.EnableV2Compat is set.
+func v2CompatTypeURLs() map[string]string {
+	if !features.EnableV2Compat {
+		return nil
+	}
+	if len(features.V2CompatTypes) == 0 {
+		return legacyTypeURLs
+	}
+	out := make(map[string]string, len(features.V2CompatTypes))
+	for _, t := range features.V2CompatTypes {
+		if v3Type, f := legacyTypeURLs[t]; f {
+			out[t] = v3Type
+		} else {
+			log.Warnf("ignoring unknown legacy type URL %q in PILOT_V2_COMPAT_TYPES", t)
+		}
+	}
+	return out
+}
+
+// translateTypeURL returns the v3 type URL served for typeURL. Legacy type URLs are translated if enabled.
+func (s *DiscoveryServer) translateTypeURL(typeURL string) string {
+	if v3Type, f := s.v2CompatTypes[typeURL]; f {
+		return v3Type
+	}
+	return typeURL
+}
@@ -217,3 +217,98 @@ func TestXdsCache(t *testing.T) {
 		}
 	})
 }
+
+func TestXdsCacheRevisions(t *testing.T) {
+	ep := EndpointBuilder{
+		clusterName: "outbound|1||foo.com",
+		service:     &model.Service{Hostname: "foo.com"},
+	}
+	shared := model.NewLenientXdsCache()
+	stable := model.NewRevisionXdsCache(shared, "stable")
+	canary := model.NewRevisionXdsCache(shared, "canary")
+
+	_, tok, _ := stable.Get(ep)
+	stable.Add(ep, tok, any1)
+	if _, _, f := canary.Get(ep); f {
+		t.Fatalf("unexpected result, found the entry of another revision")
+	}
+	_, tok, _ = canary.Get(ep)
+	canary.Add(ep, tok, any2)
+
+	if got, _, _ := stable.Get(ep); got != any1 {
+		t.Fatalf("unexpected result: %v, want %v", got, any1)
+	}
+	if got, _, _ := canary.Get(ep); got != any2 {
+		t.Fatalf("unexpected result: %v, want %v", got, any2)
+	}
+	if !reflect.DeepEqual(stable.Keys(), []string{ep.Key()}) {
+		t.Fatalf("unexpected keys: %v, want %v", stable.Keys(), ep.Key())
+	}
+	if len(shared.Keys()) != 2 {
+		t.Fatalf("expected an entry per revision, got %v", shared.Keys())
+	}
+
+	// Config changes apply to all revisions
+	stable.Clear(map[model.ConfigKey]struct{}{{Kind: gvk.ServiceEntry, Name: "foo.com"}: {}})
+	if _, _, f := canary.Get(ep); f {
+		t.Fatalf("unexpected result, found key when not expected: %v", shared.Keys())
+	}
+}
+
+func TestXdsCacheSizeBytes(t *testing.T) {
+	ep := EndpointBuilder{
+		clusterName: "outbound|1||foo.com",
+		service:     &model.Service{Hostname: "foo.com"},
+	}
+	c := model.NewLenientXdsCache()
+	if got := c.SizeBytes(); got != 0 {
+		t.Fatalf("expected an empty cache, got %d bytes", got)
+	}
+	_, tok, _ := c.Get(ep)
+	c.Add(ep, tok, &discovery.Resource{Name: "foo", Resource: &any.Any{Value: make([]byte, 100)}})
+	if got := c.SizeBytes(); got != 103 {
+		t.Fatalf("expected 103 bytes, got %d", got)
+	}
+	c.ClearAll()
+	if got := c.SizeBytes(); got != 0 {
+		t.Fatalf("expected a cleared cache, got %d bytes", got)
+	}
+}
+
+func TestXdsCacheCompaction(t *testing.T) {
+	foo := &model.Service{Hostname: "foo.com", Attributes: model.ServiceAttributes{Namespace: "default"}}
+	bar := &model.Service{Hostname: "bar.com", Attributes: model.ServiceAttributes{Namespace: "default"}}
+	fooEp := EndpointBuilder{clusterName: "outbound|1||foo.com", service: foo}
+	barEp := EndpointBuilder{
+		clusterName:     "outbound|1||bar.com",
+		service:         bar,
+		destinationRule: &config.Config{Meta: config.Meta{Name: "bar", Namespace: "default"}},
+	}
+	s := &DiscoveryServer{Cache: model.NewLenientXdsCache()}
+	for _, ep := range []EndpointBuilder{fooEp, barEp} {
+		_, tok, _ := s.Cache.Get(ep)
+		s.Cache.Add(ep, tok, any1)
+	}
+
+	push := model.NewPushContext()
+	push.ServiceIndex.HostnameAndNamespace[foo.Hostname] = map[string]*model.Service{"default": foo}
+	push.ServiceIndex.HostnameAndNamespace[bar.Hostname] = map[string]*model.Service{"default": bar}
+	if removed := s.compactCache(push); removed != 0 {
+		t.Fatalf("expected no entries to be removed, got %v", removed)
+	}
+	if len(s.Cache.Keys()) != 2 {
+		t.Fatalf("expected 2 keys, got: %v", s.Cache.Keys())
+	}
+
+	// bar.com is removed; its entry is stale, even though the destination rule it depends on is unknown
+	delete(push.ServiceIndex.HostnameAndNamespace, bar.Hostname)
+	if removed := s.compactCache(push); removed != 1 {
+		t.Fatalf("expected 1 entry to be removed, got %v", removed)
+	}
+	if !reflect.DeepEqual(s.Cache.Keys(), []string{fooEp.Key()}) {
+		t.Fatalf("unexpected keys: %v, want %v", s.Cache.Keys(), fooEp.Key())
+	}
+	if _, _, f := s.Cache.Get(fooEp); !f {
+		t.Fatalf("expected foo.com to still be cached")
+	}
+}
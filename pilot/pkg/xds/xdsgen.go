@@ -15,13 +15,19 @@
 package xds
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"hash"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/cespare/xxhash/v2"
 	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
 	discovery "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
 
+	"istio.io/istio/pilot/pkg/features"
 	"istio.io/istio/pilot/pkg/model"
 	"istio.io/istio/pilot/pkg/networking/util"
 	v3 "istio.io/istio/pilot/pkg/xds/v3"
@@ -61,6 +67,9 @@ func init() {
 }
 
 func (s *DiscoveryServer) findGenerator(typeURL string, con *Connection) model.XdsResourceGenerator {
+	if con.servesEmpty {
+		return emptyGenerator{}
+	}
 	if g, f := s.Generators[con.proxy.Metadata.Generator+"/"+typeURL]; f {
 		return g
 	}
@@ -83,6 +92,14 @@ func (s *DiscoveryServer) findGenerator(typeURL string, con *Connection) model.X
 	return g
 }
 
+// emptyGenerator generates no resources, so responses have no resources.
+type emptyGenerator struct{}
+
+func (emptyGenerator) Generate(*model.Proxy, *model.PushContext, *model.WatchedResource,
+	*model.PushRequest) (model.Resources, model.XdsLogDetails, error) {
+	return model.Resources{}, model.DefaultXdsLogDetails, nil
+}
+
 // Push an XDS resource for the given connection. Configuration will be generated
 // based on the passed in generator. Based on the updates field, generators may
 // choose to send partial or even no response if there are no changes.
@@ -95,10 +112,14 @@ func (s *DiscoveryServer) pushXds(con *Connection, push *model.PushContext,
 	if gen == nil {
 		return nil
 	}
+	push = s.meshOverridePush(con.proxy, push)
 
 	t0 := time.Now()
 
-	res, logdata, err := gen.Generate(con.proxy, push, w, req)
+	res, logdata, err := s.generate(con, gen, push, w, req)
+	if err != nil {
+		s.recordProxyError(con, w.TypeUrl, err)
+	}
 	if err != nil || res == nil {
 		// If we have nothing to send, report that we got an ACK for this version.
 		if s.StatusReporter != nil {
@@ -106,7 +127,20 @@ func (s *DiscoveryServer) pushXds(con *Connection, push *model.PushContext,
 		}
 		return err
 	}
-	defer func() { recordPushTime(w.TypeUrl, time.Since(t0)) }()
+	defer func() { recordPushTime(w.TypeUrl, time.Since(t0), con) }()
+
+	var resHash string
+	if features.SuppressNoOpPushes && !logdata.Incremental {
+		resHash = resourcesHash(features.PushHashAlgorithm, res)
+		if prev, f := con.pushedHashes[w.TypeUrl]; f && prev == resHash && !proxyRequested(req) {
+			noOpPushesSuppressed.With(typeTag.Value(v3.GetMetricType(w.TypeUrl))).Increment()
+			log.Debugf("%s: SKIP no-op push for node:%s", v3.GetShortType(w.TypeUrl), con.ConID)
+			if s.StatusReporter != nil {
+				s.StatusReporter.RegisterEvent(con.ConID, w.TypeUrl, push.LedgerVersion)
+			}
+			return nil
+		}
+	}
 
 	resp := &discovery.DiscoveryResponse{
 		ControlPlane: ControlPlane(),
@@ -121,8 +155,26 @@ func (s *DiscoveryServer) pushXds(con *Connection, push *model.PushContext,
 
 	if err := con.send(resp); err != nil {
 		recordSendError(w.TypeUrl, con.ConID, err)
+		s.recordProxyError(con, w.TypeUrl, err)
 		return err
 	}
+	con.pushed.record(w.TypeUrl, res, !logdata.Incremental)
+	s.publishPushEvent(con, w.TypeUrl, configSize, t0)
+	if resHash != "" {
+		con.pushedHashes[w.TypeUrl] = resHash
+	} else {
+		// The proxy state is no longer the last hashed resource set.
+		delete(con.pushedHashes, w.TypeUrl)
+	}
+	if features.EnableProxyConvergenceMetric {
+		con.proxy.Lock()
+		if req != nil {
+			w.ChangeTime = req.ChangeTime
+		} else {
+			w.ChangeTime = time.Time{}
+		}
+		con.proxy.Unlock()
+	}
 
 	ptype := "PUSH"
 	info := ""
@@ -152,6 +204,182 @@ func (s *DiscoveryServer) pushXds(con *Connection, push *model.PushContext,
 	return nil
 }
 
+// generatedResources is the result of a generation for a type.
+type generatedResources struct {
+	res     model.Resources
+	logdata model.XdsLogDetails
+	err     error
+}
+
+// generate generates the resources for a type. If XDSGenerationTimeout is set and generation takes
+// longer, the resources last generated for the type are returned instead, so a single slow generator
+// cannot stall pushes of other types. The slow generation keeps running in the background on a snapshot
+// of the watched resource, without holding computation slots, and its result is discarded. Without a
+// previous version, e.g. for the initial request of the type, generation is awaited so the request is answered.
+func (s *DiscoveryServer) generate(con *Connection, gen model.XdsResourceGenerator, push *model.PushContext,
+	w *model.WatchedResource, req *model.PushRequest) (model.Resources, model.XdsLogDetails, error) {
+	if features.XDSGenerationTimeout <= 0 {
+		return s.generateWithComputeSlot(con, gen, push, w, req)
+	}
+	prev, f := con.lastGenerated[w.TypeUrl]
+	if !f {
+		res, logdata, err := s.generateWithComputeSlot(con, gen, push, w, req)
+		con.recordGenerated(w.TypeUrl, generatedResources{res: res, logdata: logdata, err: err})
+		return res, logdata, err
+	}
+	release, err := s.acquireComputeSlot(con, req)
+	if err != nil {
+		return nil, model.DefaultXdsLogDetails, err
+	}
+	var releaseOnce sync.Once
+	snapshot := snapshotWatchedResource(w)
+	done := make(chan struct{})
+	resultCh := make(chan generatedResources, 1)
+	go func() {
+		defer close(done)
+		defer releaseOnce.Do(release)
+		res, logdata, err := s.runGenerator(con, gen, push, snapshot, req)
+		resultCh <- generatedResources{res: res, logdata: logdata, err: err}
+	}()
+	timer := time.NewTimer(features.XDSGenerationTimeout)
+	defer timer.Stop()
+	select {
+	case r := <-resultCh:
+		con.recordGenerated(w.TypeUrl, r)
+		return r.res, r.logdata, r.err
+	case <-timer.C:
+		releaseOnce.Do(release)
+		con.abandonedGenerations = append(con.abandonedGenerations, done)
+		xdsGenerationTimeouts.With(typeTag.Value(v3.GetMetricType(w.TypeUrl))).Increment()
+		log.Warnf("%s: generation for node:%s timed out after %v, serving previous version",
+			v3.GetShortType(w.TypeUrl), con.ConID, features.XDSGenerationTimeout)
+		return prev.res, model.XdsLogDetails{AdditionalInfo: "stale"}, nil
+	}
+}
+
+// snapshotWatchedResource copies w, so a generation running in the background is not affected by later requests.
+func snapshotWatchedResource(w *model.WatchedResource) *model.WatchedResource {
+	snapshot := *w
+	if w.ResourceNames != nil {
+		snapshot.ResourceNames = append(make([]string, 0, len(w.ResourceNames)), w.ResourceNames...)
+	}
+	return &snapshot
+}
+
+// recordGenerated records the result of a successful full generation, to be served if a later generation times out.
+func (con *Connection) recordGenerated(typeURL string, r generatedResources) {
+	if r.err == nil && r.res != nil && !r.logdata.Incremental {
+		con.lastGenerated[typeURL] = r
+	}
+}
+
+// waitForAbandonedGenerations waits for the generations that timed out to complete, as they still read the proxy.
+// It must be called before the proxy is updated.
+func (con *Connection) waitForAbandonedGenerations() error {
+	for len(con.abandonedGenerations) > 0 {
+		select {
+		case <-con.abandonedGenerations[0]:
+			con.abandonedGenerations = con.abandonedGenerations[1:]
+		case <-con.streamContext().Done():
+			return con.streamContext().Err()
+		}
+	}
+	return nil
+}
+
+// generateWithComputeSlot runs a full generation once a computation slot is available.
+func (s *DiscoveryServer) generateWithComputeSlot(con *Connection, gen model.XdsResourceGenerator, push *model.PushContext,
+	w *model.WatchedResource, req *model.PushRequest) (model.Resources, model.XdsLogDetails, error) {
+	release, err := s.acquireComputeSlot(con, req)
+	if err != nil {
+		return nil, model.DefaultXdsLogDetails, err
+	}
+	defer release()
+	return s.runGenerator(con, gen, push, w, req)
+}
+
+// acquireComputeSlot waits for the computation slots of a generation, returning a function releasing them. The number
+// of slots, shared across all connections, is bounded by MaxConcurrentComputations; if unset, or for incremental
+// generations, no slot is needed. Generations for the same node ID are further bounded by MaxConcurrentPushesPerNode.
+func (s *DiscoveryServer) acquireComputeSlot(con *Connection, req *model.PushRequest) (func(), error) {
+	releaseNode := func() {}
+	if s.nodeGenerations != nil {
+		release, err := s.nodeGenerations.acquire(con.streamContext(), con.node.GetId())
+		if err != nil {
+			return nil, err
+		}
+		releaseNode = release
+	}
+	if s.computeLimit == nil || !req.Full {
+		return releaseNode, nil
+	}
+	select {
+	case s.computeLimit <- struct{}{}:
+	case <-con.streamContext().Done():
+		releaseNode()
+		return nil, con.streamContext().Err()
+	}
+	return func() {
+		<-s.computeLimit
+		releaseNode()
+	}, nil
+}
+
+// runGenerator runs the generator, warning about generations exceeding GenerationCPUWarnThreshold of CPU time.
+func (s *DiscoveryServer) runGenerator(con *Connection, gen model.XdsResourceGenerator, push *model.PushContext,
+	w *model.WatchedResource, req *model.PushRequest) (model.Resources, model.XdsLogDetails, error) {
+	if features.GenerationCPUWarnThreshold <= 0 {
+		return gen.Generate(con.proxy, push, w, req)
+	}
+	var (
+		res     model.Resources
+		logdata model.XdsLogDetails
+		err     error
+	)
+	cpu, measured := measureCPUTime(func() {
+		res, logdata, err = gen.Generate(con.proxy, push, w, req)
+	})
+	if measured && cpu > features.GenerationCPUWarnThreshold {
+		expensiveGenerations.With(typeTag.Value(v3.GetMetricType(w.TypeUrl))).Increment()
+		log.Warnf("%s: generation for node:%s used %v of CPU time, exceeding %v", v3.GetShortType(w.TypeUrl),
+			con.node.GetId(), cpu, features.GenerationCPUWarnThreshold)
+	}
+	return res, logdata, err
+}
+
+// proxyRequested returns true if the push answers a request of the proxy, rather than a config change.
+func proxyRequested(req *model.PushRequest) bool {
+	if req == nil {
+		return false
+	}
+	for _, r := range req.Reason {
+		if r == model.ProxyRequest {
+			return true
+		}
+	}
+	return false
+}
+
+// resourcesHash returns a hash of the names and content of res, computed with algorithm.
+func resourcesHash(algorithm features.PushHashAlgorithmType, res model.Resources) string {
+	var h hash.Hash
+	if algorithm == features.PushHashSHA256 {
+		h = sha256.New()
+	} else {
+		h = xxhash.New()
+	}
+	for _, r := range res {
+		_, _ = h.Write([]byte(r.Name))
+		_, _ = h.Write([]byte{0})
+		if r.Resource != nil {
+			_, _ = h.Write([]byte(r.Resource.TypeUrl))
+			_, _ = h.Write(r.Resource.Value)
+		}
+		_, _ = h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
 func ResourceSize(r model.Resources) int {
 	// Approximate size by looking at the Any marshaled size. This avoids high cost
 	// proto.Size, at the expense of slightly under counting.
@@ -122,6 +122,9 @@ const (
 	CertProviderKubernetes = "kubernetes"
 	// CertProviderCustom uses the custom root certificate mounted in a well known location for the control plane
 	CertProviderCustom = "custom"
+	// CertProviderFile uses the DNS certificate files configured for the control plane. It is only used
+	// in the prioritized PILOT_CERT_PROVIDERS list, as configured files otherwise always take precedence.
+	CertProviderFile = "file"
 	// CertProviderNone does not create any certificates for the control plane. It is assumed that some external
 	// load balancer, such as an Istio Gateway, is terminating the TLS.
 	CertProviderNone = "none"
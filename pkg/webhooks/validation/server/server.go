@@ -31,6 +31,7 @@ import (
 	"k8s.io/apimachinery/pkg/runtime/serializer"
 
 	"istio.io/istio/pilot/pkg/config/kube/crd"
+	"istio.io/istio/pilot/pkg/features"
 	"istio.io/istio/pkg/config/schema/collection"
 	"istio.io/istio/pkg/config/schema/resource"
 	"istio.io/istio/pkg/config/validation"
@@ -141,6 +142,30 @@ func toAdmissionResponse(err error) *kube.AdmissionResponse {
 	return &kube.AdmissionResponse{Result: &metav1.Status{Message: err.Error()}}
 }
 
+// errorResponse is the body of validation webhook errors in the json format.
+type errorResponse struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// httpError replies to the request with the error message and HTTP code, in the configured format.
+func httpError(w http.ResponseWriter, message string, code int) {
+	reportValidationHTTPError(code)
+	if features.ValidationErrorFormat != features.ValidationErrorJSON {
+		http.Error(w, message, code)
+		return
+	}
+	b, err := json.Marshal(errorResponse{Code: code, Message: message})
+	if err != nil {
+		http.Error(w, message, code)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(code)
+	_, _ = w.Write(b)
+}
+
 type admitFunc func(*kube.AdmissionRequest) *kube.AdmissionResponse
 
 func serve(w http.ResponseWriter, r *http.Request, admit admitFunc) {
@@ -151,16 +176,14 @@ func serve(w http.ResponseWriter, r *http.Request, admit admitFunc) {
 		}
 	}
 	if len(body) == 0 {
-		reportValidationHTTPError(http.StatusBadRequest)
-		http.Error(w, "no body found", http.StatusBadRequest)
+		httpError(w, "no body found", http.StatusBadRequest)
 		return
 	}
 
 	// verify the content type is accurate
 	contentType := r.Header.Get("Content-Type")
 	if contentType != "application/json" {
-		reportValidationHTTPError(http.StatusUnsupportedMediaType)
-		http.Error(w, "invalid Content-Type, want `application/json`", http.StatusUnsupportedMediaType)
+		httpError(w, "invalid Content-Type, want `application/json`", http.StatusUnsupportedMediaType)
 		return
 	}
 
@@ -194,13 +217,11 @@ func serve(w http.ResponseWriter, r *http.Request, admit admitFunc) {
 	responseKube = kube.AdmissionReviewAdapterToKube(&response, apiVersion)
 	resp, err := json.Marshal(responseKube)
 	if err != nil {
-		reportValidationHTTPError(http.StatusInternalServerError)
-		http.Error(w, fmt.Sprintf("could encode response: %v", err), http.StatusInternalServerError)
+		httpError(w, fmt.Sprintf("could encode response: %v", err), http.StatusInternalServerError)
 		return
 	}
 	if _, err := w.Write(resp); err != nil {
-		reportValidationHTTPError(http.StatusInternalServerError)
-		http.Error(w, fmt.Sprintf("could write response: %v", err), http.StatusInternalServerError)
+		httpError(w, fmt.Sprintf("could write response: %v", err), http.StatusInternalServerError)
 	}
 }
 
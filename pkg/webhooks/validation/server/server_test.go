@@ -34,6 +34,7 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 
+	"istio.io/istio/pilot/pkg/features"
 	"istio.io/istio/pkg/config/schema/collections"
 	"istio.io/istio/pkg/kube"
 	"istio.io/istio/pkg/test/config"
@@ -381,6 +382,64 @@ func TestServe(t *testing.T) {
 	}
 }
 
+func TestServeJSONErrors(t *testing.T) {
+	original := features.ValidationErrorFormat
+	t.Cleanup(func() {
+		features.ValidationErrorFormat = original
+	})
+	features.ValidationErrorFormat = features.ValidationErrorJSON
+
+	cases := []struct {
+		name           string
+		body           []byte
+		contentType    string
+		wantStatusCode int
+		wantMessage    string
+	}{
+		{
+			name:           "no content",
+			body:           []byte{},
+			contentType:    "application/json",
+			wantStatusCode: http.StatusBadRequest,
+			wantMessage:    "no body found",
+		},
+		{
+			name:           "wrong content-type",
+			body:           makeTestReview(t, true, "v1beta1"),
+			contentType:    "application/yaml",
+			wantStatusCode: http.StatusUnsupportedMediaType,
+			wantMessage:    "invalid Content-Type, want `application/json`",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "http://validator", bytes.NewReader(c.body))
+			req.Header.Add("Content-Type", c.contentType)
+			w := httptest.NewRecorder()
+
+			serve(w, req, func(*kube.AdmissionRequest) *kube.AdmissionResponse {
+				return &kube.AdmissionResponse{Allowed: true}
+			})
+
+			res := w.Result()
+			if res.StatusCode != c.wantStatusCode {
+				t.Fatalf("wrong status code: got %v want %v", res.StatusCode, c.wantStatusCode)
+			}
+			if ct := res.Header.Get("Content-Type"); ct != "application/json" {
+				t.Fatalf("wrong content type: got %v want application/json", ct)
+			}
+			var got errorResponse
+			if err := json.NewDecoder(res.Body).Decode(&got); err != nil {
+				t.Fatalf("could not decode error: %v", err)
+			}
+			want := errorResponse{Code: c.wantStatusCode, Message: c.wantMessage}
+			if got != want {
+				t.Fatalf("wrong error: got %+v want %+v", got, want)
+			}
+		})
+	}
+}
+
 // scenario is a common struct used by many tests in this context.
 type scenario struct {
 	wrapFunc      func(*Options)
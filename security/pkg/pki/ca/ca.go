@@ -308,6 +308,14 @@ func (ca *IstioCA) Run(stopChan chan struct{}) {
 	}
 }
 
+// SetRootCertRotationGate restricts the rotation of the self-signed root cert to when canRotate returns true. Root
+// certs rotated by other instances are still reloaded. It must be called before Run.
+func (ca *IstioCA) SetRootCertRotationGate(canRotate func() bool) {
+	if ca.rootCertRotator != nil {
+		ca.rootCertRotator.canRotate = canRotate
+	}
+}
+
 // Sign takes a PEM-encoded CSR and cert opts, and returns a signed certificate.
 func (ca *IstioCA) Sign(csrPEM []byte, certOpts CertOpts) (
 	[]byte, error) {
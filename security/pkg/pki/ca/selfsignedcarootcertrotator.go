@@ -52,6 +52,9 @@ type SelfSignedCARootCertRotator struct {
 	config             *SelfSignedCARootCertRotatorConfig
 	backOffTime        time.Duration
 	ca                 *IstioCA
+	// canRotate, if set, reports whether this instance may rotate the root cert. Root certs rotated by other
+	// instances are reloaded regardless.
+	canRotate func() bool
 }
 
 // NewSelfSignedCARootCertRotator returns a new root cert rotator instance that
@@ -157,6 +160,11 @@ func (rotator *SelfSignedCARootCertRotator) checkAndRotateRootCertForSigningCert
 		return
 	}
 
+	if rotator.canRotate != nil && !rotator.canRotate() {
+		rootCertRotatorLog.Info("Root cert is about to expire, leaving the rotation to the instance in charge of it.")
+		return
+	}
+
 	rootCertRotatorLog.Infof("Refresh root certificate, root cert is about to expire: %s", err.Error())
 
 	oldCertOptions, err := util.GetCertOptionsFromExistingCert(caSecret.Data[CACertFile])
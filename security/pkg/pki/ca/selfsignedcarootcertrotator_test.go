@@ -269,6 +269,45 @@ func TestKeyCertBundleReloadInRootCertRotatorForSigningCitadel(t *testing.T) {
 	}
 }
 
+// TestRootCertRotatorGate verifies that a gated rotator does not rotate the root cert, but still
+// reloads root certs rotated by other Citadels.
+func TestRootCertRotatorGate(t *testing.T) {
+	rotator := getRootCertRotator(getDefaultSelfSignedIstioCAOptions(nil))
+	rotator.canRotate = func() bool { return false }
+
+	// Change grace period percentage to 100, so that root cert would be rotated if allowed.
+	certItem0 := loadCert(rotator)
+	rotator.config.certInspector = certutil.NewCertUtil(100)
+	rotator.checkAndRotateRootCert()
+	certItem1 := loadCert(rotator)
+	verifyRootCertAndPrivateKey(t, true, certItem0, certItem1)
+
+	// Rotate the root cert as if by another Citadel.
+	pemCert, pemKey, ckErr := util.GenRootCertFromExistingKey(util.CertOptions{
+		TTL:           rotator.config.caCertTTL,
+		SignerPrivPem: certItem1.caSecret.Data[CAPrivateKeyFile],
+		Org:           rotator.config.org,
+		IsCA:          true,
+		IsSelfSigned:  true,
+		RSAKeySize:    rotator.ca.caRSAKeySize,
+		IsDualUse:     rotator.config.dualUse,
+	})
+	if ckErr != nil {
+		t.Fatalf("failed to rotate secret: %s", ckErr.Error())
+	}
+	newSecret := certItem1.caSecret
+	newSecret.Data[CACertFile] = pemCert
+	newSecret.Data[CAPrivateKeyFile] = pemKey
+	rotator.config.client.Secrets(rotator.config.caStorageNamespace).Update(context.TODO(), newSecret, metav1.UpdateOptions{})
+
+	// Change grace period percentage to 0, so that root cert is not going to expire soon.
+	rotator.config.certInspector = certutil.NewCertUtil(0)
+	rotator.checkAndRotateRootCert()
+	if !bytes.Equal(pemCert, rotator.ca.keyCertBundle.GetRootCertPem()) {
+		t.Error("root cert rotated by another Citadel should be reloaded into key cert bundle.")
+	}
+}
+
 // TestRollbackAtRootCertRotatorForSigningCitadel verifies that rotator rollbacks
 // new root cert if it fails to update new root cert into configmap.
 func TestRollbackAtRootCertRotatorForSigningCitadel(t *testing.T) {